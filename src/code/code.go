@@ -0,0 +1,276 @@
+// Package code - the bytecode the compiler produces and the VM runs
+package code
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"sort"
+
+	"sudocoding.xyz/interpreter_in_go/src/token"
+)
+
+// Instructions - a sequence of encoded instructions, each an opcode followed
+// by its operands in big endian
+type Instructions []byte
+
+// String - disassembles the instructions, one per line with its offset
+func (ins Instructions) String() string {
+	var out bytes.Buffer
+
+	for i := 0; i < len(ins); {
+		def, err := Lookup(ins[i])
+		if err != nil {
+			fmt.Fprintf(&out, "ERROR: %s\n", err)
+			i += 1
+			continue
+		}
+
+		operands, read := ReadOperands(def, ins[i+1:])
+		fmt.Fprintf(&out, "%04d %s\n", i, FormatInstruction(def, operands))
+
+		i += 1 + read
+	}
+
+	return out.String()
+}
+
+// FormatInstruction - the name of the instruction followed by its operands
+func FormatInstruction(def *Definition, operands []int) string {
+	if len(operands) != len(def.OperandWidths) {
+		return fmt.Sprintf("ERROR: operand len %d does not match defined %d\n", len(operands), len(def.OperandWidths))
+	}
+
+	var out bytes.Buffer
+	out.WriteString(def.Name)
+	for _, operand := range operands {
+		fmt.Fprintf(&out, " %d", operand)
+	}
+
+	return out.String()
+}
+
+// Opcode - the first byte of an instruction, what it does
+type Opcode byte
+
+const (
+	OpConstant Opcode = iota // push the constant at the index
+	OpPop                    // drop the top of the stack
+	OpDup                    // push the top of the stack again
+
+	// Operators, applied to the operands on top of the stack
+	OpAdd
+	OpSub
+	OpMul
+	OpDiv
+	OpMod
+	OpFloorDiv
+	OpPow
+	OpBitAnd
+	OpBitOr
+	OpBitXor
+	OpShl
+	OpShr
+	OpEqual
+	OpNotEqual
+	OpGreaterThan
+	OpGreaterEqual
+	OpLessThan
+	OpLessEqual
+	OpMinus
+	OpBang
+	OpBitNot
+
+	OpTrue
+	OpFalse
+	OpNull
+
+	OpJump          // jump to the offset
+	OpJumpNotTruthy // pop the top of the stack, jump to the offset if it's falsy
+
+	OpGetGlobal    // push the global at the index
+	OpSetGlobal    // pop the top of the stack into the global at the index
+	OpAssignGlobal // like OpSetGlobal, failing if the global isn't defined yet
+	OpCopyGlobal   // set the local at the second index to the global at the first, defined or not
+	OpGetLocal     // push the local at the index
+	OpSetLocal     // pop the top of the stack into the local at the index
+	OpAssignLocal  // like OpSetLocal, failing if the local isn't defined yet
+	OpGetFree      // push the local at the index of the function the given number of levels out
+	OpCopyFree     // set the local at the last index to the one OpGetFree would push, defined or not
+	OpGetBuiltin   // push the builtin at the index of BuiltinNames
+
+	OpArray       // build an array of the given number of elements on the stack
+	OpHash        // build a hash of the given number of keys and values on the stack
+	OpIndex       // index the collection below the top of the stack with the top
+	OpInterpolate // join the given number of values on the stack into a string
+
+	OpCall        // call the function below the given number of arguments
+	OpReturnValue // return the top of the stack from the current function
+	OpClosure     // push a closure of the compiled function at the constant index
+
+	OpThrow   // raise the top of the stack as an error
+	OpTry     // catch errors raised until OpEndTry by jumping to the offset
+	OpEndTry  // stop catching the errors of the innermost OpTry
+	OpRethrow // raise again the error of the exception on top of the stack
+
+	OpIter     // replace the iterable on top of the stack by an iterator; 1 to iterate keys and values, 0 for values only
+	OpIterNext // pop an iterator, jump to the offset if it's exhausted, else push its next key and value
+)
+
+// Definition - the name of an opcode and the width in bytes of its operands
+type Definition struct {
+	Name          string
+	OperandWidths []int
+}
+
+var definitions = map[Opcode]*Definition{
+	OpConstant: {"OpConstant", []int{2}},
+	OpPop:      {"OpPop", []int{}},
+	OpDup:      {"OpDup", []int{}},
+
+	OpAdd:          {"OpAdd", []int{}},
+	OpSub:          {"OpSub", []int{}},
+	OpMul:          {"OpMul", []int{}},
+	OpDiv:          {"OpDiv", []int{}},
+	OpMod:          {"OpMod", []int{}},
+	OpFloorDiv:     {"OpFloorDiv", []int{}},
+	OpPow:          {"OpPow", []int{}},
+	OpBitAnd:       {"OpBitAnd", []int{}},
+	OpBitOr:        {"OpBitOr", []int{}},
+	OpBitXor:       {"OpBitXor", []int{}},
+	OpShl:          {"OpShl", []int{}},
+	OpShr:          {"OpShr", []int{}},
+	OpEqual:        {"OpEqual", []int{}},
+	OpNotEqual:     {"OpNotEqual", []int{}},
+	OpGreaterThan:  {"OpGreaterThan", []int{}},
+	OpGreaterEqual: {"OpGreaterEqual", []int{}},
+	OpLessThan:     {"OpLessThan", []int{}},
+	OpLessEqual:    {"OpLessEqual", []int{}},
+	OpMinus:        {"OpMinus", []int{}},
+	OpBang:         {"OpBang", []int{}},
+	OpBitNot:       {"OpBitNot", []int{}},
+
+	OpTrue:  {"OpTrue", []int{}},
+	OpFalse: {"OpFalse", []int{}},
+	OpNull:  {"OpNull", []int{}},
+
+	OpJump:          {"OpJump", []int{2}},
+	OpJumpNotTruthy: {"OpJumpNotTruthy", []int{2}},
+
+	OpGetGlobal:    {"OpGetGlobal", []int{2}},
+	OpSetGlobal:    {"OpSetGlobal", []int{2}},
+	OpAssignGlobal: {"OpAssignGlobal", []int{2}},
+	OpCopyGlobal:   {"OpCopyGlobal", []int{2, 1}},
+	OpGetLocal:     {"OpGetLocal", []int{1}},
+	OpSetLocal:     {"OpSetLocal", []int{1}},
+	OpAssignLocal:  {"OpAssignLocal", []int{1}},
+	OpGetFree:      {"OpGetFree", []int{1, 1}},
+	OpCopyFree:     {"OpCopyFree", []int{1, 1, 1}},
+	OpGetBuiltin:   {"OpGetBuiltin", []int{1}},
+
+	OpArray:       {"OpArray", []int{2}},
+	OpHash:        {"OpHash", []int{2}},
+	OpIndex:       {"OpIndex", []int{}},
+	OpInterpolate: {"OpInterpolate", []int{2}},
+
+	OpCall:        {"OpCall", []int{1}},
+	OpReturnValue: {"OpReturnValue", []int{}},
+	OpClosure:     {"OpClosure", []int{2}},
+
+	OpThrow:   {"OpThrow", []int{}},
+	OpTry:     {"OpTry", []int{2}},
+	OpEndTry:  {"OpEndTry", []int{}},
+	OpRethrow: {"OpRethrow", []int{}},
+
+	OpIter:     {"OpIter", []int{1}},
+	OpIterNext: {"OpIterNext", []int{2}},
+}
+
+// Lookup - returns the definition of the opcode
+func Lookup(op byte) (*Definition, error) {
+	def, ok := definitions[Opcode(op)]
+	if !ok {
+		return nil, fmt.Errorf("opcode %d undefined", op)
+	}
+
+	return def, nil
+}
+
+// Make - encodes an instruction. Returns an empty instruction for unknown
+// opcodes.
+func Make(op Opcode, operands ...int) []byte {
+	def, ok := definitions[op]
+	if !ok {
+		return []byte{}
+	}
+
+	length := 1
+	for _, width := range def.OperandWidths {
+		length += width
+	}
+
+	instruction := make([]byte, length)
+	instruction[0] = byte(op)
+
+	offset := 1
+	for i, operand := range operands {
+		width := def.OperandWidths[i]
+		switch width {
+		case 2:
+			binary.BigEndian.PutUint16(instruction[offset:], uint16(operand))
+		case 1:
+			instruction[offset] = byte(operand)
+		}
+		offset += width
+	}
+
+	return instruction
+}
+
+// ReadOperands - decodes the operands of an instruction, `ins` starting right
+// after the opcode. Returns the operands and the number of bytes read.
+func ReadOperands(def *Definition, ins Instructions) ([]int, int) {
+	operands := make([]int, len(def.OperandWidths))
+	offset := 0
+
+	for i, width := range def.OperandWidths {
+		switch width {
+		case 2:
+			operands[i] = int(ReadUint16(ins[offset:]))
+		case 1:
+			operands[i] = int(ReadUint8(ins[offset:]))
+		}
+		offset += width
+	}
+
+	return operands, offset
+}
+
+func ReadUint16(ins Instructions) uint16 {
+	return binary.BigEndian.Uint16(ins)
+}
+
+func ReadUint8(ins Instructions) uint8 {
+	return uint8(ins[0])
+}
+
+// PosTable - source positions of instructions, by increasing offset. An
+// entry holds for the instructions up to the next entry.
+type PosTable []PosEntry
+
+// PosEntry - position of the source code the instruction at the offset was
+// compiled from
+type PosEntry struct {
+	Offset int
+	Pos    token.Position
+}
+
+// Lookup - returns the position of the instruction at the offset, the zero
+// position if there is none
+func (t PosTable) Lookup(offset int) token.Position {
+	i := sort.Search(len(t), func(i int) bool { return t[i].Offset > offset })
+	if i == 0 {
+		return token.Position{}
+	}
+	return t[i-1].Pos
+}
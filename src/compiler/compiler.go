@@ -0,0 +1,960 @@
+// Package compiler - compiles the AST to the bytecode the VM runs
+package compiler
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+
+	"sudocoding.xyz/interpreter_in_go/src/code"
+	"sudocoding.xyz/interpreter_in_go/src/diagnostic"
+	"sudocoding.xyz/interpreter_in_go/src/evaluator"
+	"sudocoding.xyz/interpreter_in_go/src/object"
+	"sudocoding.xyz/interpreter_in_go/src/parser/ast"
+	"sudocoding.xyz/interpreter_in_go/src/token"
+)
+
+// Diagnostic codes reported by the compiler
+const (
+	ErrUnsupported diagnostic.Code = "C0001" // construct only the evaluator runs
+	ErrTooMany     diagnostic.Code = "C0002" // more of something than an operand can address
+	ErrOutsideLoop diagnostic.Code = "C0003" // `break` or `continue` outside of a loop
+	ErrUnknownNode diagnostic.Code = "C0004" // node the compiler doesn't know about
+)
+
+const (
+	maxLocals  = 1 << 8  // Locals a function can have, OpGetLocal has a one byte operand
+	maxOperand = 1 << 16 // Largest two bytes operand, plus one
+)
+
+// infixOps - opcodes of the infix operators, but `&&` and `||` which are
+// jumps
+var infixOps = map[token.TokenType]code.Opcode{
+	token.PLUS:      code.OpAdd,
+	token.MINUS:     code.OpSub,
+	token.ASTERISK:  code.OpMul,
+	token.SLASH:     code.OpDiv,
+	token.PERCENT:   code.OpMod,
+	token.FLOOR_DIV: code.OpFloorDiv,
+	token.POWER:     code.OpPow,
+	token.BIT_AND:   code.OpBitAnd,
+	token.BIT_OR:    code.OpBitOr,
+	token.BIT_XOR:   code.OpBitXor,
+	token.SHL:       code.OpShl,
+	token.SHR:       code.OpShr,
+	token.EQ:        code.OpEqual,
+	token.NOT_EQ:    code.OpNotEqual,
+	token.GT:        code.OpGreaterThan,
+	token.GTE:       code.OpGreaterEqual,
+	token.LT:        code.OpLessThan,
+	token.LTE:       code.OpLessEqual,
+}
+
+var prefixOps = map[string]code.Opcode{
+	"-": code.OpMinus,
+	"!": code.OpBang,
+	"~": code.OpBitNot,
+}
+
+// Bytecode - the compiled program, along with the constants and the globals
+// it uses
+type Bytecode struct {
+	Instructions code.Instructions
+	Positions    code.PosTable
+	Constants    []object.Object
+	Globals      []string // Names of the globals by index
+}
+
+// Compiler - compiles programs to bytecode. A compiler made with
+// NewWithState carries on from the globals and the constants of previous
+// programs, like the REPL needs.
+type Compiler struct {
+	constants   []object.Object
+	literals    map[literal]int // Indexes of the constants by value, see addLiteral
+	symbolTable *SymbolTable
+
+	scopes []*compilationScope
+	pos    token.Position // Position the emitted instructions are compiled from
+
+	// First operand too large for its instruction, which Compile fails with,
+	// see checkOperand
+	overflow *diagnostic.Diagnostic
+}
+
+// literal - the value of a constant of a literal, constants of equal values
+// are shared
+type literal struct {
+	typ   object.ObjectType
+	value string
+}
+
+// compilationScope - the instructions of the function being compiled, the
+// program itself for the outermost one
+type compilationScope struct {
+	instructions code.Instructions
+	positions    code.PosTable
+
+	pending  int        // Values the enclosing expressions left on the stack
+	controls []*control // Loops and try blocks the compiled code is in
+	nested   []nested   // Functions defined in the function, compiled after it
+}
+
+// nested - a function defined in a function, compiled once all the variables
+// of the function around it are defined so it sees them all, like in the
+// evaluator
+type nested struct {
+	node     *ast.FunctionLiteral
+	constant int // Index of the constant of the compiled function
+}
+
+// control - a loop or a try block, which `break`, `continue` and `return`
+// have to get out of
+type control struct {
+	loop         bool
+	pending      int   // Values on the stack before the loop
+	bodyPending  int   // Values on the stack in the body of the loop
+	continueAt   int   // Offset of the next iteration
+	breaks       []int // Offsets of the jumps to the end of the loop
+	handler      bool  // The OpTry of the try block is active
+	finally      *ast.BlockStatement
+	finallyDepth int // Number of controls the finally block runs in
+}
+
+// New - creates a compiler for a new program
+func New() *Compiler {
+	return NewWithState(NewSymbolTable(), []object.Object{})
+}
+
+// NewWithState - creates a compiler that carries on from the globals of the
+// symbol table and the constants
+func NewWithState(symbolTable *SymbolTable, constants []object.Object) *Compiler {
+	c := &Compiler{
+		constants:   constants,
+		literals:    map[literal]int{},
+		symbolTable: symbolTable,
+		scopes:      []*compilationScope{{}},
+	}
+
+	for i, constant := range constants {
+		if key, ok := literalOf(constant); ok {
+			if _, ok := c.literals[key]; !ok {
+				c.literals[key] = i
+			}
+		}
+	}
+
+	return c
+}
+
+// Compile - compiles the program. The compiled program returns the value of
+// its last statement. Errors are *diagnostic.Diagnostic.
+func (c *Compiler) Compile(node ast.Node) error {
+	if program, ok := node.(*ast.Program); ok {
+		if len(program.Statements) == 0 {
+			return nil
+		}
+		if err := c.compileStatements(program.Statements, true); err != nil {
+			return err
+		}
+		c.emit(code.OpReturnValue)
+	} else if err := c.compile(node); err != nil {
+		return err
+	}
+
+	if c.overflow != nil {
+		return c.overflow
+	}
+	return nil
+}
+
+// Bytecode - returns the compiled program
+func (c *Compiler) Bytecode() *Bytecode {
+	return &Bytecode{
+		Instructions: c.scope().instructions,
+		Positions:    c.scope().positions,
+		Constants:    c.constants,
+		Globals:      c.symbolTable.globals().Names(),
+	}
+}
+
+func (c *Compiler) scope() *compilationScope {
+	return c.scopes[len(c.scopes)-1]
+}
+
+// compileStatements - compiles the statements, leaving the value of the last
+// one on the stack if `keep` is set
+func (c *Compiler) compileStatements(statements []ast.Statement, keep bool) error {
+	if len(statements) == 0 && keep {
+		c.emit(code.OpNull)
+	}
+
+	for i, statement := range statements {
+		if err := c.compileStatement(statement, keep && i == len(statements)-1); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// compileStatement - compiles the statement, leaving its value on the stack if
+// `keep` is set. Statements but expressions have no value, they leave null.
+func (c *Compiler) compileStatement(statement ast.Statement, keep bool) error {
+	if es, ok := statement.(*ast.ExpressionStatement); ok {
+		if err := c.compile(es.Expression); err != nil {
+			return err
+		}
+		if !keep {
+			c.emit(code.OpPop)
+		}
+		return nil
+	}
+
+	if err := c.compile(statement); err != nil {
+		return err
+	}
+
+	switch statement.(type) {
+	case *ast.ReturnStatement, *ast.ThrowStatement, *ast.BreakStatement, *ast.ContinueStatement:
+		// Nothing runs after them
+	default:
+		if keep {
+			c.emit(code.OpNull)
+		}
+	}
+
+	return nil
+}
+
+// compile - compiles the node. Expressions leave their value on the stack,
+// statements leave nothing.
+func (c *Compiler) compile(node ast.Node) error {
+	switch node := node.(type) {
+	// Statements
+	case *ast.Program:
+		return c.compileStatements(node.Statements, false)
+	case *ast.BlockStatement:
+		return c.compileStatements(node.Statements, false)
+	case *ast.ExpressionStatement:
+		return c.compileStatement(node, false)
+	case *ast.LetStatement:
+		return c.compileLet(node)
+	case *ast.Assignment:
+		return c.compileAssignment(node)
+	case *ast.ReturnStatement:
+		return c.compileReturn(node)
+	case *ast.ThrowStatement:
+		if err := c.compile(node.Value); err != nil {
+			return err
+		}
+		c.at(node.Pos())
+		c.emit(code.OpThrow)
+	case *ast.WhileStatement:
+		return c.compileWhile(node)
+	case *ast.ForStatement:
+		return c.compileFor(node)
+	case *ast.BreakStatement:
+		return c.compileLoopControl(node, true)
+	case *ast.ContinueStatement:
+		return c.compileLoopControl(node, false)
+
+	// Expressions
+	case *ast.IntegerLiteral:
+		c.at(node.Pos())
+		c.emit(code.OpConstant, c.addLiteral(&object.Integer{Value: node.Value}))
+	case *ast.BigIntegerLiteral:
+		c.at(node.Pos())
+		c.emit(code.OpConstant, c.addLiteral(&object.BigInteger{Value: node.Value}))
+	case *ast.FloatLiteral:
+		c.at(node.Pos())
+		c.emit(code.OpConstant, c.addLiteral(&object.Float{Value: node.Value}))
+	case *ast.StringLiteral:
+		c.at(node.Pos())
+		c.emit(code.OpConstant, c.addLiteral(&object.String{Value: node.Value}))
+	case *ast.Boolean:
+		c.at(node.Pos())
+		if node.Value {
+			c.emit(code.OpTrue)
+		} else {
+			c.emit(code.OpFalse)
+		}
+	case *ast.InterpolatedString:
+		if err := c.compileValues(node, node.Parts); err != nil {
+			return err
+		}
+		c.at(node.Pos())
+		c.emit(code.OpInterpolate, len(node.Parts))
+	case *ast.ArrayLiteral:
+		if err := c.compileValues(node, node.Elements); err != nil {
+			return err
+		}
+		c.at(node.Pos())
+		c.emit(code.OpArray, len(node.Elements))
+	case *ast.HashLiteral:
+		values := []ast.Expression{}
+		for _, key := range node.SortedKeys() {
+			values = append(values, key, node.Pairs[key])
+		}
+		if err := c.compileValues(node, values); err != nil {
+			return err
+		}
+		c.at(node.Pos())
+		c.emit(code.OpHash, len(values))
+	case *ast.IndexExpression:
+		if err := c.compileValues(node, []ast.Expression{node.Left, node.Index}); err != nil {
+			return err
+		}
+		c.at(node.Token.Pos)
+		c.emit(code.OpIndex)
+	case *ast.PrefixExpression:
+		op, ok := prefixOps[node.Operator]
+		if !ok {
+			return c.errorAt(node, ErrUnknownNode, "unknown operator: %s", node.Operator)
+		}
+		if err := c.compile(node.Right); err != nil {
+			return err
+		}
+		c.at(node.Pos())
+		c.emit(op)
+	case *ast.InfixExpression:
+		return c.compileInfix(node)
+	case *ast.IfExpression:
+		return c.compileIf(node)
+	case *ast.TryExpression:
+		return c.compileTry(node)
+	case *ast.Identifier:
+		c.at(node.Pos())
+		c.loadSymbol(c.resolve(node.Value))
+	case *ast.FunctionLiteral:
+		return c.compileFunction(node)
+	case *ast.CallExpression:
+		return c.compileCall(node)
+	case *ast.MacroLiteral:
+		return c.errorAt(node, ErrUnsupported, "macros must be expanded before compiling")
+	default:
+		return c.errorAt(node, ErrUnknownNode, "cannot compile %T", node)
+	}
+
+	return nil
+}
+
+// compileValues - compiles the expressions, whose values stay on the stack
+// for the instruction of `node` to use
+func (c *Compiler) compileValues(node ast.Node, values []ast.Expression) error {
+	if len(values) >= maxOperand {
+		return c.errorAt(node, ErrTooMany, "too many values, at most %d are allowed", maxOperand-1)
+	}
+
+	scope := c.scope()
+	defer func(pending int) { scope.pending = pending }(scope.pending)
+
+	for _, value := range values {
+		if err := c.compile(value); err != nil {
+			return err
+		}
+		scope.pending += 1
+	}
+
+	return nil
+}
+
+func (c *Compiler) compileLet(node *ast.LetStatement) error {
+	// Functions see themselves, so they can be recursive
+	if _, ok := node.Value.(*ast.FunctionLiteral); ok {
+		c.symbolTable.Define(node.Name.Value)
+	}
+
+	if err := c.compile(node.Value); err != nil {
+		return err
+	}
+
+	symbol := c.symbolTable.Define(node.Name.Value)
+	if symbol.Scope == LocalScope && symbol.Index >= maxLocals {
+		return c.errorAt(node.Name, ErrTooMany, "too many local variables, at most %d are allowed", maxLocals)
+	}
+
+	c.at(node.Pos())
+	c.setSymbol(symbol)
+	return nil
+}
+
+func (c *Compiler) compileAssignment(node *ast.Assignment) error {
+	if err := c.compile(node.Value); err != nil {
+		return err
+	}
+
+	// Functions assign their own variables, see compileFunctionBody
+	c.at(node.Pos())
+	switch symbol := c.resolve(node.Identifier.Value); symbol.Scope {
+	case LocalScope:
+		c.emit(code.OpAssignLocal, symbol.Index)
+	case GlobalScope:
+		c.emit(code.OpAssignGlobal, symbol.Index)
+	default:
+		// Builtins aren't variables, assigning them fails like assigning
+		// an undefined global
+		global := c.symbolTable.globals().Define(node.Identifier.Value)
+		c.emit(code.OpAssignGlobal, global.Index)
+	}
+
+	return nil
+}
+
+// compileReturn - compiles the value, then leaves the try blocks the return is
+// in, running their finally blocks
+func (c *Compiler) compileReturn(node *ast.ReturnStatement) error {
+	if err := c.compile(node.ReturnValue); err != nil {
+		return err
+	}
+
+	scope := c.scope()
+	scope.pending += 1
+	defer func() { scope.pending -= 1 }()
+
+	if err := c.unwind(0); err != nil {
+		return err
+	}
+
+	c.at(node.Pos())
+	c.emit(code.OpReturnValue)
+	return nil
+}
+
+// unwind - leaves the try blocks above the `depth` first controls, running
+// their finally blocks
+func (c *Compiler) unwind(depth int) error {
+	scope := c.scope()
+	controls := scope.controls
+	defer func() { scope.controls = controls }()
+
+	for i := len(controls) - 1; i >= depth; i-- {
+		ctl := controls[i]
+		if ctl.loop {
+			continue
+		}
+
+		if ctl.handler {
+			c.emit(code.OpEndTry)
+		}
+		if ctl.finally != nil {
+			// The finally block runs outside of its own try block
+			scope.controls = controls[:ctl.finallyDepth]
+			if err := c.compileStatements(ctl.finally.Statements, false); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// compileLoopControl - drops the values left on the stack in the loop, leaves
+// the try blocks the statement is in, then jumps to the end or the next
+// iteration of the loop
+func (c *Compiler) compileLoopControl(node ast.Statement, isBreak bool) error {
+	scope := c.scope()
+
+	index := len(scope.controls) - 1
+	for index >= 0 && !scope.controls[index].loop {
+		index -= 1
+	}
+	if index < 0 {
+		return c.errorAt(node, ErrOutsideLoop, "`%s` outside of a loop", node.TokenLiteral())
+	}
+	loop := scope.controls[index]
+
+	pending := loop.bodyPending
+	if isBreak {
+		pending = loop.pending
+	}
+
+	c.at(node.Pos())
+	for i := pending; i < scope.pending; i++ {
+		c.emit(code.OpPop)
+	}
+
+	defer func(pending int) { scope.pending = pending }(scope.pending)
+	scope.pending = pending
+
+	if err := c.unwind(index + 1); err != nil {
+		return err
+	}
+
+	if isBreak {
+		loop.breaks = append(loop.breaks, c.emit(code.OpJump, 0))
+	} else {
+		c.emit(code.OpJump, loop.continueAt)
+	}
+
+	return nil
+}
+
+func (c *Compiler) compileWhile(node *ast.WhileStatement) error {
+	scope := c.scope()
+	start := len(scope.instructions)
+
+	if err := c.compile(node.Condition); err != nil {
+		return err
+	}
+	c.at(node.Pos())
+	exit := c.emit(code.OpJumpNotTruthy, 0)
+
+	loop := &control{loop: true, pending: scope.pending, bodyPending: scope.pending, continueAt: start}
+	if err := c.compileLoopBody(loop, node.Body); err != nil {
+		return err
+	}
+
+	c.emit(code.OpJump, start)
+	c.patchJump(exit)
+	c.patchJumps(loop.breaks)
+	return nil
+}
+
+// compileFor - compiles the loop over an iterator kept on the stack, which
+// OpIterNext drops once exhausted
+func (c *Compiler) compileFor(node *ast.ForStatement) error {
+	scope := c.scope()
+
+	if err := c.compile(node.Iterable); err != nil {
+		return err
+	}
+
+	withKeys := 0
+	if node.Key != nil {
+		withKeys = 1
+	}
+	c.at(node.Pos())
+	c.emit(code.OpIter, withKeys)
+
+	start := len(scope.instructions)
+	exit := c.emit(code.OpIterNext, 0)
+
+	loop := &control{loop: true, pending: scope.pending, bodyPending: scope.pending + 1, continueAt: start}
+	scope.pending += 1
+	defer func() { scope.pending -= 1 }()
+
+	// OpIterNext pushes the key, then the value
+	if err := c.bindLoopVariable(node.Value); err != nil {
+		return err
+	}
+	if node.Key != nil {
+		if err := c.bindLoopVariable(node.Key); err != nil {
+			return err
+		}
+	} else {
+		c.emit(code.OpPop)
+	}
+
+	if err := c.compileLoopBody(loop, node.Body); err != nil {
+		return err
+	}
+
+	c.emit(code.OpJump, start)
+	c.patchJump(exit)
+	c.patchJumps(loop.breaks)
+	return nil
+}
+
+func (c *Compiler) bindLoopVariable(ident *ast.Identifier) error {
+	symbol := c.symbolTable.Define(ident.Value)
+	if symbol.Scope == LocalScope && symbol.Index >= maxLocals {
+		return c.errorAt(ident, ErrTooMany, "too many local variables, at most %d are allowed", maxLocals)
+	}
+
+	c.setSymbol(symbol)
+	return nil
+}
+
+func (c *Compiler) compileLoopBody(loop *control, body *ast.BlockStatement) error {
+	scope := c.scope()
+	scope.controls = append(scope.controls, loop)
+	defer func() { scope.controls = scope.controls[:len(scope.controls)-1] }()
+
+	return c.compileStatements(body.Statements, false)
+}
+
+func (c *Compiler) compileInfix(node *ast.InfixExpression) error {
+	operator := token.TokenType(node.Operator)
+
+	// The right side of `&&` and `||` runs only if the left side doesn't
+	// decide the result already. The deciding operand is the result.
+	if operator == token.AND || operator == token.OR {
+		if err := c.compile(node.Left); err != nil {
+			return err
+		}
+
+		c.at(node.Token.Pos)
+		c.emit(code.OpDup)
+		var end []int
+		if operator == token.AND {
+			end = append(end, c.emit(code.OpJumpNotTruthy, 0))
+		} else {
+			right := c.emit(code.OpJumpNotTruthy, 0)
+			end = append(end, c.emit(code.OpJump, 0))
+			c.patchJump(right)
+		}
+		c.emit(code.OpPop)
+
+		if err := c.compile(node.Right); err != nil {
+			return err
+		}
+		c.patchJumps(end)
+		return nil
+	}
+
+	op, ok := infixOps[operator]
+	if !ok {
+		return c.errorAt(node, ErrUnknownNode, "unknown operator: %s", node.Operator)
+	}
+
+	if err := c.compileValues(node, []ast.Expression{node.Left, node.Right}); err != nil {
+		return err
+	}
+	c.at(node.Token.Pos)
+	c.emit(op)
+	return nil
+}
+
+func (c *Compiler) compileIf(node *ast.IfExpression) error {
+	if err := c.compile(node.Condition); err != nil {
+		return err
+	}
+
+	c.at(node.Pos())
+	alternative := c.emit(code.OpJumpNotTruthy, 0)
+
+	if err := c.compileStatements(node.Consequence.Statements, true); err != nil {
+		return err
+	}
+	end := c.emit(code.OpJump, 0)
+
+	c.patchJump(alternative)
+	if node.Alternative != nil {
+		if err := c.compileStatements(node.Alternative.Statements, true); err != nil {
+			return err
+		}
+	} else {
+		c.emit(code.OpNull)
+	}
+
+	c.patchJump(end)
+	return nil
+}
+
+// compileTry - compiles the try block, the catch block the errors of the try
+// block jump to, and the finally block. The finally block is compiled twice:
+// once for when the blocks before succeed, once for when they fail, after
+// which the error is raised again.
+func (c *Compiler) compileTry(node *ast.TryExpression) error {
+	scope := c.scope()
+	ctl := &control{handler: true, finally: node.Finally, finallyDepth: len(scope.controls)}
+	scope.controls = append(scope.controls, ctl)
+	defer func() { scope.controls = scope.controls[:ctl.finallyDepth] }()
+
+	c.at(node.Pos())
+	handler := c.emit(code.OpTry, 0)
+	if err := c.compileStatements(node.Block.Statements, true); err != nil {
+		return err
+	}
+	c.emit(code.OpEndTry)
+	ctl.handler = false
+
+	if node.Catch != nil {
+		end := c.emit(code.OpJump, 0)
+		c.patchJump(handler)
+
+		if node.Finally != nil {
+			handler = c.emit(code.OpTry, 0)
+			ctl.handler = true
+		} else {
+			scope.controls = scope.controls[:ctl.finallyDepth]
+		}
+
+		// The exception is on the stack
+		symbol := c.symbolTable.Define(node.Param.Value)
+		if symbol.Scope == LocalScope && symbol.Index >= maxLocals {
+			return c.errorAt(node.Param, ErrTooMany, "too many local variables, at most %d are allowed", maxLocals)
+		}
+		c.setSymbol(symbol)
+
+		if err := c.compileStatements(node.Catch.Statements, true); err != nil {
+			return err
+		}
+
+		if node.Finally != nil {
+			c.emit(code.OpEndTry)
+			ctl.handler = false
+		}
+		c.patchJump(end)
+	}
+
+	if node.Finally == nil {
+		return nil
+	}
+	scope.controls = scope.controls[:ctl.finallyDepth]
+
+	// The result of the blocks, or the exception, stays on the stack while
+	// the finally block runs
+	scope.pending += 1
+	defer func() { scope.pending -= 1 }()
+
+	if err := c.compileStatements(node.Finally.Statements, false); err != nil {
+		return err
+	}
+	end := c.emit(code.OpJump, 0)
+
+	c.patchJump(handler)
+	if err := c.compileStatements(node.Finally.Statements, false); err != nil {
+		return err
+	}
+	c.emit(code.OpRethrow)
+
+	c.patchJump(end)
+	return nil
+}
+
+// compileFunction - compiles the function to a constant, pushed as a closure
+// over the locals of the functions it's nested in
+func (c *Compiler) compileFunction(node *ast.FunctionLiteral) error {
+	if len(node.Parameters) > maxLocals {
+		return c.errorAt(node, ErrTooMany, "too many parameters, at most %d are allowed", maxLocals)
+	}
+
+	if c.symbolTable.Outer != nil {
+		constant := c.addConstant(nil)
+		c.scope().nested = append(c.scope().nested, nested{node: node, constant: constant})
+		c.at(node.Pos())
+		c.emit(code.OpClosure, constant)
+		return nil
+	}
+
+	fn, err := c.compileFunctionBody(node)
+	if err != nil {
+		return err
+	}
+
+	c.at(node.Pos())
+	c.emit(code.OpClosure, c.addConstant(fn))
+	return nil
+}
+
+func (c *Compiler) compileFunctionBody(node *ast.FunctionLiteral) (*object.CompiledFunction, error) {
+	c.symbolTable = NewEnclosedSymbolTable(c.symbolTable)
+	c.scopes = append(c.scopes, &compilationScope{})
+	defer func() {
+		c.symbolTable = c.symbolTable.Outer
+		c.scopes = c.scopes[:len(c.scopes)-1]
+	}()
+
+	for _, param := range node.Parameters {
+		c.symbolTable.Define(param.Value)
+	}
+
+	// Assigning a variable from a function sets a variable of the function,
+	// which is the one of the same name outside of it until then. Variables
+	// outside of the function don't change while it runs, so calls start
+	// with a copy.
+	c.at(node.Pos())
+	for _, name := range ast.AssignedNames(node.Body) {
+		outer := c.resolve(name)
+		if outer.Scope == LocalScope {
+			continue
+		}
+
+		local := c.symbolTable.Define(name)
+		if local.Index >= maxLocals {
+			return nil, c.errorAt(node, ErrTooMany, "too many local variables, at most %d are allowed", maxLocals)
+		}
+		switch outer.Scope {
+		case GlobalScope:
+			c.emit(code.OpCopyGlobal, outer.Index, local.Index)
+		case FreeScope:
+			c.emit(code.OpCopyFree, outer.Depth, outer.Index, local.Index)
+		}
+	}
+
+	if err := c.compileStatements(node.Body.Statements, true); err != nil {
+		return nil, err
+	}
+	c.at(node.Body.RBrace.Pos)
+	c.emit(code.OpReturnValue)
+
+	fn := &object.CompiledFunction{
+		Instructions:  c.scope().instructions,
+		Positions:     c.scope().positions,
+		NumLocals:     c.symbolTable.NumDefinitions(),
+		NumParameters: len(node.Parameters),
+		Name:          node.Name,
+		LocalNames:    c.symbolTable.Names(),
+	}
+
+	for _, nested := range c.scope().nested {
+		compiled, err := c.compileFunctionBody(nested.node)
+		if err != nil {
+			return nil, err
+		}
+		c.constants[nested.constant] = compiled
+	}
+
+	return fn, nil
+}
+
+func (c *Compiler) compileCall(node *ast.CallExpression) error {
+	if node.Function.TokenLiteral() == evaluator.QUOTE_LITERAL {
+		return c.errorAt(node, ErrUnsupported, "`quote` is only supported by the evaluator")
+	}
+	if len(node.Arguments) >= maxLocals {
+		return c.errorAt(node, ErrTooMany, "too many arguments, at most %d are allowed", maxLocals-1)
+	}
+
+	values := append([]ast.Expression{node.Function}, node.Arguments...)
+	if err := c.compileValues(node, values); err != nil {
+		return err
+	}
+
+	c.at(node.Pos())
+	c.emit(code.OpCall, len(node.Arguments))
+	return nil
+}
+
+// resolve - finds the variable. Variables that aren't defined anywhere are
+// taken for globals, reading them fails until they are.
+func (c *Compiler) resolve(name string) Symbol {
+	if symbol, ok := c.symbolTable.Resolve(name); ok {
+		return symbol
+	}
+
+	return c.symbolTable.globals().Define(name)
+}
+
+func (c *Compiler) loadSymbol(symbol Symbol) {
+	switch symbol.Scope {
+	case GlobalScope:
+		c.emit(code.OpGetGlobal, symbol.Index)
+	case LocalScope:
+		c.emit(code.OpGetLocal, symbol.Index)
+	case FreeScope:
+		c.emit(code.OpGetFree, symbol.Depth, symbol.Index)
+	case BuiltinScope:
+		c.emit(code.OpGetBuiltin, symbol.Index)
+	}
+}
+
+func (c *Compiler) setSymbol(symbol Symbol) {
+	if symbol.Scope == GlobalScope {
+		c.emit(code.OpSetGlobal, symbol.Index)
+	} else {
+		c.emit(code.OpSetLocal, symbol.Index)
+	}
+}
+
+func (c *Compiler) addConstant(obj object.Object) int {
+	c.constants = append(c.constants, obj)
+	return len(c.constants) - 1
+}
+
+// addLiteral - adds the value of a literal to the constants, unless an equal
+// one is there already. Programs compiled one after the other, like in the
+// REPL, don't add the same literals again and again.
+func (c *Compiler) addLiteral(obj object.Object) int {
+	key, _ := literalOf(obj)
+	if index, ok := c.literals[key]; ok {
+		return index
+	}
+
+	index := c.addConstant(obj)
+	c.literals[key] = index
+	return index
+}
+
+// literalOf - the value of the constant, false if it isn't the value of a
+// literal
+func literalOf(obj object.Object) (literal, bool) {
+	switch obj := obj.(type) {
+	case *object.Integer:
+		return literal{obj.Type(), strconv.FormatInt(obj.Value, 10)}, true
+	case *object.BigInteger:
+		return literal{obj.Type(), obj.Value.String()}, true
+	case *object.Float:
+		return literal{obj.Type(), strconv.FormatUint(math.Float64bits(obj.Value), 16)}, true
+	case *object.String:
+		return literal{obj.Type(), obj.Value}, true
+	}
+	return literal{}, false
+}
+
+// at - sets the position of the instructions emitted next
+func (c *Compiler) at(pos token.Position) {
+	c.pos = pos
+}
+
+// emit - appends the instruction to the current scope, returning its offset
+func (c *Compiler) emit(op code.Opcode, operands ...int) int {
+	scope := c.scope()
+	offset := len(scope.instructions)
+
+	def, _ := code.Lookup(byte(op))
+	for i, operand := range operands {
+		if def.OperandWidths[i] == 2 {
+			c.checkOperand(op, operand, c.pos)
+		}
+	}
+
+	if n := len(scope.positions); c.pos.IsValid() && (n == 0 || scope.positions[n-1].Pos != c.pos) {
+		scope.positions = append(scope.positions, code.PosEntry{Offset: offset, Pos: c.pos})
+	}
+
+	scope.instructions = append(scope.instructions, code.Make(op, operands...)...)
+	return offset
+}
+
+// patchJump - makes the jump at the offset go to the end of the instructions
+func (c *Compiler) patchJump(offset int) {
+	ins := c.scope().instructions
+	op := code.Opcode(ins[offset])
+	c.checkOperand(op, len(ins), c.scope().positions.Lookup(offset))
+	copy(ins[offset:], code.Make(op, len(ins)))
+}
+
+func (c *Compiler) patchJumps(offsets []int) {
+	for _, offset := range offsets {
+		c.patchJump(offset)
+	}
+}
+
+// checkOperand - notes the first two bytes operand too large for its
+// instruction, compiled from `pos`. The truncated operand would have the VM
+// use another constant or variable, or jump elsewhere.
+func (c *Compiler) checkOperand(op code.Opcode, operand int, pos token.Position) {
+	if operand < maxOperand || c.overflow != nil {
+		return
+	}
+
+	message := fmt.Sprintf("too many values, at most %d are allowed", maxOperand-1)
+	switch op {
+	case code.OpConstant, code.OpClosure:
+		message = fmt.Sprintf("too many constants, at most %d are allowed", maxOperand)
+	case code.OpGetGlobal, code.OpSetGlobal, code.OpAssignGlobal, code.OpCopyGlobal:
+		message = fmt.Sprintf("too many global variables, at most %d are allowed", maxOperand)
+	case code.OpJump, code.OpJumpNotTruthy, code.OpTry, code.OpIterNext:
+		message = fmt.Sprintf("code too long, jumps can't go past %d bytes", maxOperand-1)
+	}
+
+	c.overflow = &diagnostic.Diagnostic{
+		Severity: diagnostic.Error,
+		Code:     ErrTooMany,
+		Message:  message,
+		Pos:      pos,
+		End:      pos,
+	}
+}
+
+func (c *Compiler) errorAt(node ast.Node, errCode diagnostic.Code, format string, a ...interface{}) *diagnostic.Diagnostic {
+	return &diagnostic.Diagnostic{
+		Severity: diagnostic.Error,
+		Code:     errCode,
+		Message:  fmt.Sprintf(format, a...),
+		Pos:      node.Pos(),
+		End:      node.End(),
+	}
+}
@@ -0,0 +1,497 @@
+package compiler
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"sudocoding.xyz/interpreter_in_go/src/code"
+	"sudocoding.xyz/interpreter_in_go/src/diagnostic"
+	"sudocoding.xyz/interpreter_in_go/src/evaluator"
+	"sudocoding.xyz/interpreter_in_go/src/lexer"
+	"sudocoding.xyz/interpreter_in_go/src/object"
+	"sudocoding.xyz/interpreter_in_go/src/parser"
+	"sudocoding.xyz/interpreter_in_go/src/parser/ast"
+)
+
+func eq[T comparable](t *testing.T, expected T, actual T, msg ...string) {
+	if expected != actual {
+		t.Fatalf("%s\nexpected: %+v\nactual: %+v\n", strings.Join(msg, " "), expected, actual)
+	}
+}
+
+func notEq[T comparable](t *testing.T, expected T, actual T, msg ...string) {
+	if expected == actual {
+		t.Fatalf("%s\nexpected not: %+v\nactual: %+v\n", strings.Join(msg, " "), expected, actual)
+	}
+}
+
+func parse(t *testing.T, input string) *ast.Program {
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	eq(t, 0, len(p.Errors()), "parser errors")
+	return program
+}
+
+func concat(instructions ...[]byte) string {
+	out := code.Instructions{}
+	for _, ins := range instructions {
+		out = append(out, ins...)
+	}
+	return out.String()
+}
+
+func builtinIndex(name string) int {
+	for i, builtin := range evaluator.BuiltinNames() {
+		if builtin == name {
+			return i
+		}
+	}
+	return -1
+}
+
+func Test_Make(t *testing.T) {
+	tests := []struct {
+		op       code.Opcode
+		operands []int
+		expected []byte
+	}{
+		{code.OpConstant, []int{65534}, []byte{byte(code.OpConstant), 255, 254}},
+		{code.OpAdd, []int{}, []byte{byte(code.OpAdd)}},
+		{code.OpGetLocal, []int{255}, []byte{byte(code.OpGetLocal), 255}},
+		{code.OpGetFree, []int{2, 7}, []byte{byte(code.OpGetFree), 2, 7}},
+	}
+
+	for _, test := range tests {
+		instruction := code.Make(test.op, test.operands...)
+		eq(t, string(test.expected), string(instruction))
+
+		def, err := code.Lookup(byte(test.op))
+		eq(t, nil, err)
+		operands, read := code.ReadOperands(def, instruction[1:])
+		eq(t, len(instruction)-1, read)
+		for i, operand := range test.operands {
+			eq(t, operand, operands[i])
+		}
+	}
+}
+
+func Test_Compile(t *testing.T) {
+	tests := []struct {
+		input     string
+		constants []string
+		expected  string
+	}{
+		{
+			"1 + 2",
+			[]string{"1", "2"},
+			concat(
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpAdd),
+				code.Make(code.OpReturnValue),
+			),
+		},
+		{
+			"1; 2",
+			[]string{"1", "2"},
+			concat(
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpPop),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpReturnValue),
+			),
+		},
+		{
+			"let x = 1; x",
+			[]string{"1"},
+			concat(
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpReturnValue),
+			),
+		},
+		{
+			"if (true) { 10 }",
+			[]string{"10"},
+			concat(
+				code.Make(code.OpTrue),
+				code.Make(code.OpJumpNotTruthy, 10),
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpJump, 11),
+				code.Make(code.OpNull),
+				code.Make(code.OpReturnValue),
+			),
+		},
+		{
+			"a && b",
+			[]string{},
+			concat(
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpDup),
+				code.Make(code.OpJumpNotTruthy, 11),
+				code.Make(code.OpPop),
+				code.Make(code.OpGetGlobal, 1),
+				code.Make(code.OpReturnValue),
+			),
+		},
+		{
+			`{"b": 2, "a": 1}`,
+			[]string{"b", "2", "a", "1"},
+			concat(
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpConstant, 3),
+				code.Make(code.OpHash, 4),
+				code.Make(code.OpReturnValue),
+			),
+		},
+		{
+			"len([])",
+			[]string{},
+			concat(
+				code.Make(code.OpGetBuiltin, builtinIndex("len")),
+				code.Make(code.OpArray, 0),
+				code.Make(code.OpCall, 1),
+				code.Make(code.OpReturnValue),
+			),
+		},
+		{
+			"fn(a) { fn() { a } }",
+			[]string{"fn() { <compiled> }", "fn(a) { <compiled> }"},
+			concat(
+				code.Make(code.OpClosure, 1),
+				code.Make(code.OpReturnValue),
+			),
+		},
+		{
+			"while (x) { break }",
+			[]string{},
+			concat(
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpJumpNotTruthy, 12),
+				code.Make(code.OpJump, 12),
+				code.Make(code.OpJump, 0),
+				code.Make(code.OpNull),
+				code.Make(code.OpReturnValue),
+			),
+		},
+		{
+			`1; "a"; 1; "a"`,
+			[]string{"1", "a"},
+			concat(
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpPop),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpPop),
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpPop),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpReturnValue),
+			),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.input, func(t *testing.T) {
+			c := New()
+			eq(t, nil, c.Compile(parse(t, test.input)))
+
+			bytecode := c.Bytecode()
+			eq(t, test.expected, bytecode.Instructions.String())
+			eq(t, len(test.constants), len(bytecode.Constants), "constants")
+			for i, constant := range test.constants {
+				eq(t, constant, bytecode.Constants[i].Inspect())
+			}
+		})
+	}
+}
+
+func Test_CompileFunctions(t *testing.T) {
+	c := New()
+	eq(t, nil, c.Compile(parse(t, "let f = fn(a) { let b = a; fn() { a + b } }")))
+
+	constants := c.Bytecode().Constants
+	eq(t, 2, len(constants))
+
+	inner := constants[0].(*object.CompiledFunction)
+	eq(t, concat(
+		code.Make(code.OpGetFree, 1, 0),
+		code.Make(code.OpGetFree, 1, 1),
+		code.Make(code.OpAdd),
+		code.Make(code.OpReturnValue),
+	), inner.Instructions.String())
+
+	outer := constants[1].(*object.CompiledFunction)
+	eq(t, "f", outer.Name)
+	eq(t, 2, outer.NumLocals)
+	eq(t, 1, outer.NumParameters)
+	eq(t, concat(
+		code.Make(code.OpGetLocal, 0),
+		code.Make(code.OpSetLocal, 1),
+		code.Make(code.OpClosure, 0),
+		code.Make(code.OpReturnValue),
+	), outer.Instructions.String())
+}
+
+func Test_Positions(t *testing.T) {
+	c := New()
+	eq(t, nil, c.Compile(parse(t, "let x = 1;\nx + 2")))
+
+	bytecode := c.Bytecode()
+	eq(t, "1:9", bytecode.Positions.Lookup(0).String())
+	// The OpAdd, after `x` and `2`
+	eq(t, "2:3", bytecode.Positions.Lookup(12).String())
+}
+
+func Test_SymbolTable(t *testing.T) {
+	global := NewSymbolTable()
+	a := global.Define("a")
+	eq(t, Symbol{Name: "a", Scope: GlobalScope, Index: 0}, a)
+	eq(t, a, global.Define("a"), "defining again keeps the slot")
+
+	local := NewEnclosedSymbolTable(global)
+	b := local.Define("b")
+	eq(t, Symbol{Name: "b", Scope: LocalScope, Index: 0}, b)
+
+	nested := NewEnclosedSymbolTable(NewEnclosedSymbolTable(local))
+	resolved, ok := nested.Resolve("b")
+	eq(t, true, ok)
+	eq(t, Symbol{Name: "b", Scope: FreeScope, Index: 0, Depth: 2}, resolved)
+
+	resolved, ok = nested.Resolve("a")
+	eq(t, true, ok)
+	eq(t, a, resolved)
+
+	resolved, ok = nested.Resolve("len")
+	eq(t, true, ok)
+	eq(t, BuiltinScope, resolved.Scope)
+
+	_, ok = nested.Resolve("nope")
+	eq(t, false, ok)
+}
+
+func Test_CompileErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		code     diagnostic.Code
+		expected string
+	}{
+		{"quote(1 + 2)", ErrUnsupported, "1:1: error[C0001]: `quote` is only supported by the evaluator"},
+		{"let f = fn() { quote(1) }", ErrUnsupported, "1:16: error[C0001]: `quote` is only supported by the evaluator"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.input, func(t *testing.T) {
+			err := New().Compile(parse(t, test.input))
+			notEq(t, nil, err)
+
+			diag, ok := err.(*diagnostic.Diagnostic)
+			eq(t, true, ok)
+			eq(t, test.code, diag.Code)
+			eq(t, test.expected, diag.Error())
+		})
+	}
+
+	// Constant indexes and jump targets are two bytes operands
+	var literals strings.Builder
+	for i := 0; i < 65536; i++ {
+		fmt.Fprintf(&literals, "%d; ", i)
+	}
+
+	tooLong := []struct {
+		input    string
+		expected string
+	}{
+		{literals.String() + "12345678", "1:447643: error[C0002]: too many constants, at most 65536 are allowed"},
+		{"if (true) {" + strings.Repeat(" x;", 20000) + " }", "1:1: error[C0002]: code too long, jumps can't go past 65535 bytes"},
+		{"while (x) {" + strings.Repeat(" x;", 20000) + " }", "1:1: error[C0002]: code too long, jumps can't go past 65535 bytes"},
+	}
+
+	for _, test := range tooLong {
+		t.Run(test.expected, func(t *testing.T) {
+			err := New().Compile(parse(t, test.input))
+			notEq(t, nil, err)
+
+			diag, ok := err.(*diagnostic.Diagnostic)
+			eq(t, true, ok)
+			eq(t, ErrTooMany, diag.Code)
+			eq(t, test.expected, diag.Error())
+		})
+	}
+
+	// Nodes built by hand can hold `break` outside of a loop
+	program := &ast.Program{Statements: []ast.Statement{&ast.BreakStatement{}}}
+	diag, ok := New().Compile(program).(*diagnostic.Diagnostic)
+	eq(t, true, ok)
+	eq(t, ErrOutsideLoop, diag.Code)
+}
+
+func Test_Disassemble(t *testing.T) {
+	input := `let name = "x";
+let f = fn(a) {
+  fn() { a + len(name) }
+};`
+
+	c := New()
+	eq(t, nil, c.Compile(parse(t, input)))
+
+	var out strings.Builder
+	Disassemble(&out, c.Bytecode(), input)
+
+	expected := `== <main> ==
+   1 | let name = "x";
+0000 OpConstant 0             ; "x"
+0003 OpSetGlobal 0            ; name
+   2 | let f = fn(a) {
+0006 OpClosure 2              ; fn f(a)
+0009 OpSetGlobal 1            ; f
+0012 OpNull
+0013 OpReturnValue
+
+== fn f(a) ==
+   3 |   fn() { a + len(name) }
+0000 OpClosure 1              ; fn <anonymous>()
+   4 | };
+0003 OpReturnValue
+
+== fn <anonymous>() ==
+   3 |   fn() { a + len(name) }
+0000 OpGetFree 1 0            ; a
+0003 ` + fmt.Sprintf("%-24s", fmt.Sprint("OpGetBuiltin ", builtinIndex("len"))) + ` ; len
+0005 OpGetGlobal 0            ; name
+0008 OpCall 1
+0010 OpAdd
+0011 OpReturnValue
+`
+	eq(t, expected, out.String())
+}
+
+func Test_EncodeDecode(t *testing.T) {
+	input := `let name = "x" + 1.5;
+let f = fn(a) {
+  fn() { a + len(name) + 99999999999999999999 }
+};`
+
+	c := New()
+	eq(t, nil, c.Compile(parse(t, input)))
+	bytecode := c.Bytecode()
+
+	var file bytes.Buffer
+	eq(t, nil, Encode(&file, bytecode))
+	decoded, err := Decode(bytes.NewReader(file.Bytes()))
+	eq(t, nil, err)
+
+	var expected, actual strings.Builder
+	Disassemble(&expected, bytecode, input)
+	Disassemble(&actual, decoded, input)
+	eq(t, expected.String(), actual.String())
+	eq(t, strings.Join(bytecode.Globals, ","), strings.Join(decoded.Globals, ","))
+	eq(t, bytecode.Positions.Lookup(6), decoded.Positions.Lookup(6))
+}
+
+func Test_DecodeErrors(t *testing.T) {
+	c := New()
+	eq(t, nil, c.Compile(parse(t, "let f = fn(a) { if (a) { a } else { 1 } }; f(2)")))
+
+	var file bytes.Buffer
+	eq(t, nil, Encode(&file, c.Bytecode()))
+	valid := file.Bytes()
+
+	// Replaces the last byte of the instructions of the function, its
+	// OpReturnValue
+	corrupt := func(last []byte) []byte {
+		fn := c.Bytecode().Constants[1].(*object.CompiledFunction)
+		patched := *fn
+		patched.Instructions = append(append(code.Instructions{}, fn.Instructions[:len(fn.Instructions)-1]...), last...)
+
+		bytecode := *c.Bytecode()
+		bytecode.Constants = append([]object.Object{}, bytecode.Constants...)
+		bytecode.Constants[1] = &patched
+
+		var out bytes.Buffer
+		eq(t, nil, Encode(&out, &bytecode))
+		return out.Bytes()
+	}
+
+	// A program of the instructions only
+	program := func(instructions ...[]byte) []byte {
+		var out bytes.Buffer
+		eq(t, nil, Encode(&out, &Bytecode{Instructions: bytes.Join(instructions, nil)}))
+		return out.Bytes()
+	}
+
+	tests := []struct {
+		name     string
+		data     []byte
+		expected error
+		msg      string
+	}{
+		{"empty", []byte{}, ErrNotCompiled, "not a compiled Monkie file"},
+		{"source", []byte("let x = 1;"), ErrNotCompiled, "not a compiled Monkie file"},
+		{"version", append([]byte(magic), 99), ErrVersion, "incompatible compiled file: format version 99, expected 2"},
+		{"truncated", valid[:len(valid)-3], ErrCorrupt, ""},
+		{"trailing", append(append([]byte{}, valid...), 0), ErrCorrupt, "corrupt compiled file: 1 bytes after the program"},
+		{"opcode", corrupt([]byte{255}), ErrCorrupt, ""},
+		{"constant", corrupt(code.Make(code.OpConstant, 7)), ErrCorrupt, "corrupt compiled file: fn f(a) at 0013: constant 7 out of 3"},
+		{"local", corrupt(code.Make(code.OpGetLocal, 1)), ErrCorrupt, "corrupt compiled file: fn f(a) at 0013: local 1 out of 1"},
+		{"free", corrupt(code.Make(code.OpGetFree, 1, 0)), ErrCorrupt, "corrupt compiled file: fn f(a) at 0013: no function 1 levels out"},
+		{"jump", corrupt(code.Make(code.OpJump, 1)), ErrCorrupt, "corrupt compiled file: fn f(a) at 0013: jump to 0001, not an instruction"},
+		{"past end", corrupt(code.Make(code.OpPop)), ErrCorrupt, "corrupt compiled file: fn f(a) at 0013: runs past the end of the function"},
+		{"end try", program(code.Make(code.OpEndTry)), ErrCorrupt, "corrupt compiled file: <main> at 0000: OpEndTry without an OpTry"},
+		{"pop", program(code.Make(code.OpPop)), ErrCorrupt, "corrupt compiled file: <main> at 0000: OpPop pops more values than the stack has"},
+		{"iter next", program(code.Make(code.OpIterNext, 0)), ErrCorrupt, "corrupt compiled file: <main> at 0000: OpIterNext pops more values than the stack has"},
+		{"iter next value", program(code.Make(code.OpNull), code.Make(code.OpIterNext, 0)), ErrCorrupt, "corrupt compiled file: <main> at 0001: OpIterNext can't use the value on the stack"},
+		{"rethrow", program(code.Make(code.OpTrue), code.Make(code.OpRethrow)), ErrCorrupt, "corrupt compiled file: <main> at 0001: OpRethrow can't use the value on the stack"},
+		{"iterator", program(code.Make(code.OpNull), code.Make(code.OpIter, 0), code.Make(code.OpReturnValue)), ErrCorrupt, "corrupt compiled file: <main> at 0003: OpReturnValue can't use the iterator on the stack"},
+		{"try return", program(code.Make(code.OpTry, 5), code.Make(code.OpNull), code.Make(code.OpReturnValue), code.Make(code.OpReturnValue)), ErrCorrupt, "corrupt compiled file: <main> at 0004: returns in a try block"},
+		{"merge", program(code.Make(code.OpTrue), code.Make(code.OpJumpNotTruthy, 5), code.Make(code.OpNull), code.Make(code.OpNull), code.Make(code.OpReturnValue)), ErrCorrupt, "corrupt compiled file: <main> at 0004: gets to 0005 with another stack than before"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := Decode(bytes.NewReader(test.data))
+			notEq(t, nil, err)
+			eq(t, true, errors.Is(err, test.expected), err.Error())
+			if test.msg != "" {
+				eq(t, test.msg, err.Error())
+			}
+		})
+	}
+}
+
+func Test_Link(t *testing.T) {
+	c := New()
+	eq(t, nil, c.Compile(parse(t, "let b = 1; let f = fn() { b = b + 1; b }")))
+	bytecode := c.Bytecode()
+
+	symbols := NewSymbolTable()
+	symbols.Define("a")
+	symbols.Define("f")
+	eq(t, nil, Link(bytecode, symbols, []object.Object{&object.String{Value: "before"}}))
+
+	eq(t, "a,f,b", strings.Join(bytecode.Globals, ","))
+	eq(t, 3, len(bytecode.Constants))
+	eq(t, "before", bytecode.Constants[0].Inspect())
+	eq(t, concat(
+		code.Make(code.OpConstant, 1),
+		code.Make(code.OpSetGlobal, 2),
+		code.Make(code.OpClosure, 2),
+		code.Make(code.OpSetGlobal, 1),
+		code.Make(code.OpNull),
+		code.Make(code.OpReturnValue),
+	), bytecode.Instructions.String())
+	eq(t, concat(
+		code.Make(code.OpCopyGlobal, 2, 0),
+		code.Make(code.OpGetLocal, 0),
+		code.Make(code.OpConstant, 1),
+		code.Make(code.OpAdd),
+		code.Make(code.OpAssignLocal, 0),
+		code.Make(code.OpGetLocal, 0),
+		code.Make(code.OpReturnValue),
+	), bytecode.Constants[2].(*object.CompiledFunction).Instructions.String())
+}
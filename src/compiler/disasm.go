@@ -0,0 +1,144 @@
+package compiler
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"sudocoding.xyz/interpreter_in_go/src/code"
+	"sudocoding.xyz/interpreter_in_go/src/evaluator"
+	"sudocoding.xyz/interpreter_in_go/src/object"
+)
+
+// Disassemble - writes the instructions of the program, then the ones of the
+// functions it creates, one per line with its offset and operands. Operands
+// referring to constants, variables or builtins are followed by what they
+// refer to. Each source line, taken from `src`, comes before the instructions
+// compiled from it; `src` may be empty.
+func Disassemble(out io.Writer, bytecode *Bytecode, src string) {
+	d := &disassembler{
+		out:      out,
+		bytecode: bytecode,
+		lines:    strings.Split(src, "\n"),
+		builtins: evaluator.BuiltinNames(),
+		outers:   map[int][]*object.CompiledFunction{},
+	}
+
+	main := &object.CompiledFunction{Instructions: bytecode.Instructions, Positions: bytecode.Positions, Name: "<main>"}
+	d.function(main, nil)
+
+	// Functions in the order of their constants, once the functions creating
+	// them tell what they are nested in
+	for i := 0; i < len(d.queue); i++ {
+		index := d.queue[i]
+		fn := d.bytecode.Constants[index].(*object.CompiledFunction)
+
+		fmt.Fprintln(d.out)
+		d.function(fn, d.outers[index])
+	}
+}
+
+type disassembler struct {
+	out      io.Writer
+	bytecode *Bytecode
+	lines    []string
+	builtins []string
+
+	queue  []int                              // Constants of the functions to write, in order
+	outers map[int][]*object.CompiledFunction // Functions each queued one is nested in, innermost last
+}
+
+// function - writes the instructions of the function nested in `outers`
+func (d *disassembler) function(fn *object.CompiledFunction, outers []*object.CompiledFunction) {
+	if fn.Name == "<main>" {
+		fmt.Fprintln(d.out, "== <main> ==")
+	} else {
+		fmt.Fprintf(d.out, "== %s ==\n", describeFunction(fn))
+	}
+
+	line := -1
+	ins := fn.Instructions
+	for offset := 0; offset < len(ins); {
+		def, err := code.Lookup(ins[offset])
+		if err != nil {
+			fmt.Fprintf(d.out, "%04d ERROR: %s\n", offset, err)
+			offset += 1
+			continue
+		}
+
+		if pos := fn.Positions.Lookup(offset); pos.IsValid() && pos.Line != line {
+			line = pos.Line
+			if line <= len(d.lines) && strings.TrimSpace(d.lines[line-1]) != "" {
+				fmt.Fprintf(d.out, "%4d | %s\n", line, strings.TrimRight(d.lines[line-1], "\r"))
+			}
+		}
+
+		operands, read := code.ReadOperands(def, ins[offset+1:])
+		instruction := code.FormatInstruction(def, operands)
+		if comment := d.comment(code.Opcode(ins[offset]), operands, fn, outers); comment != "" {
+			fmt.Fprintf(d.out, "%04d %-24s ; %s\n", offset, instruction, comment)
+		} else {
+			fmt.Fprintf(d.out, "%04d %s\n", offset, instruction)
+		}
+
+		offset += 1 + read
+	}
+}
+
+// comment - what the operands of the instruction refer to, if anything
+func (d *disassembler) comment(op code.Opcode, operands []int, fn *object.CompiledFunction, outers []*object.CompiledFunction) string {
+	switch op {
+	case code.OpConstant:
+		return describeConstant(d.bytecode.Constants[operands[0]])
+	case code.OpClosure:
+		index := operands[0]
+		if _, queued := d.outers[index]; !queued {
+			d.queue = append(d.queue, index)
+			d.outers[index] = append(append([]*object.CompiledFunction{}, outers...), fn)
+		}
+		return describeFunction(d.bytecode.Constants[index].(*object.CompiledFunction))
+	case code.OpGetGlobal, code.OpSetGlobal, code.OpAssignGlobal, code.OpCopyGlobal:
+		return nameAt(d.bytecode.Globals, operands[0])
+	case code.OpGetLocal, code.OpSetLocal, code.OpAssignLocal:
+		return nameAt(fn.LocalNames, operands[0])
+	case code.OpGetFree, code.OpCopyFree:
+		depth := operands[0]
+		if depth > len(outers) {
+			return "?"
+		}
+		return nameAt(outers[len(outers)-depth].LocalNames, operands[1])
+	case code.OpGetBuiltin:
+		return nameAt(d.builtins, operands[0])
+	case code.OpIter:
+		if operands[0] == 1 {
+			return "keys and values"
+		}
+		return "values"
+	}
+
+	return ""
+}
+
+func nameAt(names []string, index int) string {
+	if index < len(names) {
+		return names[index]
+	}
+	return "?"
+}
+
+func describeConstant(obj object.Object) string {
+	if str, ok := obj.(*object.String); ok {
+		return strconv.Quote(str.Value)
+	}
+	return obj.Inspect()
+}
+
+// describeFunction - the name and parameters of the function
+func describeFunction(fn *object.CompiledFunction) string {
+	name := fn.Name
+	if name == "" {
+		name = "<anonymous>"
+	}
+	return fmt.Sprintf("fn %s(%s)", name, strings.Join(fn.LocalNames[:fn.NumParameters], ", "))
+}
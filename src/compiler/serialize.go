@@ -0,0 +1,659 @@
+package compiler
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/big"
+	"strings"
+
+	"sudocoding.xyz/interpreter_in_go/src/code"
+	"sudocoding.xyz/interpreter_in_go/src/evaluator"
+	"sudocoding.xyz/interpreter_in_go/src/object"
+	"sudocoding.xyz/interpreter_in_go/src/token"
+)
+
+// FormatVersion - version of the format of compiled files. It changes
+// whenever the layout of the files or the meaning of the bytecode does, files
+// of other versions are refused.
+const FormatVersion = 2
+
+// magic - the first bytes of compiled files
+const magic = "MONKIEC\x00"
+
+var (
+	ErrNotCompiled = errors.New("not a compiled Monkie file")
+	ErrVersion     = errors.New("incompatible compiled file")
+	ErrCorrupt     = errors.New("corrupt compiled file")
+)
+
+// Tags of the constants in compiled files
+const (
+	tagInteger byte = iota + 1
+	tagBigInteger
+	tagFloat
+	tagString
+	tagFunction
+)
+
+/*
+ Layout of compiled files. Numbers are varints, strings and byte slices are
+ prefixed with their length, lists with their number of elements.
+
+   magic, version
+   builtins   names of the builtins by the index the program uses
+   globals    names of the globals by index
+   constants  each a tag followed by its value; functions have their name,
+              numbers of locals and parameters, local names, instructions
+              and line table
+   main       instructions and line table of the program itself
+
+ A line table is a list of (offset, file, byte offset, line, column).
+*/
+
+// Encode - writes the program in the format of compiled files
+func Encode(w io.Writer, bytecode *Bytecode) error {
+	e := &encoder{buf: []byte(magic)}
+	e.uint(FormatVersion)
+	e.strings(evaluator.BuiltinNames())
+	e.strings(bytecode.Globals)
+
+	e.uint(len(bytecode.Constants))
+	for _, constant := range bytecode.Constants {
+		if err := e.constant(constant); err != nil {
+			return err
+		}
+	}
+
+	e.bytes(bytecode.Instructions)
+	e.positions(bytecode.Positions)
+
+	_, err := w.Write(e.buf)
+	return err
+}
+
+// Decode - reads a program written by Encode. The program is checked before
+// it's returned: its instructions only refer to constants, variables and
+// builtins that exist and only jump within their function.
+func Decode(r io.Reader) (*Bytecode, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if !bytes.HasPrefix(data, []byte(magic)) {
+		return nil, ErrNotCompiled
+	}
+
+	d := &decoder{data: data[len(magic):]}
+	if version := d.uint(); d.err == nil && version != FormatVersion {
+		return nil, fmt.Errorf("%w: format version %d, expected %d", ErrVersion, version, FormatVersion)
+	}
+
+	builtins := d.strings()
+	bytecode := &Bytecode{Globals: d.strings()}
+
+	for n := d.count(); n > 0 && d.err == nil; n-- {
+		bytecode.Constants = append(bytecode.Constants, d.constant())
+	}
+
+	bytecode.Instructions = d.bytes()
+	bytecode.Positions = d.positions()
+
+	if d.err == nil && len(d.data) > 0 {
+		d.fail("%d bytes after the program", len(d.data))
+	}
+	if d.err != nil {
+		return nil, d.err
+	}
+
+	if err := verify(bytecode, builtins); err != nil {
+		return nil, err
+	}
+	return bytecode, nil
+}
+
+type encoder struct {
+	buf []byte
+}
+
+func (e *encoder) uint(value int) {
+	e.buf = binary.AppendUvarint(e.buf, uint64(value))
+}
+
+func (e *encoder) bytes(value []byte) {
+	e.uint(len(value))
+	e.buf = append(e.buf, value...)
+}
+
+func (e *encoder) string(value string) {
+	e.bytes([]byte(value))
+}
+
+func (e *encoder) strings(values []string) {
+	e.uint(len(values))
+	for _, value := range values {
+		e.string(value)
+	}
+}
+
+func (e *encoder) positions(table code.PosTable) {
+	e.uint(len(table))
+	for _, entry := range table {
+		e.uint(entry.Offset)
+		e.string(entry.Pos.Filename)
+		e.uint(entry.Pos.Offset)
+		e.uint(entry.Pos.Line)
+		e.uint(entry.Pos.Column)
+	}
+}
+
+func (e *encoder) constant(obj object.Object) error {
+	switch obj := obj.(type) {
+	case *object.Integer:
+		e.buf = append(e.buf, tagInteger)
+		e.buf = binary.AppendVarint(e.buf, obj.Value)
+	case *object.BigInteger:
+		e.buf = append(e.buf, tagBigInteger)
+		e.string(obj.Value.String())
+	case *object.Float:
+		e.buf = append(e.buf, tagFloat)
+		e.buf = binary.BigEndian.AppendUint64(e.buf, math.Float64bits(obj.Value))
+	case *object.String:
+		e.buf = append(e.buf, tagString)
+		e.string(obj.Value)
+	case *object.CompiledFunction:
+		e.buf = append(e.buf, tagFunction)
+		e.string(obj.Name)
+		e.uint(obj.NumLocals)
+		e.uint(obj.NumParameters)
+		e.strings(obj.LocalNames)
+		e.bytes(obj.Instructions)
+		e.positions(obj.Positions)
+	default:
+		return fmt.Errorf("cannot encode constant of type %s", obj.Type())
+	}
+
+	return nil
+}
+
+// decoder - reads the parts of a compiled file. The first failure is kept
+// and makes the following reads return zero values.
+type decoder struct {
+	data []byte
+	err  error
+}
+
+func (d *decoder) fail(format string, a ...interface{}) {
+	if d.err == nil {
+		d.err = fmt.Errorf("%w: %s", ErrCorrupt, fmt.Sprintf(format, a...))
+	}
+}
+
+func (d *decoder) uint() int {
+	if d.err != nil {
+		return 0
+	}
+
+	value, n := binary.Uvarint(d.data)
+	if n <= 0 || value > math.MaxInt32 {
+		d.fail("invalid number")
+		return 0
+	}
+
+	d.data = d.data[n:]
+	return int(value)
+}
+
+// count - the length of a list, each element taking one byte at least
+func (d *decoder) count() int {
+	n := d.uint()
+	if n > len(d.data) {
+		d.fail("list of %d elements in %d bytes", n, len(d.data))
+		return 0
+	}
+	return n
+}
+
+func (d *decoder) bytes() []byte {
+	n := d.count()
+	if d.err != nil {
+		return nil
+	}
+
+	value := append([]byte{}, d.data[:n]...)
+	d.data = d.data[n:]
+	return value
+}
+
+func (d *decoder) string() string {
+	return string(d.bytes())
+}
+
+func (d *decoder) strings() []string {
+	values := []string{}
+	for n := d.count(); n > 0 && d.err == nil; n-- {
+		values = append(values, d.string())
+	}
+	return values
+}
+
+func (d *decoder) positions() code.PosTable {
+	table := code.PosTable{}
+	for n := d.count(); n > 0 && d.err == nil; n-- {
+		entry := code.PosEntry{Offset: d.uint()}
+		entry.Pos = token.Position{Filename: d.string(), Offset: d.uint(), Line: d.uint(), Column: d.uint()}
+		table = append(table, entry)
+	}
+	return table
+}
+
+func (d *decoder) constant() object.Object {
+	if d.err != nil {
+		return nil
+	}
+	if len(d.data) == 0 {
+		d.fail("missing constant")
+		return nil
+	}
+
+	tag := d.data[0]
+	d.data = d.data[1:]
+
+	switch tag {
+	case tagInteger:
+		value, n := binary.Varint(d.data)
+		if n <= 0 {
+			d.fail("invalid integer")
+			return nil
+		}
+		d.data = d.data[n:]
+		return &object.Integer{Value: value}
+	case tagBigInteger:
+		value, ok := new(big.Int).SetString(d.string(), 10)
+		if !ok {
+			d.fail("invalid big integer")
+			return nil
+		}
+		return &object.BigInteger{Value: value}
+	case tagFloat:
+		if len(d.data) < 8 {
+			d.fail("invalid float")
+			return nil
+		}
+		value := math.Float64frombits(binary.BigEndian.Uint64(d.data))
+		d.data = d.data[8:]
+		return &object.Float{Value: value}
+	case tagString:
+		return &object.String{Value: d.string()}
+	case tagFunction:
+		return &object.CompiledFunction{
+			Name:          d.string(),
+			NumLocals:     d.uint(),
+			NumParameters: d.uint(),
+			LocalNames:    d.strings(),
+			Instructions:  d.bytes(),
+			Positions:     d.positions(),
+		}
+	}
+
+	d.fail("unknown constant tag %d", tag)
+	return nil
+}
+
+// verify - checks that the instructions of the program only refer to what
+// exists, and points its builtins at the ones of this version of Monkie,
+// `builtins` being the names of the ones the program was compiled against
+func verify(bytecode *Bytecode, builtins []string) error {
+	v := &verifier{bytecode: bytecode, nesting: map[int]int{}}
+
+	current := map[string]int{}
+	for i, name := range evaluator.BuiltinNames() {
+		current[name] = i
+	}
+	for _, name := range builtins {
+		index, ok := current[name]
+		if !ok {
+			return fmt.Errorf("%w: unknown builtin `%s`", ErrVersion, name)
+		}
+		v.builtins = append(v.builtins, index)
+	}
+
+	main := &object.CompiledFunction{Instructions: bytecode.Instructions, Name: "<main>"}
+	return v.function(main, nil)
+}
+
+type verifier struct {
+	bytecode *Bytecode
+	builtins []int       // Indexes of the builtins of the program among the current ones
+	nesting  map[int]int // Number of functions each verified function constant is nested in
+}
+
+// function - verifies the function nested in `outers`, then the functions it
+// creates
+func (v *verifier) function(fn *object.CompiledFunction, outers []*object.CompiledFunction) error {
+	fail := func(offset int, format string, a ...interface{}) error {
+		return fmt.Errorf("%w: %s at %04d: %s", ErrCorrupt, describeFunction(fn), offset, fmt.Sprintf(format, a...))
+	}
+
+	if fn.Name == "<main>" {
+		fail = func(offset int, format string, a ...interface{}) error {
+			return fmt.Errorf("%w: <main> at %04d: %s", ErrCorrupt, offset, fmt.Sprintf(format, a...))
+		}
+	} else if fn.NumLocals != len(fn.LocalNames) || fn.NumParameters > fn.NumLocals || fn.NumLocals > maxLocals {
+		return fail(0, "invalid locals")
+	}
+
+	ins := fn.Instructions
+	starts := map[int]bool{len(ins): true}
+	jumps := map[int]int{}
+
+	for offset := 0; offset < len(ins); {
+		starts[offset] = true
+
+		def, err := code.Lookup(ins[offset])
+		if err != nil {
+			return fail(offset, "%s", err)
+		}
+
+		width := 0
+		for _, w := range def.OperandWidths {
+			width += w
+		}
+		if offset+1+width > len(ins) {
+			return fail(offset, "truncated %s", def.Name)
+		}
+		operands, _ := code.ReadOperands(def, ins[offset+1:])
+
+		inRange := func(index, size int, what string) error {
+			if index >= size {
+				return fail(offset, "%s %d out of %d", what, index, size)
+			}
+			return nil
+		}
+
+		switch code.Opcode(ins[offset]) {
+		case code.OpConstant:
+			err = inRange(operands[0], len(v.bytecode.Constants), "constant")
+		case code.OpClosure:
+			err = v.closure(operands[0], fn, outers, fail, offset)
+		case code.OpGetGlobal, code.OpSetGlobal, code.OpAssignGlobal:
+			err = inRange(operands[0], len(v.bytecode.Globals), "global")
+		case code.OpCopyGlobal:
+			if err = inRange(operands[0], len(v.bytecode.Globals), "global"); err == nil {
+				err = inRange(operands[1], fn.NumLocals, "local")
+			}
+		case code.OpGetLocal, code.OpSetLocal, code.OpAssignLocal:
+			err = inRange(operands[0], fn.NumLocals, "local")
+		case code.OpGetFree, code.OpCopyFree:
+			depth := operands[0]
+			if depth < 1 || depth > len(outers) {
+				return fail(offset, "no function %d levels out", depth)
+			}
+			err = inRange(operands[1], outers[len(outers)-depth].NumLocals, "free variable")
+			if err == nil && len(operands) > 2 {
+				err = inRange(operands[2], fn.NumLocals, "local")
+			}
+		case code.OpGetBuiltin:
+			if err = inRange(operands[0], len(v.builtins), "builtin"); err == nil {
+				ins[offset+1] = byte(v.builtins[operands[0]])
+			}
+		case code.OpHash:
+			if operands[0]%2 != 0 {
+				err = fail(offset, "odd number of keys and values")
+			}
+		case code.OpIter:
+			err = inRange(operands[0], 2, "flag")
+		case code.OpJump, code.OpJumpNotTruthy, code.OpTry, code.OpIterNext:
+			jumps[offset] = operands[0]
+		}
+		if err != nil {
+			return err
+		}
+
+		offset += 1 + width
+	}
+
+	for offset, target := range jumps {
+		if !starts[target] {
+			return fail(offset, "jump to %04d, not an instruction", target)
+		}
+	}
+
+	return checkStack(ins, fail)
+}
+
+// Kinds of the values on the stack, see checkStack
+const (
+	plainValue     = "v"
+	exceptionValue = "e" // Pushed for the handler of an OpTry, a value too
+	iteratorValue  = "i" // Pushed by OpIter for OpIterNext
+
+	anyValue = plainValue + exceptionValue // What most instructions take
+)
+
+var kindNames = map[rune]string{'v': "value", 'e': "exception", 'i': "iterator"}
+
+// stackState - the kinds of the values the function has on the stack, top
+// last, and the number of its OpTry in progress, before an instruction
+type stackState struct {
+	stack    string
+	handlers int
+}
+
+// checkStack - follows every path through the instructions, checking that
+// they never pop more values than they pushed, pop values of the kinds they
+// expect, end the try blocks they start before returning, and get to each
+// instruction with the same stack whatever the path. The VM relies on it.
+func checkStack(ins code.Instructions, fail func(int, string, ...interface{}) error) error {
+	if len(ins) == 0 {
+		return nil
+	}
+
+	states := map[int]stackState{0: {}}
+	work := []int{0}
+
+	for len(work) > 0 {
+		offset := work[len(work)-1]
+		work = work[:len(work)-1]
+
+		def, _ := code.Lookup(ins[offset])
+		operands, read := code.ReadOperands(def, ins[offset+1:])
+		next := offset + 1 + read
+		stack, handlers := states[offset].stack, states[offset].handlers
+
+		// pop - removes `n` values of the kinds from the stack
+		pop := func(n int, kinds string) error {
+			if len(stack) < n {
+				return fail(offset, "%s pops more values than the stack has", def.Name)
+			}
+			for _, kind := range stack[len(stack)-n:] {
+				if !strings.ContainsRune(kinds, kind) {
+					return fail(offset, "%s can't use the %s on the stack", def.Name, kindNames[kind])
+				}
+			}
+			stack = stack[:len(stack)-n]
+			return nil
+		}
+
+		// reach - notes the state the instruction at `target` is reached in
+		reach := func(target int, state stackState) error {
+			if target == len(ins) {
+				return fail(offset, "runs past the end of the function")
+			}
+			if known, ok := states[target]; ok {
+				if known != state {
+					return fail(offset, "gets to %04d with another stack than before", target)
+				}
+				return nil
+			}
+			states[target] = state
+			work = append(work, target)
+			return nil
+		}
+
+		var err error
+
+		switch code.Opcode(ins[offset]) {
+		case code.OpConstant, code.OpTrue, code.OpFalse, code.OpNull, code.OpGetGlobal, code.OpGetLocal,
+			code.OpGetFree, code.OpGetBuiltin, code.OpClosure:
+			err = reach(next, stackState{stack + plainValue, handlers})
+		case code.OpCopyGlobal, code.OpCopyFree:
+			err = reach(next, stackState{stack, handlers})
+		case code.OpPop:
+			if err = pop(1, anyValue+iteratorValue); err == nil {
+				err = reach(next, stackState{stack, handlers})
+			}
+		case code.OpDup:
+			if err = pop(1, anyValue); err == nil {
+				top := states[offset].stack[len(stack):]
+				err = reach(next, stackState{stack + top + top, handlers})
+			}
+		case code.OpMinus, code.OpBang, code.OpBitNot:
+			if err = pop(1, anyValue); err == nil {
+				err = reach(next, stackState{stack + plainValue, handlers})
+			}
+		case code.OpSetGlobal, code.OpAssignGlobal, code.OpSetLocal, code.OpAssignLocal:
+			if err = pop(1, anyValue); err == nil {
+				err = reach(next, stackState{stack, handlers})
+			}
+		case code.OpArray, code.OpHash, code.OpInterpolate:
+			if err = pop(operands[0], anyValue); err == nil {
+				err = reach(next, stackState{stack + plainValue, handlers})
+			}
+		case code.OpCall:
+			if err = pop(operands[0]+1, anyValue); err == nil {
+				err = reach(next, stackState{stack + plainValue, handlers})
+			}
+		case code.OpJump:
+			err = reach(operands[0], stackState{stack, handlers})
+		case code.OpJumpNotTruthy:
+			if err = pop(1, anyValue); err == nil {
+				if err = reach(next, stackState{stack, handlers}); err == nil {
+					err = reach(operands[0], stackState{stack, handlers})
+				}
+			}
+		case code.OpReturnValue:
+			if err = pop(1, anyValue); err == nil && handlers > 0 {
+				err = fail(offset, "returns in a try block")
+			}
+		case code.OpThrow:
+			err = pop(1, anyValue)
+		case code.OpRethrow:
+			err = pop(1, exceptionValue)
+		case code.OpTry:
+			// Errors get to the handler with the stack of the OpTry and the
+			// exception on top
+			if err = reach(next, stackState{stack, handlers + 1}); err == nil {
+				err = reach(operands[0], stackState{stack + exceptionValue, handlers})
+			}
+		case code.OpEndTry:
+			if handlers == 0 {
+				err = fail(offset, "OpEndTry without an OpTry")
+			} else {
+				err = reach(next, stackState{stack, handlers - 1})
+			}
+		case code.OpIter:
+			if err = pop(1, anyValue); err == nil {
+				err = reach(next, stackState{stack + iteratorValue, handlers})
+			}
+		case code.OpIterNext:
+			// The iterator stays for the next key and value, or is gone
+			// once exhausted
+			if err = pop(1, iteratorValue); err == nil {
+				if err = reach(next, stackState{stack + iteratorValue + plainValue + plainValue, handlers}); err == nil {
+					err = reach(operands[0], stackState{stack, handlers})
+				}
+			}
+		default:
+			// Binary operators and OpIndex
+			if err = pop(2, anyValue); err == nil {
+				err = reach(next, stackState{stack + plainValue, handlers})
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// closure - verifies the function of the constant, created in `fn`. Functions
+// are always created at the same depth.
+func (v *verifier) closure(index int, fn *object.CompiledFunction, outers []*object.CompiledFunction,
+	fail func(int, string, ...interface{}) error, offset int) error {
+	if index >= len(v.bytecode.Constants) {
+		return fail(offset, "constant %d out of %d", index, len(v.bytecode.Constants))
+	}
+
+	created, ok := v.bytecode.Constants[index].(*object.CompiledFunction)
+	if !ok {
+		return fail(offset, "constant %d is not a function", index)
+	}
+
+	depth := len(outers) + 1
+	if fn.Name == "<main>" {
+		depth = 0
+	}
+	if known, verified := v.nesting[index]; verified {
+		if known != depth {
+			return fail(offset, "function %d created at different depths", index)
+		}
+		return nil
+	}
+	v.nesting[index] = depth
+
+	if depth == 0 {
+		return v.function(created, nil)
+	}
+	return v.function(created, append(append([]*object.CompiledFunction{}, outers...), fn))
+}
+
+// Link - makes the program one compiled after the programs whose globals
+// are in the symbol table and whose constants are `constants`: its globals
+// are pointed at the slots of the same names, defining the missing ones, and
+// its constants are added after the previous ones
+func Link(bytecode *Bytecode, symbols *SymbolTable, constants []object.Object) error {
+	if len(constants)+len(bytecode.Constants) > maxOperand {
+		return fmt.Errorf("more than %d constants", maxOperand)
+	}
+
+	slots := make([]int, len(bytecode.Globals))
+	for i, name := range bytecode.Globals {
+		slots[i] = symbols.globals().Define(name).Index
+		if slots[i] >= maxOperand {
+			return fmt.Errorf("more than %d globals", maxOperand)
+		}
+	}
+
+	functions := [][]byte{bytecode.Instructions}
+	for _, constant := range bytecode.Constants {
+		if fn, ok := constant.(*object.CompiledFunction); ok {
+			functions = append(functions, fn.Instructions)
+		}
+	}
+
+	for _, ins := range functions {
+		for offset := 0; offset < len(ins); {
+			def, _ := code.Lookup(ins[offset])
+			operands, read := code.ReadOperands(def, ins[offset+1:])
+
+			switch code.Opcode(ins[offset]) {
+			case code.OpGetGlobal, code.OpSetGlobal, code.OpAssignGlobal, code.OpCopyGlobal:
+				binary.BigEndian.PutUint16(ins[offset+1:], uint16(slots[operands[0]]))
+			case code.OpConstant, code.OpClosure:
+				binary.BigEndian.PutUint16(ins[offset+1:], uint16(len(constants)+operands[0]))
+			}
+
+			offset += 1 + read
+		}
+	}
+
+	bytecode.Globals = symbols.globals().Names()
+	bytecode.Constants = append(constants[:len(constants):len(constants)], bytecode.Constants...)
+	return nil
+}
@@ -0,0 +1,110 @@
+package compiler
+
+import "sudocoding.xyz/interpreter_in_go/src/evaluator"
+
+// SymbolScope - where the value of a variable is kept
+type SymbolScope string
+
+const (
+	GlobalScope  SymbolScope = "GLOBAL"  // globals of the VM
+	LocalScope   SymbolScope = "LOCAL"   // locals of the running function
+	FreeScope    SymbolScope = "FREE"    // locals of a function the running one is nested in
+	BuiltinScope SymbolScope = "BUILTIN" // builtins, see evaluator.BuiltinNames
+)
+
+// Symbol - a variable as resolved by the compiler
+type Symbol struct {
+	Name  string
+	Scope SymbolScope
+	Index int
+	Depth int // Number of functions out the local is, for FreeScope
+}
+
+// SymbolTable - the variables defined in a function, or the globals for the
+// outermost table. Like the environments of the evaluator, blocks don't have
+// variables of their own.
+type SymbolTable struct {
+	Outer *SymbolTable
+
+	store    map[string]Symbol
+	names    []string // Names of the variables by index
+	builtins map[string]Symbol
+}
+
+// NewSymbolTable - creates a table of globals, where the builtins are
+// resolved too
+func NewSymbolTable() *SymbolTable {
+	builtins := map[string]Symbol{}
+	for i, name := range evaluator.BuiltinNames() {
+		builtins[name] = Symbol{Name: name, Scope: BuiltinScope, Index: i}
+	}
+
+	return &SymbolTable{store: map[string]Symbol{}, builtins: builtins}
+}
+
+// NewEnclosedSymbolTable - creates a table of locals for a function nested in
+// the one of `outer`
+func NewEnclosedSymbolTable(outer *SymbolTable) *SymbolTable {
+	return &SymbolTable{Outer: outer, store: map[string]Symbol{}}
+}
+
+// Define - defines the variable in the table. Defining a variable again
+// keeps its slot, like `let` on a defined variable of the evaluator.
+func (s *SymbolTable) Define(name string) Symbol {
+	if symbol, ok := s.store[name]; ok {
+		return symbol
+	}
+
+	symbol := Symbol{Name: name, Scope: LocalScope, Index: len(s.names)}
+	if s.Outer == nil {
+		symbol.Scope = GlobalScope
+	}
+
+	s.store[name] = symbol
+	s.names = append(s.names, name)
+	return symbol
+}
+
+// Resolve - finds the variable in this table or the enclosing ones, then
+// among the builtins
+func (s *SymbolTable) Resolve(name string) (Symbol, bool) {
+	if symbol, ok := s.store[name]; ok {
+		return symbol, true
+	}
+
+	if s.Outer == nil {
+		symbol, ok := s.builtins[name]
+		return symbol, ok
+	}
+
+	symbol, ok := s.Outer.Resolve(name)
+	switch {
+	case !ok:
+		return symbol, false
+	case symbol.Scope == LocalScope:
+		symbol.Scope = FreeScope
+		symbol.Depth = 1
+	case symbol.Scope == FreeScope:
+		symbol.Depth += 1
+	}
+
+	return symbol, true
+}
+
+// Names - returns the names of the variables defined in the table, by index
+func (s *SymbolTable) Names() []string {
+	return s.names
+}
+
+// NumDefinitions - returns the number of variables defined in the table
+func (s *SymbolTable) NumDefinitions() int {
+	return len(s.names)
+}
+
+// globals - the outermost table
+func (s *SymbolTable) globals() *SymbolTable {
+	for s.Outer != nil {
+		s = s.Outer
+	}
+	return s
+}
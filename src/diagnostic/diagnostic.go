@@ -0,0 +1,112 @@
+package diagnostic
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"sudocoding.xyz/interpreter_in_go/src/token"
+)
+
+// Severity - How serious a diagnostic is
+type Severity int
+
+const (
+	Error Severity = iota
+	Warning
+	Note
+)
+
+func (s Severity) String() string {
+	switch s {
+	case Error:
+		return "error"
+	case Warning:
+		return "warning"
+	case Note:
+		return "note"
+	}
+	return "unknown"
+}
+
+// Code - Stable identifier of a kind of diagnostic, e.g. `P0001`. Codes don't
+// change when the wording of the message does, so tools can rely on them.
+type Code string
+
+// Diagnostic - A message about a span of the source code. The lexer and the
+// parser report every problem they find as a diagnostic instead of printing.
+type Diagnostic struct {
+	Severity Severity
+	Code     Code
+	Message  string
+	Pos      token.Position    // start of the offending span
+	End      token.Position    // position right after the offending span
+	Expected []token.TokenType // tokens that would have been accepted, if any
+	Actual   token.Token       // token that was found instead, if any
+	Snippet  string            // source line of the span with carets under it
+}
+
+// Error - Returns the one line form of the diagnostic:
+// `file:line:column: error[P0001]: message`
+func (d *Diagnostic) Error() string {
+	return fmt.Sprintf("%s: %s[%s]: %s", d.Pos, d.Severity, d.Code, d.Message)
+}
+
+// String - Returns the one line form of the diagnostic followed by the source
+// snippet, if there is one
+func (d *Diagnostic) String() string {
+	if d.Snippet == "" {
+		return d.Error()
+	}
+	return d.Error() + "\n" + d.Snippet
+}
+
+// Sort - Orders the diagnostics by their position in the source
+func Sort(diags []*Diagnostic) {
+	sort.SliceStable(diags, func(i, j int) bool {
+		return diags[i].Pos.Offset < diags[j].Pos.Offset
+	})
+}
+
+// Snippet - Renders the line of `src` holding `pos` with carets under the span
+// between `pos` and `end`. Spans running past the line are cut at the end of
+// the line. Returns an empty string if `pos` doesn't point into `src`.
+func Snippet(src string, pos, end token.Position) string {
+	if !pos.IsValid() || pos.Offset > len(src) {
+		return ""
+	}
+
+	lineStart := strings.LastIndexByte(src[:pos.Offset], '\n') + 1
+	lineEnd := len(src)
+	if i := strings.IndexByte(src[pos.Offset:], '\n'); i >= 0 {
+		lineEnd = pos.Offset + i
+	}
+	line := strings.TrimRight(src[lineStart:lineEnd], "\r")
+
+	width := 1
+	if end.Line == pos.Line && end.Offset > pos.Offset {
+		width = utf8.RuneCountInString(src[pos.Offset:min(end.Offset, lineEnd)])
+	}
+
+	// Keep tabs in the padding so the carets line up with the source line
+	var padding bytes.Buffer
+	for _, ch := range src[lineStart:pos.Offset] {
+		if ch == '\t' {
+			padding.WriteRune('\t')
+		} else {
+			padding.WriteRune(' ')
+		}
+	}
+
+	gutter := fmt.Sprintf("%d", pos.Line)
+	blank := strings.Repeat(" ", len(gutter))
+
+	var out bytes.Buffer
+	out.WriteString(fmt.Sprintf(" %s |\n", blank))
+	out.WriteString(fmt.Sprintf(" %s | %s\n", gutter, line))
+	out.WriteString(fmt.Sprintf(" %s | %s%s", blank, padding.String(), strings.Repeat("^", max(width, 1))))
+
+	return out.String()
+}
@@ -0,0 +1,79 @@
+package diagnostic
+
+import (
+	"strings"
+	"testing"
+
+	"sudocoding.xyz/interpreter_in_go/src/token"
+)
+
+func eq[T comparable](t *testing.T, expected T, actual T, msg ...string) {
+	if expected != actual {
+		t.Fatalf("%s\nexpected: %+v\nactual: %+v\n", strings.Join(msg, " "), expected, actual)
+	}
+}
+
+func Test_DiagnosticString(t *testing.T) {
+	src := "let a = 1;\nlet b = a +;\n"
+	diag := &Diagnostic{
+		Severity: Error,
+		Code:     "P0002",
+		Message:  "expected an expression, found ';'",
+		Pos:      token.Position{Filename: "main.monkie", Offset: 21, Line: 2, Column: 11},
+		End:      token.Position{Filename: "main.monkie", Offset: 22, Line: 2, Column: 12},
+	}
+
+	eq(t, "main.monkie:2:11: error[P0002]: expected an expression, found ';'", diag.Error(), "Error() mismatch")
+	eq(t, diag.Error(), diag.String(), "String() without snippet should match Error()")
+
+	diag.Snippet = Snippet(src, diag.Pos, diag.End)
+	eq(t, "main.monkie:2:11: error[P0002]: expected an expression, found ';'\n   |\n 2 | let b = a +;\n   |           ^", diag.String(), "String() mismatch")
+}
+
+func Test_Snippet(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		src      string
+		pos      token.Position
+		end      token.Position
+		expected string
+	}{
+		{
+			name:     "multi character span",
+			src:      "let abc = 1;",
+			pos:      token.Position{Offset: 4, Line: 1, Column: 5},
+			end:      token.Position{Offset: 7, Line: 1, Column: 8},
+			expected: "   |\n 1 | let abc = 1;\n   |     ^^^",
+		},
+		{
+			name:     "span running past the line",
+			src:      "if (a) {\n  b\n}",
+			pos:      token.Position{Offset: 7, Line: 1, Column: 8},
+			end:      token.Position{Offset: 14, Line: 3, Column: 2},
+			expected: "   |\n 1 | if (a) {\n   |        ^",
+		},
+		{
+			name:     "end of file",
+			src:      "add(1",
+			pos:      token.Position{Offset: 5, Line: 1, Column: 6},
+			end:      token.Position{Offset: 5, Line: 1, Column: 6},
+			expected: "   |\n 1 | add(1\n   |      ^",
+		},
+		{
+			name:     "unicode before span",
+			src:      "\"ñ\" + @",
+			pos:      token.Position{Offset: 7, Line: 1, Column: 7},
+			end:      token.Position{Offset: 8, Line: 1, Column: 8},
+			expected: "   |\n 1 | \"ñ\" + @\n   |       ^",
+		},
+		{
+			name:     "invalid position",
+			src:      "let a = 1;",
+			expected: "",
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			eq(t, test.expected, Snippet(test.src, test.pos, test.end), "Snippet mismatch")
+		})
+	}
+}
@@ -0,0 +1,71 @@
+package evaluator
+
+import (
+	"sort"
+
+	"sudocoding.xyz/interpreter_in_go/src/object"
+)
+
+// The functions below give the operations of the language to the compiled
+// backend, so both backends compute the same results and raise the same
+// errors.
+
+// EvalPrefix - applies the prefix operator, `!`, `-` or `~`, to the value
+func EvalPrefix(operator string, right object.Object) object.Object {
+	return evalPrefixExpression(operator, right)
+}
+
+// EvalInfix - applies the infix operator to the values. `&&` and `||` are not
+// operators here, they decide whether their right side runs at all.
+func EvalInfix(left object.Object, operator string, right object.Object) object.Object {
+	return evalInfixExpression(left, operator, right)
+}
+
+// EvalIndex - indexes the array, hash or exception
+func EvalIndex(left object.Object, index object.Object) object.Object {
+	return evalIndexExpression(left, index)
+}
+
+// IsTruthy - whether the value counts as true in conditions
+func IsTruthy(obj object.Object) bool {
+	return isTruthy(obj)
+}
+
+// Throw - the error raised by `throw` with the value
+func Throw(value object.Object) *object.Error {
+	return throw(value)
+}
+
+// BuiltinNames - the names of the builtins, sorted
+func BuiltinNames() []string {
+	names := make([]string, 0, len(builtins))
+	for name := range builtins {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// LookupBuiltin - returns the builtin with the name
+func LookupBuiltin(name string) (*object.Builtin, bool) {
+	builtin, ok := builtins[name]
+	return builtin, ok
+}
+
+// Step - counts one more step of the program against its limits, returning
+// the error stopping it if it exceeded them
+func Step(limits *object.Limits) *object.Error {
+	return step(limits)
+}
+
+// EnterCall - counts one more nested function call against the limits.
+// Calls entered must be left with LeaveCall.
+func EnterCall(limits *object.Limits) *object.Error {
+	return enterCall(limits)
+}
+
+// LeaveCall - counts the end of a function call
+func LeaveCall(limits *object.Limits) {
+	leaveCall(limits)
+}
@@ -0,0 +1,151 @@
+package evaluator
+
+import (
+	"math"
+	"math/big"
+
+	"sudocoding.xyz/interpreter_in_go/src/object"
+	"sudocoding.xyz/interpreter_in_go/src/token"
+)
+
+// evalBigIntegerInfixExpression - evaluates operators on integers that are, or
+// would overflow into, big integers. Results that fit an int64 are turned back
+// into Integers.
+func evalBigIntegerInfixExpression(left object.Object, operator string, right object.Object) object.Object {
+	lVal := toBigInt(left)
+	rVal := toBigInt(right)
+
+	switch token.TokenType(operator) {
+	case token.PLUS:
+		return object.NewInteger(new(big.Int).Add(lVal, rVal))
+	case token.MINUS:
+		return object.NewInteger(new(big.Int).Sub(lVal, rVal))
+	case token.ASTERISK:
+		return object.NewInteger(new(big.Int).Mul(lVal, rVal))
+	case token.SLASH:
+		if rVal.Sign() == 0 {
+			return newError("division by zero")
+		}
+		return object.NewInteger(new(big.Int).Quo(lVal, rVal))
+	case token.PERCENT:
+		if rVal.Sign() == 0 {
+			return newError("modulo by zero")
+		}
+		return object.NewInteger(new(big.Int).Rem(lVal, rVal))
+	case token.FLOOR_DIV:
+		if rVal.Sign() == 0 {
+			return newError("division by zero")
+		}
+
+		quotient, remainder := new(big.Int).QuoRem(lVal, rVal, new(big.Int))
+		if remainder.Sign() != 0 && (remainder.Sign() < 0) != (rVal.Sign() < 0) {
+			quotient.Sub(quotient, big.NewInt(1))
+		}
+		return object.NewInteger(quotient)
+	case token.POWER:
+		return evalIntegerPower(lVal, rVal)
+	case token.BIT_AND:
+		return object.NewInteger(new(big.Int).And(lVal, rVal))
+	case token.BIT_OR:
+		return object.NewInteger(new(big.Int).Or(lVal, rVal))
+	case token.BIT_XOR:
+		return object.NewInteger(new(big.Int).Xor(lVal, rVal))
+	case token.SHL, token.SHR:
+		return evalIntegerShift(lVal, operator, rVal)
+	case token.EQ:
+		return nativeBoolToBooleanObj(lVal.Cmp(rVal) == 0)
+	case token.NOT_EQ:
+		return nativeBoolToBooleanObj(lVal.Cmp(rVal) != 0)
+	case token.GT:
+		return nativeBoolToBooleanObj(lVal.Cmp(rVal) > 0)
+	case token.LT:
+		return nativeBoolToBooleanObj(lVal.Cmp(rVal) < 0)
+	case token.GTE:
+		return nativeBoolToBooleanObj(lVal.Cmp(rVal) >= 0)
+	case token.LTE:
+		return nativeBoolToBooleanObj(lVal.Cmp(rVal) <= 0)
+	}
+
+	return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
+}
+
+// maxIntegerBits - largest size, in bits, of the result of `**` and `<<` on
+// integers
+const maxIntegerBits = 1 << 20
+
+// evalIntegerPower - raises an integer to an integer power. Negative powers
+// give floats.
+func evalIntegerPower(base, exponent *big.Int) object.Object {
+	if exponent.Sign() < 0 {
+		if base.Sign() == 0 {
+			return newError("division by zero")
+		}
+
+		b, _ := new(big.Float).SetInt(base).Float64()
+		e, _ := new(big.Float).SetInt(exponent).Float64()
+		return &object.Float{Value: math.Pow(b, e)}
+	}
+
+	// Powers of 0, 1 and -1 stay small whatever the exponent is
+	if base.CmpAbs(big.NewInt(1)) > 0 && (!exponent.IsInt64() || exponent.Int64() > int64(maxIntegerBits/base.BitLen())) {
+		return newError("result of ** is too large")
+	}
+
+	return object.NewInteger(new(big.Int).Exp(base, exponent, nil))
+}
+
+// evalIntegerShift - shifts an integer by a non negative number of bits. Shifts
+// to the right keep the sign, -5 >> 1 is -3.
+func evalIntegerShift(value *big.Int, operator string, count *big.Int) object.Object {
+	if count.Sign() < 0 {
+		return newError("negative shift count %s", count)
+	}
+
+	if token.TokenType(operator) == token.SHR {
+		// Shifting past the size of the value gives 0 or -1 whatever the count is
+		if !count.IsInt64() || count.Int64() > int64(value.BitLen()) {
+			count = big.NewInt(int64(value.BitLen()))
+		}
+		return object.NewInteger(new(big.Int).Rsh(value, uint(count.Int64())))
+	}
+
+	if value.Sign() != 0 && (!count.IsInt64() || count.Int64() > int64(maxIntegerBits-value.BitLen())) {
+		return newError("result of << is too large")
+	}
+
+	return object.NewInteger(new(big.Int).Lsh(value, uint(count.Uint64())))
+}
+
+// toBigInt - returns the value of an integer or big integer object as a
+// big.Int. The value of a big integer is shared, not copied.
+func toBigInt(obj object.Object) *big.Int {
+	if integer, ok := obj.(*object.Integer); ok {
+		return big.NewInt(integer.Value)
+	}
+	return obj.(*object.BigInteger).Value
+}
+
+// addInt64 - returns a + b, false if it overflows
+func addInt64(a, b int64) (int64, bool) {
+	sum := a + b
+	return sum, (sum > a) == (b > 0)
+}
+
+// subInt64 - returns a - b, false if it overflows
+func subInt64(a, b int64) (int64, bool) {
+	diff := a - b
+	return diff, (diff < a) == (b > 0)
+}
+
+// mulInt64 - returns a * b, false if it overflows
+func mulInt64(a, b int64) (int64, bool) {
+	if a == 0 || b == 0 {
+		return 0, true
+	}
+
+	product := a * b
+	if product/b != a || (a == -1 && b == math.MinInt64) || (b == -1 && a == math.MinInt64) {
+		return 0, false
+	}
+	return product, true
+}
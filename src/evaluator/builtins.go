@@ -1,13 +1,16 @@
 package evaluator
 
 import (
+	"bufio"
 	"fmt"
+	"io"
+	"strings"
 
 	"sudocoding.xyz/interpreter_in_go/src/object"
 )
 
 var builtins = map[string]*object.Builtin{
-	`len`: {Fn: func(args ...object.Object) object.Object {
+	`len`: {Fn: func(ctx object.Context, args ...object.Object) object.Object {
 		if len(args) != 1 {
 			return newError("wrong number of arguments. got=%d, want=1", len(args))
 		}
@@ -22,7 +25,7 @@ var builtins = map[string]*object.Builtin{
 		}
 	}},
 
-	`first`: {Fn: func(args ...object.Object) object.Object {
+	`first`: {Fn: func(ctx object.Context, args ...object.Object) object.Object {
 		if len(args) != 1 {
 			return newError("wrong number of arguments. got=%d, want=1", len(args))
 		}
@@ -38,7 +41,7 @@ var builtins = map[string]*object.Builtin{
 		return NULL
 	}},
 
-	`last`: {Fn: func(args ...object.Object) object.Object {
+	`last`: {Fn: func(ctx object.Context, args ...object.Object) object.Object {
 		if len(args) != 1 {
 			return newError("wrong number of arguments. got=%d, want=1", len(args))
 		}
@@ -56,7 +59,7 @@ var builtins = map[string]*object.Builtin{
 		return NULL
 	}},
 
-	`rest`: {Fn: func(args ...object.Object) object.Object {
+	`rest`: {Fn: func(ctx object.Context, args ...object.Object) object.Object {
 		if len(args) != 1 {
 			return newError("wrong number of arguments. got=%d, want=1", len(args))
 		}
@@ -76,7 +79,7 @@ var builtins = map[string]*object.Builtin{
 		return NULL
 	}},
 
-	`push`: {Fn: func(args ...object.Object) object.Object {
+	`push`: {Fn: func(ctx object.Context, args ...object.Object) object.Object {
 		if len(args) != 2 {
 			return newError("wrong number of arguments. got=%d, want=2", len(args))
 		}
@@ -90,23 +93,78 @@ var builtins = map[string]*object.Builtin{
 		return NULL
 	}},
 
-	`print`: {Fn: func(args ...object.Object) object.Object {
-		for _, item := range args {
-			switch item := item.(type) {
-			case *object.Integer:
-				fmt.Print(item.Value)
-			case *object.String:
-				fmt.Print(item.Value)
-			case *object.Boolean:
-				fmt.Print(item.Value)
-			case *object.Error:
-				fmt.Print(item.Message)
-			case *object.Null:
-				fmt.Print(item.Inspect())
+	`print`: {Fn: func(ctx object.Context, args ...object.Object) object.Object {
+		writeLine(ctx.IO().Stdout, args)
+		return NULL
+	}},
+
+	`eprint`: {Fn: func(ctx object.Context, args ...object.Object) object.Object {
+		writeLine(ctx.IO().Stderr, args)
+		return NULL
+	}},
+
+	`input`: {Fn: func(ctx object.Context, args ...object.Object) object.Object {
+		if len(args) > 1 {
+			return newError("wrong number of arguments. got=%d, want=0 or 1", len(args))
+		}
+
+		if len(args) == 1 {
+			prompt, ok := args[0].(*object.String)
+			if !ok {
+				return newError("argument to `input` must be STRING, got %s", args[0].Type())
 			}
+			fmt.Fprint(ctx.IO().Stdout, prompt.Value)
 		}
 
-		fmt.Println()
-		return NULL
+		return readLine(ctx.IO().Stdin)
+	}},
+
+	`readLine`: {Fn: func(ctx object.Context, args ...object.Object) object.Object {
+		if len(args) != 0 {
+			return newError("wrong number of arguments. got=%d, want=0", len(args))
+		}
+
+		return readLine(ctx.IO().Stdin)
 	}},
 }
+
+// writeLine - writes the values one after the other, strings without their
+// quotes, and ends the line
+func writeLine(out io.Writer, args []object.Object) {
+	for _, item := range args {
+		switch item := item.(type) {
+		case *object.Integer:
+			fmt.Fprint(out, item.Value)
+		case *object.Float, *object.BigInteger:
+			fmt.Fprint(out, item.Inspect())
+		case *object.String:
+			fmt.Fprint(out, item.Value)
+		case *object.Boolean:
+			fmt.Fprint(out, item.Value)
+		case *object.Error:
+			fmt.Fprint(out, item.Message)
+		case *object.Exception:
+			fmt.Fprint(out, item.Err.Message)
+		case *object.Null:
+			fmt.Fprint(out, item.Inspect())
+		}
+	}
+
+	fmt.Fprintln(out)
+}
+
+// readLine - reads the next line of the input, without its line ending. Null
+// once the input is exhausted.
+func readLine(in *bufio.Reader) object.Object {
+	line, err := in.ReadString('\n')
+	if err != nil && (err != io.EOF || line == "") {
+		if err == io.EOF {
+			return NULL
+		}
+		return newError("failed to read input: %s", err)
+	}
+
+	line = strings.TrimSuffix(line, "\n")
+	line = strings.TrimSuffix(line, "\r")
+	return &object.String{Value: line}
+}
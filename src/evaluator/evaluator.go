@@ -2,6 +2,9 @@ package evaluator
 
 import (
 	"fmt"
+	"math"
+	"math/big"
+	"strings"
 
 	"sudocoding.xyz/interpreter_in_go/src/object"
 	"sudocoding.xyz/interpreter_in_go/src/parser/ast"
@@ -9,12 +12,32 @@ import (
 )
 
 var (
-	NULL  = &object.Null{}
-	TRUE  = &object.Boolean{Value: true}
-	FALSE = &object.Boolean{Value: false}
+	NULL     = &object.Null{}
+	TRUE     = &object.Boolean{Value: true}
+	FALSE    = &object.Boolean{Value: false}
+	BREAK    = &object.Break{}
+	CONTINUE = &object.Continue{}
 )
 
+// Eval - evaluates the node in the given environment. Errors are stamped with
+// the position of the innermost node that failed.
 func Eval(node ast.Node, env *object.Environment) object.Object {
+	result := eval(node, env)
+
+	if err, ok := result.(*object.Error); ok && !err.Pos.IsValid() {
+		err.Pos = errorPos(node)
+	}
+
+	return result
+}
+
+func eval(node ast.Node, env *object.Environment) object.Object {
+	if limits := env.Limits(); limits != nil {
+		if err := step(limits); err != nil {
+			return err
+		}
+	}
+
 	switch node := node.(type) {
 	// Statements
 	case *ast.Program:
@@ -23,6 +46,20 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		return evalStatements(node.Statements, env)
 	case *ast.ExpressionStatement:
 		return Eval(node.Expression, env)
+	case *ast.ThrowStatement:
+		if value, ok := expectEval(node.Value, env); ok {
+			return throw(value)
+		} else {
+			return value
+		}
+	case *ast.WhileStatement:
+		return evalWhileStatement(node, env)
+	case *ast.ForStatement:
+		return evalForStatement(node, env)
+	case *ast.BreakStatement:
+		return BREAK
+	case *ast.ContinueStatement:
+		return CONTINUE
 	case *ast.ReturnStatement:
 		if value, ok := expectEval(node.ReturnValue, env); ok {
 			return &object.ReturnValue{Value: value}
@@ -31,7 +68,7 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		}
 	case *ast.LetStatement:
 		if value, ok := expectEval(node.Value, env); ok {
-			env.Set(node.Name.Value, value)
+			define(node.Name, value, env)
 		} else {
 			return value
 		}
@@ -40,7 +77,7 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 			return newError("variable %v hasn't been initialized", node.Identifier.Value)
 		}
 		if value, ok := expectEval(node.Value, env); ok {
-			env.Set(node.Identifier.Value, value)
+			define(node.Identifier, value, env)
 		} else {
 			return value
 		}
@@ -48,8 +85,14 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		// Expression
 	case *ast.IntegerLiteral:
 		return &object.Integer{Value: node.Value}
+	case *ast.BigIntegerLiteral:
+		return &object.BigInteger{Value: node.Value}
+	case *ast.FloatLiteral:
+		return &object.Float{Value: node.Value}
 	case *ast.StringLiteral:
 		return &object.String{Value: node.Value}
+	case *ast.InterpolatedString:
+		return evalInterpolatedString(node.Parts, env)
 	case *ast.Boolean:
 		return nativeBoolToBooleanObj(node.Value)
 	case *ast.ArrayLiteral:
@@ -80,6 +123,21 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 			return left
 		}
 
+		// The right side of `&&` and `||` is evaluated only if the left side
+		// doesn't decide the result already. The deciding operand is returned.
+		switch token.TokenType(node.Operator) {
+		case token.AND:
+			if !isTruthy(left) {
+				return left
+			}
+			return Eval(node.Right, env)
+		case token.OR:
+			if isTruthy(left) {
+				return left
+			}
+			return Eval(node.Right, env)
+		}
+
 		right, ok := expectEval(node.Right, env)
 		if !ok {
 			return right
@@ -88,10 +146,12 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		return evalInfixExpression(left, node.Operator, right)
 	case *ast.IfExpression:
 		return evalIfExpression(node, env)
+	case *ast.TryExpression:
+		return evalTryExpression(node, env)
 	case *ast.Identifier:
 		return evalIdentifier(node, env)
 	case *ast.FunctionLiteral:
-		return &object.Function{Parameters: node.Parameters, Env: env, Body: node.Body}
+		return &object.Function{Parameters: node.Parameters, Env: env, Body: node.Body, Name: node.Name, Locals: node.Locals, Assigned: node.Assigned}
 	case *ast.CallExpression:
 		if node.Function.TokenLiteral() == QUOTE_LITERAL {
 			if len(node.Arguments) != 1 {
@@ -110,12 +170,25 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 			return err
 		}
 
-		return applyFn(fn, args)
+		return applyFn(fn, args, node.Pos(), env)
 	}
 
 	return NULL
 }
 
+// errorPos - position to report for an error of the node. Operators are
+// blamed instead of their left operand.
+func errorPos(node ast.Node) token.Position {
+	switch node := node.(type) {
+	case *ast.InfixExpression:
+		return node.Token.Pos
+	case *ast.IndexExpression:
+		return node.Token.Pos
+	}
+
+	return node.Pos()
+}
+
 func expectEval(node ast.Node, env *object.Environment) (object.Object, bool) {
 	evaluated := Eval(node, env)
 	_, ok := evaluated.(*object.Error)
@@ -145,8 +218,9 @@ func evalStatements(statements []ast.Statement, env *object.Environment) object.
 	for _, statement := range statements {
 		result = Eval(statement, env)
 
-		// Stop processing block if return statement reached
-		if result.Type() == object.RETURN_VALUE_OBJ || result.Type() == object.ERROR_OBJ {
+		// Stop processing block if return, break or continue statement reached
+		switch result.Type() {
+		case object.RETURN_VALUE_OBJ, object.ERROR_OBJ, object.BREAK_OBJ, object.CONTINUE_OBJ:
 			return result
 		}
 	}
@@ -174,6 +248,8 @@ func evalPrefixExpression(operator string, right object.Object) object.Object {
 		return evalBangOperatorExp(right)
 	case "-":
 		return evalMinusPrefixOpExp(right)
+	case "~":
+		return evalBitNotPrefixOpExp(right)
 	}
 
 	return newError("unknown operator: %s%s", operator, right.Type())
@@ -192,16 +268,39 @@ func evalBangOperatorExp(right object.Object) object.Object {
 		return TRUE
 	}
 
+	if floatLit, ok := right.(*object.Float); ok && floatLit.Value == 0 {
+		return TRUE
+	}
+
 	return FALSE
 }
 
 func evalMinusPrefixOpExp(right object.Object) object.Object {
-	if right.Type() != object.INTEGER_OBJ {
-		return newError("unknown operator: -%s", right.Type())
+	switch right := right.(type) {
+	case *object.Integer:
+		if right.Value == math.MinInt64 {
+			return object.NewInteger(new(big.Int).Neg(big.NewInt(right.Value)))
+		}
+		return &object.Integer{Value: -right.Value}
+	case *object.BigInteger:
+		return object.NewInteger(new(big.Int).Neg(right.Value))
+	case *object.Float:
+		return &object.Float{Value: -right.Value}
 	}
 
-	value := right.(*object.Integer).Value
-	return &object.Integer{Value: -value}
+	return newError("unknown operator: -%s", right.Type())
+}
+
+// evalBitNotPrefixOpExp - flips the bits of an integer, ~x is -x - 1
+func evalBitNotPrefixOpExp(right object.Object) object.Object {
+	switch right := right.(type) {
+	case *object.Integer:
+		return &object.Integer{Value: ^right.Value}
+	case *object.BigInteger:
+		return object.NewInteger(new(big.Int).Not(right.Value))
+	}
+
+	return newError("unknown operator: ~%s", right.Type())
 }
 
 func evalInfixExpression(left object.Object, operator string, right object.Object) object.Object {
@@ -209,6 +308,15 @@ func evalInfixExpression(left object.Object, operator string, right object.Objec
 		return evalIntegerInfixExpression(left, operator, right)
 	}
 
+	// Integers are promoted to floats when mixed with floats
+	if isNumber(left) && isNumber(right) && (left.Type() == object.FLOAT_OBJ || right.Type() == object.FLOAT_OBJ) {
+		return evalFloatInfixExpression(left, operator, right)
+	}
+
+	if isNumber(left) && isNumber(right) {
+		return evalBigIntegerInfixExpression(left, operator, right)
+	}
+
 	if left.Type() == object.BOOLEAN_OBJ && right.Type() == object.BOOLEAN_OBJ {
 		return evalBooleanInfixExpression(left, operator, right)
 	}
@@ -226,13 +334,104 @@ func evalIntegerInfixExpression(left object.Object, operator string, right objec
 
 	switch token.TokenType(operator) {
 	case token.PLUS:
-		return &object.Integer{Value: lVal + rVal}
+		if sum, ok := addInt64(lVal, rVal); ok {
+			return &object.Integer{Value: sum}
+		}
+		return evalBigIntegerInfixExpression(left, operator, right)
 	case token.MINUS:
-		return &object.Integer{Value: lVal - rVal}
+		if diff, ok := subInt64(lVal, rVal); ok {
+			return &object.Integer{Value: diff}
+		}
+		return evalBigIntegerInfixExpression(left, operator, right)
 	case token.ASTERISK:
-		return &object.Integer{Value: lVal * rVal}
+		if product, ok := mulInt64(lVal, rVal); ok {
+			return &object.Integer{Value: product}
+		}
+		return evalBigIntegerInfixExpression(left, operator, right)
 	case token.SLASH:
+		if rVal == 0 {
+			return newError("division by zero")
+		}
+		if lVal == math.MinInt64 && rVal == -1 {
+			return evalBigIntegerInfixExpression(left, operator, right)
+		}
 		return &object.Integer{Value: lVal / rVal}
+	case token.PERCENT:
+		if rVal == 0 {
+			return newError("modulo by zero")
+		}
+		return &object.Integer{Value: lVal % rVal}
+	case token.FLOOR_DIV:
+		if rVal == 0 {
+			return newError("division by zero")
+		}
+		if lVal == math.MinInt64 && rVal == -1 {
+			return evalBigIntegerInfixExpression(left, operator, right)
+		}
+
+		quotient := lVal / rVal
+		if lVal%rVal != 0 && (lVal < 0) != (rVal < 0) {
+			quotient -= 1
+		}
+		return &object.Integer{Value: quotient}
+	case token.POWER:
+		return evalIntegerPower(big.NewInt(lVal), big.NewInt(rVal))
+	case token.BIT_AND:
+		return &object.Integer{Value: lVal & rVal}
+	case token.BIT_OR:
+		return &object.Integer{Value: lVal | rVal}
+	case token.BIT_XOR:
+		return &object.Integer{Value: lVal ^ rVal}
+	case token.SHL, token.SHR:
+		return evalIntegerShift(big.NewInt(lVal), operator, big.NewInt(rVal))
+	case token.EQ:
+		return nativeBoolToBooleanObj(lVal == rVal)
+	case token.NOT_EQ:
+		return nativeBoolToBooleanObj(lVal != rVal)
+	case token.GT:
+		return nativeBoolToBooleanObj(lVal > rVal)
+	case token.LT:
+		return nativeBoolToBooleanObj(lVal < rVal)
+	case token.GTE:
+		return nativeBoolToBooleanObj(lVal >= rVal)
+	case token.LTE:
+		return nativeBoolToBooleanObj(lVal <= rVal)
+	}
+
+	return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
+}
+
+func evalFloatInfixExpression(left object.Object, operator string, right object.Object) object.Object {
+	lVal := toFloat(left)
+	rVal := toFloat(right)
+
+	switch token.TokenType(operator) {
+	case token.PLUS:
+		return &object.Float{Value: lVal + rVal}
+	case token.MINUS:
+		return &object.Float{Value: lVal - rVal}
+	case token.ASTERISK:
+		return &object.Float{Value: lVal * rVal}
+	case token.SLASH:
+		if rVal == 0 {
+			return newError("division by zero")
+		}
+		return &object.Float{Value: lVal / rVal}
+	case token.PERCENT:
+		if rVal == 0 {
+			return newError("modulo by zero")
+		}
+		return &object.Float{Value: math.Mod(lVal, rVal)}
+	case token.FLOOR_DIV:
+		if rVal == 0 {
+			return newError("division by zero")
+		}
+		return &object.Float{Value: math.Floor(lVal / rVal)}
+	case token.POWER:
+		if lVal == 0 && rVal < 0 {
+			return newError("division by zero")
+		}
+		return &object.Float{Value: math.Pow(lVal, rVal)}
 	case token.EQ:
 		return nativeBoolToBooleanObj(lVal == rVal)
 	case token.NOT_EQ:
@@ -250,6 +449,27 @@ func evalIntegerInfixExpression(left object.Object, operator string, right objec
 	return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
 }
 
+// isNumber - returns true for integers, big integers and floats
+func isNumber(obj object.Object) bool {
+	switch obj.Type() {
+	case object.INTEGER_OBJ, object.BIG_INTEGER_OBJ, object.FLOAT_OBJ:
+		return true
+	}
+	return false
+}
+
+// toFloat - returns the value of a number object as a float
+func toFloat(obj object.Object) float64 {
+	switch obj := obj.(type) {
+	case *object.Integer:
+		return float64(obj.Value)
+	case *object.BigInteger:
+		value, _ := new(big.Float).SetInt(obj.Value).Float64()
+		return value
+	}
+	return obj.(*object.Float).Value
+}
+
 func evalStringInfixExpression(left object.Object, operator string, right object.Object) object.Object {
 	lVal := left.(*object.String).Value
 	rVal := right.(*object.String).Value
@@ -295,8 +515,145 @@ func evalIfExpression(ie *ast.IfExpression, env *object.Environment) object.Obje
 	return NULL
 }
 
+// throw - raises the value as an error. Thrown exceptions are raised again
+// as they are, keeping their original position and stack.
+func throw(value object.Object) *object.Error {
+	switch value := value.(type) {
+	case *object.Exception:
+		// A copy, the stack of the caught error doesn't grow with the
+		// frames the rethrown one unwinds
+		rethrown := *value.Err
+		rethrown.Stack = append([]object.Frame{}, value.Err.Stack...)
+		return &rethrown
+	case *object.String:
+		return &object.Error{Message: value.Value, Value: value}
+	}
+
+	return &object.Error{Message: value.Inspect(), Value: value}
+}
+
+// evalTryExpression - evaluates the try block, then the catch block if the try
+// block failed. The finally block runs in every case and the error or return
+// it ends with, if any, wins over the result of the other blocks. Errors
+// exceeding a limit of the program go through both untouched.
+func evalTryExpression(te *ast.TryExpression, env *object.Environment) object.Object {
+	result := Eval(te.Block, env)
+
+	if err, ok := result.(*object.Error); ok && err.Limit == nil && te.Catch != nil {
+		define(te.Param, &object.Exception{Err: err}, env)
+		result = Eval(te.Catch, env)
+	}
+
+	if err, ok := result.(*object.Error); ok && err.Limit != nil {
+		return err
+	}
+
+	if te.Finally != nil {
+		switch final := Eval(te.Finally, env); final.(type) {
+		case *object.Error, *object.ReturnValue, *object.Break, *object.Continue:
+			result = final
+		}
+	}
+
+	if result == nil {
+		return NULL
+	}
+	return result
+}
+
+func evalWhileStatement(ws *ast.WhileStatement, env *object.Environment) object.Object {
+	for {
+		condition, ok := expectEval(ws.Condition, env)
+		if !ok {
+			return condition
+		}
+
+		if !isTruthy(condition) {
+			return NULL
+		}
+
+		if result, done := evalLoopBody(ws.Body, env); done {
+			return result
+		}
+	}
+}
+
+func evalForStatement(fs *ast.ForStatement, env *object.Environment) object.Object {
+	iterable, ok := expectEval(fs.Iterable, env)
+	if !ok {
+		return iterable
+	}
+
+	keys, values, err := Iterate(iterable, fs.Key != nil)
+	if err != nil {
+		return err
+	}
+
+	for i := range values {
+		if fs.Key != nil {
+			define(fs.Key, keys[i], env)
+		}
+		define(fs.Value, values[i], env)
+
+		if result, done := evalLoopBody(fs.Body, env); done {
+			return result
+		}
+	}
+
+	return NULL
+}
+
+// Iterate - returns the keys and the values a for-in loop over the iterable
+// walks: indexes and elements of arrays, indexes and characters of strings,
+// keys and values of hashes in order. Iterating a hash without asking for
+// keys walks its keys.
+func Iterate(iterable object.Object, withKeys bool) ([]object.Object, []object.Object, *object.Error) {
+	var keys, values []object.Object
+
+	switch iterable := iterable.(type) {
+	case *object.Array:
+		for i, elm := range iterable.Elements {
+			keys = append(keys, &object.Integer{Value: int64(i)})
+			values = append(values, elm)
+		}
+	case *object.Hash:
+		for _, pair := range iterable.SortedPairs() {
+			keys = append(keys, pair.Key)
+			values = append(values, pair.Value)
+		}
+
+		if !withKeys {
+			values = keys
+		}
+	case *object.String:
+		i := 0
+		for _, ch := range iterable.Value {
+			keys = append(keys, &object.Integer{Value: int64(i)})
+			values = append(values, &object.String{Value: string(ch)})
+			i += 1
+		}
+	default:
+		return nil, nil, newError("cannot iterate over %s", iterable.Type())
+	}
+
+	return keys, values, nil
+}
+
+// evalLoopBody - evaluates one iteration of a loop. Returns true along with the
+// result of the loop if the loop must stop.
+func evalLoopBody(body *ast.BlockStatement, env *object.Environment) (object.Object, bool) {
+	switch result := Eval(body, env).(type) {
+	case *object.Break:
+		return NULL, true
+	case *object.ReturnValue, *object.Error:
+		return result, true
+	}
+
+	return nil, false
+}
+
 func evalIdentifier(id *ast.Identifier, env *object.Environment) object.Object {
-	if val, ok := env.Get(id.Value); ok {
+	if val := lookup(id, env); val != nil {
 		return val
 	}
 
@@ -307,6 +664,35 @@ func evalIdentifier(id *ast.Identifier, env *object.Environment) object.Object {
 	return newError("identifier not found: %s", id.Value)
 }
 
+// lookup - returns the value of the variable the identifier refers to, by
+// slot if the resolver went through it or else by name, nil if the variable
+// isn't set. Builtins aren't variables.
+func lookup(id *ast.Identifier, env *object.Environment) object.Object {
+	switch id.Scope {
+	case ast.LocalScope:
+		return env.Slot(id.Depth, id.Slot)
+	case ast.GlobalScope:
+		env = env.Globals()
+	}
+
+	val, _ := env.Get(id.Value)
+	return val
+}
+
+// define - sets the variable declared by `let`, `for` or `catch`, or
+// assigned by `=`. Assignments in functions set variables of the functions,
+// see ast.AssignedNames.
+func define(id *ast.Identifier, value object.Object, env *object.Environment) {
+	switch id.Scope {
+	case ast.LocalScope:
+		env.SetSlot(id.Depth, id.Slot, value)
+	case ast.GlobalScope:
+		env.Globals().Set(id.Value, value)
+	default:
+		env.Set(id.Value, value)
+	}
+}
+
 func evalArrayLiteral(elements []ast.Expression, env *object.Environment) object.Object {
 	elms, err := evalExpressions(elements, env)
 	if err != nil {
@@ -316,6 +702,22 @@ func evalArrayLiteral(elements []ast.Expression, env *object.Environment) object
 	return &object.Array{Elements: elms}
 }
 
+// evalInterpolatedString - joins the text parts of the string with the
+// `Inspect` of its embedded values
+func evalInterpolatedString(parts []ast.Expression, env *object.Environment) object.Object {
+	values, err := evalExpressions(parts, env)
+	if err != nil {
+		return err
+	}
+
+	var out strings.Builder
+	for _, value := range values {
+		out.WriteString(value.Inspect())
+	}
+
+	return &object.String{Value: out.String()}
+}
+
 func evalHashLiteral(pairs map[ast.Expression]ast.Expression, env *object.Environment) object.Object {
 	hash := &object.Hash{Pairs: make(map[object.HashKey]object.HashPair)}
 
@@ -347,6 +749,11 @@ func evalIndexExpression(left object.Object, index object.Object) object.Object
 		return evalArrayIndexExp(left, index)
 	case left.Type() == object.HASH_OBJ:
 		return evalHashIndexExp(left, index)
+	case left.Type() == object.EXCEPTION_OBJ && index.Type() == object.STRING_OBJ:
+		if field, ok := left.(*object.Exception).Field(index.(*object.String).Value); ok {
+			return field
+		}
+		return NULL
 	default:
 		return newError("index operator not supported: %s[%s]", left.Type(), index.Type())
 	}
@@ -378,20 +785,82 @@ func evalHashIndexExp(left object.Object, index object.Object) object.Object {
 	return NULL
 }
 
-func applyFn(fn object.Object, args []object.Object) object.Object {
+// applyFn - calls the function from `pos` in `env`, whose IO builtins use and
+// whose limits bound the call. Errors leaving a Monkie function record the
+// call in their stack.
+func applyFn(fn object.Object, args []object.Object, pos token.Position, env *object.Environment) object.Object {
 	switch fn := fn.(type) {
 	case *object.Function:
+		if len(args) != len(fn.Parameters) {
+			return newError("wrong number of arguments to `%s`. got=%d, want=%d", fnName(fn), len(args), len(fn.Parameters))
+		}
+
+		if limits := env.Limits(); limits != nil {
+			if err := enterCall(limits); err != nil {
+				return err
+			}
+			defer leaveCall(limits)
+		}
+
 		extendedEnv := extendFuncEnv(fn, args)
 		evaluated := Eval(fn.Body, extendedEnv)
+
+		if err, ok := evaluated.(*object.Error); ok {
+			err.Stack = append(err.Stack, object.Frame{Function: fnName(fn), Pos: pos})
+		}
+
 		return unwrapReturnValue(evaluated)
 	case *object.Builtin:
-		return fn.Fn(args...)
+		return fn.Fn(&callContext{pos: pos, env: env}, args...)
 	}
 
 	return newError("not a function: %s", fn.Type())
 }
 
+// CallFunction - calls a function or a builtin from Go, with the IO and the
+// limits of `env`. The result is an *object.Error if the call failed.
+func CallFunction(env *object.Environment, fn object.Object, args ...object.Object) object.Object {
+	return applyFn(fn, args, token.Position{}, env)
+}
+
+// callContext - context of a builtin called from `pos`. Functions the builtin
+// calls back are recorded in tracebacks as called from there.
+type callContext struct {
+	pos token.Position
+	env *object.Environment
+}
+
+func (c *callContext) Call(fn object.Object, args ...object.Object) object.Object {
+	return applyFn(fn, args, c.pos, c.env)
+}
+
+func (c *callContext) IO() *object.IO {
+	return c.env.IO()
+}
+
+// fnName - name of the function to use in stack traces
+func fnName(fn *object.Function) string {
+	if fn.Name == "" {
+		return "<anonymous>"
+	}
+	return fn.Name
+}
+
 func extendFuncEnv(fn *object.Function, args []object.Object) *object.Environment {
+	if fn.Locals != nil {
+		env := object.NewFrame(fn.Env, fn.Locals)
+		for i, arg := range args {
+			env.SetSlot(0, i, arg)
+		}
+		// Variables outside of the function don't change while it runs
+		for _, slot := range fn.Assigned {
+			if value, ok := fn.Env.Get(fn.Locals[slot]); ok {
+				env.SetSlot(0, slot, value)
+			}
+		}
+		return env
+	}
+
 	env := object.NewEnclosedEnv(fn.Env)
 	for i, param := range fn.Parameters {
 		env.Set(param.Value, args[i])
@@ -427,6 +896,9 @@ func isTruthy(obj object.Object) bool {
 	if integer, ok := obj.(*object.Integer); ok && integer.Value == 0 {
 		return false
 	}
+	if float, ok := obj.(*object.Float); ok && float.Value == 0 {
+		return false
+	}
 	return true
 }
 
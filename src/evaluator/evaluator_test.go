@@ -1,9 +1,12 @@
 package evaluator
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"strings"
 	"testing"
+	"time"
 
 	"sudocoding.xyz/interpreter_in_go/src/lexer"
 	"sudocoding.xyz/interpreter_in_go/src/object"
@@ -23,7 +26,7 @@ func notEq[T comparable](t *testing.T, expected T, actual T, msg ...string) {
 }
 
 func testEval(input string) object.Object {
-	l := lexer.New_V2(strings.NewReader(input))
+	l := lexer.New(input)
 	p := parser.New(l)
 	program := p.ParseProgram()
 	env := object.NewEnvironment()
@@ -114,6 +117,210 @@ func Test_EvalIntegerExpression(t *testing.T) {
 	}
 }
 
+func Test_EvalFloatExpression(t *testing.T) {
+	for _, test := range []struct {
+		input    string
+		expected interface{}
+	}{
+		{"1.5", "1.5"},
+		{"-2.5", "-2.5"},
+		{".5 + .25", "0.75"},
+		{"1 + 0.5", "1.5"},
+		{"0.5 + 1", "1.5"},
+		{"3 * 1.5", "4.5"},
+		{"1 / 2.0", "0.5"},
+		{"2.0 * 3", "6.0"},
+		{"2e10", "20000000000.0"},
+		{"1e21", "1e+21"},
+		{"1.5 > 1", true},
+		{"1 == 1.0", true},
+		{"0.1 + 0.2 == 0.3", false},
+		{"!0.0", true},
+		{"if (0.0) { 1 } else { 2 }", "2"},
+		{"1.5 + true", "type mismatch: FLOAT + BOOLEAN"},
+		{`{1.5: "a"}[1.5]`, "a"},
+	} {
+		t.Run(fmt.Sprintf("Tests for %s", test.input), func(t *testing.T) {
+			evaluated := testEval(test.input)
+
+			switch expected := test.expected.(type) {
+			case bool:
+				eq(t, true, testBooleanObj(t, evaluated, expected))
+			case string:
+				if errObj, ok := evaluated.(*object.Error); ok {
+					eq(t, expected, errObj.Message, "Error message mismatch")
+				} else {
+					eq(t, expected, evaluated.Inspect(), "Inspect mismatch")
+				}
+			}
+		})
+	}
+}
+
+func Test_EvalBigIntegerExpression(t *testing.T) {
+	for _, test := range []struct {
+		input    string
+		expected interface{}
+	}{
+		{"9223372036854775807 + 1", "9223372036854775808"},
+		{"-9223372036854775807 - 2", "-9223372036854775809"},
+		{"9223372036854775807 * 2", "18446744073709551614"},
+		{"4611686018427387904 * -2", int64(-9223372036854775808)},
+		{"-9223372036854775807 - 1", int64(-9223372036854775808)},
+		{"let min = -9223372036854775807 - 1; -min", "9223372036854775808"},
+		{"let min = -9223372036854775807 - 1; min / -1", "9223372036854775808"},
+		{"99999999999999999999", "99999999999999999999"},
+		{"99999999999999999999 - 99999999999999999998", int64(1)},
+		{"99999999999999999999 / 3", "33333333333333333333"},
+		{"-99999999999999999999", "-99999999999999999999"},
+		{"99999999999999999999 > 9223372036854775807", true},
+		{"99999999999999999999 == 99999999999999999999", true},
+		{"99999999999999999999 + 0.5", "100000000000000000000.0"},
+		{`{99999999999999999999: "big"}[99999999999999999998 + 1]`, "big"},
+		{"99999999999999999999 + true", "type mismatch: BIG_INTEGER + BOOLEAN"},
+	} {
+		t.Run(fmt.Sprintf("Tests for %s", test.input), func(t *testing.T) {
+			evaluated := testEval(test.input)
+
+			switch expected := test.expected.(type) {
+			case int64:
+				eq(t, true, testIntegerObj(t, evaluated, expected))
+			case bool:
+				eq(t, true, testBooleanObj(t, evaluated, expected))
+			case string:
+				if errObj, ok := evaluated.(*object.Error); ok {
+					eq(t, expected, errObj.Message, "Error message mismatch")
+				} else {
+					eq(t, expected, evaluated.Inspect(), "Inspect mismatch")
+				}
+			}
+		})
+	}
+}
+
+func Test_ArithmeticOperators(t *testing.T) {
+	for _, test := range []struct {
+		input    string
+		expected interface{}
+	}{
+		{"7 % 3", int64(1)},
+		{"-7 % 3", int64(-1)},
+		{"7 % -3", int64(1)},
+		{"7 ~/ 2", int64(3)},
+		{"-7 ~/ 2", int64(-4)},
+		{"7 ~/ -2", int64(-4)},
+		{"-8 ~/ 2", int64(-4)},
+		{"2 ** 10", int64(1024)},
+		{"2 ** 3 ** 2", int64(512)},
+		{"-2 ** 2", int64(-4)},
+		{"(-2) ** 3", int64(-8)},
+		{"2 ** 64", "18446744073709551616"},
+		{"2 ** -1", "0.5"},
+		{"1 ** 99999999999999999999", int64(1)},
+		{"2 ** 99999999", "result of ** is too large"},
+		{"2.0 ** 0.5 > 1.414", true},
+		{"7.5 % 2", "1.5"},
+		{"7.5 ~/ 2", "3.0"},
+		{"-7.5 ~/ 2", "-4.0"},
+		{"99999999999999999999 % 7", int64(1)},
+		{"-99999999999999999999 ~/ 10", "-10000000000000000000"},
+		{"let min = -9223372036854775807 - 1; min ~/ -1", "9223372036854775808"},
+		{"1 / 0", "division by zero"},
+		{"1 % 0", "modulo by zero"},
+		{"1 ~/ 0", "division by zero"},
+		{"1.5 / 0", "division by zero"},
+		{"1 / 0.0", "division by zero"},
+		{"1.5 % 0.0", "modulo by zero"},
+		{"0 ** -1", "division by zero"},
+		{"0.0 ** -1", "division by zero"},
+		{"99999999999999999999 / 0", "division by zero"},
+		{"99999999999999999999 % 0", "modulo by zero"},
+		{`try { 1 / 0 } catch (e) { e["message"] }`, "division by zero"},
+		{`"a" % "b"`, "unknown operator: STRING % STRING"},
+		{"0b1100 & 0b1010", int64(8)},
+		{"0b1100 | 0b1010", int64(14)},
+		{"0b1100 ^ 0b1010", int64(6)},
+		{"~0", int64(-1)},
+		{"~0xFF", int64(-256)},
+		{"1 << 4", int64(16)},
+		{"0xFF >> 4", int64(15)},
+		{"-5 >> 1", int64(-3)},
+		{"1 >> 100", int64(0)},
+		{"-1 >> 100", int64(-1)},
+		{"1 << 64", "18446744073709551616"},
+		{"(1 << 64) >> 63", int64(2)},
+		{"(1 << 64) | 1", "18446744073709551617"},
+		{"~(1 << 64)", "-18446744073709551617"},
+		{"(1 << 64) & 0xFF", int64(0)},
+		{"1_000_000 + 0x10", int64(1000016)},
+		{"let READ = 1; let WRITE = 2; let flags = READ | WRITE; flags & WRITE == WRITE", true},
+		{"1 << -1", "negative shift count -1"},
+		{"1 << 99999999", "result of << is too large"},
+		{"0 << 99999999999999999999", int64(0)},
+		{"1.5 & 1", "unknown operator: FLOAT & INTEGER"},
+		{"~1.5", "unknown operator: ~FLOAT"},
+		{"true | false", "unknown operator: BOOLEAN | BOOLEAN"},
+	} {
+		t.Run(fmt.Sprintf("Tests for %s", test.input), func(t *testing.T) {
+			evaluated := testEval(test.input)
+
+			switch expected := test.expected.(type) {
+			case int64:
+				eq(t, true, testIntegerObj(t, evaluated, expected))
+			case bool:
+				eq(t, true, testBooleanObj(t, evaluated, expected))
+			case string:
+				if errObj, ok := evaluated.(*object.Error); ok {
+					eq(t, expected, errObj.Message, "Error message mismatch")
+				} else {
+					eq(t, expected, evaluated.Inspect(), "Inspect mismatch")
+				}
+			}
+		})
+	}
+}
+
+func Test_LogicalOperators(t *testing.T) {
+	for _, test := range []struct {
+		input    string
+		expected interface{}
+	}{
+		{"true && true", true},
+		{"true && false", false},
+		{"false || true", true},
+		{"false || false", false},
+		{"1 < 2 && 2 < 3", true},
+		{"1 > 2 || 2 > 3", false},
+		{"0 && 5", int64(0)},
+		{"3 && 5", int64(5)},
+		{"0 || 5", int64(5)},
+		{"3 || 5", int64(3)},
+		{`"" || "default"`, ""},
+		{"false && undefined", false},
+		{"true || undefined", true},
+		{"true && undefined", "identifier not found: undefined"},
+		{"let calls = []; let f = fn(x) { push(calls, x); x }; false && f(1); len(calls)", int64(0)},
+		{"let calls = []; let f = fn(x) { push(calls, x); x }; f(false) || f(1) || f(2); len(calls)", int64(2)},
+	} {
+		t.Run(fmt.Sprintf("Tests for %s", test.input), func(t *testing.T) {
+			evaluated := testEval(test.input)
+
+			switch expected := test.expected.(type) {
+			case int64:
+				eq(t, true, testIntegerObj(t, evaluated, expected))
+			case bool:
+				eq(t, true, testBooleanObj(t, evaluated, expected))
+			case string:
+				if errObj, ok := evaluated.(*object.Error); ok {
+					eq(t, expected, errObj.Message, "Error message mismatch")
+				} else {
+					eq(t, true, testStringObj(t, evaluated, expected))
+				}
+			}
+		})
+	}
+}
+
 func Test_EvalBooleanExpression(t *testing.T) {
 	for _, test := range []struct {
 		input    string
@@ -153,6 +360,11 @@ func Test_EvalStringExpression(t *testing.T) {
 	}{
 		{"\"asdf\"", "asdf"},
 		{"\"asdf\" + \"qwer\"", "asdfqwer"},
+		{`let n = 3; "you have ${n} items"`, "you have 3 items"},
+		{`let user = {"name": "ann"}; "hello ${user["name"]}, ${len([1, 2]) * 1.5}"`, "hello ann, 3.0"},
+		{`"${[1, "a"]} ${{"k": true}} ${if (false) { 1 }}"`, `[1, a] {k: true} null`},
+		{`let f = fn(x) { "<${x}>" }; "${f("${1 + 1}")}"`, "<2>"},
+		{`"\${not} interpolated $ {x}"`, "${not} interpolated $ {x}"},
 	} {
 		t.Run(fmt.Sprintf("Test string expresson for: %s", test.input), func(t *testing.T) {
 			evaluated := testEval(test.input)
@@ -242,6 +454,9 @@ func Test_ErrorHandling(t *testing.T) {
 		{"if (10 > 1) { if (10 > 1) { return true + false; } return 1; }", "unknown operator: BOOLEAN + BOOLEAN"},
 		{"foobar", "identifier not found: foobar"},
 		{"a = 5;", "variable a hasn't been initialized"},
+		{`"value: ${missing}"`, "identifier not found: missing"},
+		{"let add = fn(a, b) { a + b }; add(1)", "wrong number of arguments to `add`. got=1, want=2"},
+		{"fn() { 1 }(2)", "wrong number of arguments to `<anonymous>`. got=1, want=0"},
 	} {
 		t.Run(fmt.Sprintf("Test error for %s", test.input), func(t *testing.T) {
 			evaluated := testEval(test.input)
@@ -253,6 +468,185 @@ func Test_ErrorHandling(t *testing.T) {
 	}
 }
 
+func Test_ErrorLocation(t *testing.T) {
+	for _, test := range []struct {
+		input string
+		pos   string
+		stack string
+	}{
+		{"5 + true", "1:3", ""},
+		{"let a = 1;\n  foobar", "2:3", ""},
+		{"let arr = [1];\narr[len]", "2:4", ""},
+		{"len(1, 2)", "1:1", ""},
+		{
+			input: "let inner = fn() { x };\nlet outer = fn() {\n  inner()\n};\nouter()",
+			pos:   "1:20",
+			stack: "inner@3:3 outer@5:1",
+		},
+		{"fn() { -true }()", "1:8", "<anonymous>@1:1"},
+	} {
+		t.Run(fmt.Sprintf("Test error location for %q", test.input), func(t *testing.T) {
+			errObj, ok := testEval(test.input).(*object.Error)
+			eq(t, true, ok, "Failed to typecast evaulated to *object.Error")
+			eq(t, test.pos, errObj.Pos.String(), "Error position mismatch")
+
+			frames := []string{}
+			for _, frame := range errObj.Stack {
+				frames = append(frames, fmt.Sprintf("%s@%s", frame.Function, frame.Pos))
+			}
+			eq(t, test.stack, strings.Join(frames, " "), "Stack mismatch")
+		})
+	}
+}
+
+func Test_TryCatch(t *testing.T) {
+	for _, test := range []struct {
+		input    string
+		expected interface{}
+	}{
+		{`try { 1 } catch (e) { 2 }`, 1},
+		{`try { 1 + true } catch (e) { 2 }`, 2},
+		{`try { throw "oops" } catch (e) { e["message"] }`, "oops"},
+		{`try { throw 42 } catch (e) { e["value"] }`, 42},
+		{`try { throw 42 } catch (e) { e["message"] }`, "42"},
+		{`try { foobar } catch (e) { e["message"] }`, "identifier not found: foobar"},
+		{`try { foobar } catch (e) { e["value"] }`, "identifier not found: foobar"},
+		{`try { first(1) } catch (e) { e["message"] }`, "argument to `first` must be ARRAY, got INTEGER"},
+		{"try {\n  throw 1 } catch (e) { e[\"position\"] }", "2:3"},
+		{"let f = fn() { throw \"x\" };\ntry { f() } catch (e) { e[\"stack\"][0] }", "f (1:16)"},
+		{"let f = fn() { throw \"x\" };\ntry { f() } catch (e) { e[\"stack\"][1] }", "<main> (2:7)"},
+		{`try { throw "oops" } catch (e) { e["unknown"] }`, nil},
+		{`let a = 1; try { a = 2 } finally { a = a + 10 }; a`, 12},
+		{`let a = 1; try { throw 1 } catch (e) { a = 2 } finally { a = a + 10 }; a`, 12},
+		{`let f = fn() { try { return 1 } finally { return 2 } }; f()`, 2},
+		{`let f = fn() { try { return 1 } finally { 2 } }; f()`, 1},
+		{`let f = fn() { try { throw 1 } catch (e) { return 3 }; 4 }; f()`, 3},
+		{`try { try { throw "in" } finally { 1 } } catch (e) { e["message"] }`, "in"},
+		{`try { try { throw "in" } catch (e) { throw e } } catch (e) { e["position"] }`, "1:13"},
+		{`try { try { throw "in" } catch (e) { throw "out" } } catch (e) { e["message"] }`, "out"},
+		{"let f = fn() { throw \"x\" };\nlet caught = try { f() } catch (e) { e };\nlet g = fn() { throw caught };\ntry { g() } catch (e) { 0 };\nlen(caught[\"stack\"])", 2},
+		{"let f = fn() { throw \"x\" };\nlet caught = try { f() } catch (e) { e };\nlet g = fn() { throw caught };\ntry { g() } catch (e) { 0 };\ntry { g() } catch (e) { len(e[\"stack\"]) }", 3},
+		{`try { throw "oops" } finally { 1 }`, "oops"},
+		{`try { 1 } finally { throw "final" }`, "final"},
+		{`try { 1 } catch (e) { }`, 1},
+	} {
+		t.Run(fmt.Sprintf("Test try for %s", test.input), func(t *testing.T) {
+			evaluated := testEval(test.input)
+
+			switch expected := test.expected.(type) {
+			case int:
+				eq(t, true, testIntegerObj(t, evaluated, int64(expected)))
+			case string:
+				switch evaluated.(type) {
+				case *object.Error:
+					eq(t, true, testErrorObj(t, evaluated, expected))
+				default:
+					eq(t, true, testStringObj(t, evaluated, expected))
+				}
+			default:
+				eq(t, true, testNullObj(t, evaluated))
+			}
+		})
+	}
+}
+
+func Test_Loops(t *testing.T) {
+	for _, test := range []struct {
+		input    string
+		expected interface{}
+	}{
+		{`let i = 0; while (i < 10) { i = i + 1 }; i`, 10},
+		{`let i = 0; while (true) { i = i + 1; if (i == 5) { break } }; i`, 5},
+		{`let i = 0; let n = 0; while (i < 10) { i = i + 1; if (i > 3) { continue }; n = n + 1 }; n`, 3},
+		{`let s = 0; for (x in [1, 2, 3]) { s = s + x }; s`, 6},
+		{`let s = 0; for (i, x in [10, 20, 30]) { s = s + i * x }; s`, 80},
+		{`let s = ""; for (k in {"b": 1, "a": 2, "c": 3}) { s = s + k }; s`, "abc"},
+		{`let s = ""; for (k, v in {"b": "2", "a": "1"}) { s = s + k + v }; s`, "a1b2"},
+		{`let s = 0; for (k, v in {3: 30, 1: 10, 2: 20}) { s = s * 10 + k }; s`, 123},
+		{`let s = ""; for (ch in "héllo") { s = ch + s }; s`, "olléh"},
+		{`let n = 0; for (i, ch in "ab") { n = n + i }; n`, 1},
+		{`let f = fn() { for (x in [1, 2, 3]) { if (x == 2) { return x * 100 } }; 0 }; f()`, 200},
+		{`let n = 0; for (x in [1, 2]) { for (y in [1, 2, 3]) { if (y == 2) { break }; n = n + 1 } }; n`, 2},
+		{`let n = 0; for (x in [1, 2, 3]) { try { if (x == 2) { continue } } finally { n = n + 1 } }; n`, 3},
+		{`let a = [1]; for (x in a) { push(a, x) }; len(a)`, 2},
+		{`for (x in 5) { x }`, "cannot iterate over INTEGER"},
+		{`while (x) { 1 }`, "identifier not found: x"},
+		{`for (x in []) { x }`, nil},
+	} {
+		t.Run(fmt.Sprintf("Test loop for %s", test.input), func(t *testing.T) {
+			evaluated := testEval(test.input)
+
+			switch expected := test.expected.(type) {
+			case int:
+				eq(t, true, testIntegerObj(t, evaluated, int64(expected)))
+			case string:
+				switch evaluated.(type) {
+				case *object.Error:
+					eq(t, true, testErrorObj(t, evaluated, expected))
+				default:
+					eq(t, true, testStringObj(t, evaluated, expected))
+				}
+			default:
+				eq(t, true, testNullObj(t, evaluated))
+			}
+		})
+	}
+}
+
+func Test_Limits(t *testing.T) {
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	timedOut, cancelTimeout := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancelTimeout()
+
+	for _, test := range []struct {
+		input    string
+		limits   object.Limits
+		ctx      context.Context
+		expected string
+	}{
+		{"while (true) { }", object.Limits{MaxSteps: 100}, nil, "limit exceeded: more than 100 steps"},
+		{"let f = fn(n) { f(n + 1) }; f(0)", object.Limits{MaxDepth: 50}, nil, "limit exceeded: more than 50 nested calls"},
+		{"try { while (true) { } } catch (e) { 1 }", object.Limits{MaxSteps: 100}, nil, "limit exceeded: more than 100 steps"},
+		{"try { while (true) { } } finally { 1 }", object.Limits{MaxSteps: 100}, nil, "limit exceeded: more than 100 steps"},
+		// Limits can't be caught, or handlers retrying the call would double
+		// the work at each level
+		{"let f = fn() { try { f() } catch (e) { f() } }; f()", object.Limits{MaxDepth: 50}, nil, "limit exceeded: more than 50 nested calls"},
+		{"try { while (true) { } } catch (e) { 1 }", object.Limits{}, cancelled, "limit exceeded: context canceled"},
+		// Nor can finally blocks replace them
+		{"let f = fn() { f() }; let g = fn() { try { f() } finally { return 1 } }; g()", object.Limits{MaxDepth: 100}, nil, "limit exceeded: more than 100 nested calls"},
+		{"let g = fn() { try { while (true) { } } finally { return 1 } }; g()", object.Limits{}, timedOut, "limit exceeded: context deadline exceeded"},
+		{"while (true) { try { while (true) { } } finally { break } }", object.Limits{MaxSteps: 100}, nil, "limit exceeded: more than 100 steps"},
+		{"let i = 0; while (true) { i = i + 1 }", object.Limits{}, cancelled, "limit exceeded: context canceled"},
+	} {
+		t.Run(fmt.Sprintf("Test limits of %s", test.input), func(t *testing.T) {
+			program := parser.New(lexer.New(test.input)).ParseProgram()
+			env := object.NewEnvironment()
+			limits := test.limits
+			env.SetLimits(&limits)
+
+			ctx := test.ctx
+			if ctx == nil {
+				ctx = context.Background()
+			}
+			evaluated := EvalContext(ctx, program, env)
+
+			eq(t, true, testErrorObj(t, evaluated, test.expected))
+			eq(t, true, errors.Is(evaluated.(*object.Error).Limit, ErrLimitExceeded), "Limit should wrap ErrLimitExceeded")
+		})
+	}
+
+	env := object.NewEnvironment()
+	env.SetLimits(&object.Limits{MaxSteps: 1000, MaxDepth: 10})
+	program := parser.New(lexer.New("let f = fn(n) { if (n == 0) { 0 } else { f(n - 1) } }; f(9)")).ParseProgram()
+	eq(t, true, testIntegerObj(t, EvalContext(context.Background(), program, env), 0))
+	eq(t, true, testIntegerObj(t, EvalContext(context.Background(), program, env), 0), "Limits should be reset for each run")
+
+	limits := &object.Limits{Context: cancelled}
+	notEq(t, nil, step(limits), "The context should be checked on the first step")
+	notEq(t, nil, step(limits), "Exceeded limits should stay exceeded")
+}
+
 func Test_LetStatements(t *testing.T) {
 	for _, test := range []struct {
 		input    string
@@ -287,6 +681,11 @@ func Test_AssigmentStatements(t *testing.T) {
 		{"let a = 5 * 5; a = 10; a", 10},
 		{"let a = 5; let b = a + 10; a = b; a", 15},
 		{"let a = 5; let b = a; let c = 0; c = a + b + 5; c;", 15},
+		// Assignments in functions set variables of the functions
+		{"let n = 0; let inc = fn() { n = n + 1 }; inc(); inc(); n", 0},
+		{"let counter = fn() { let n = 0; fn() { n = n + 1; n } }; let next = counter(); next(); next()", 1},
+		{"let t = 10; let f = fn() { let i = 0; while (i < 3) { t = t + 1; i = i + 1 }\n t }; f() + t", 23},
+		{"let n = 1; let f = fn(n) { n = n * 10; n }; f(2) + n", 21},
 	} {
 		t.Run(fmt.Sprintf("Test let statement for %s", test.input), func(t *testing.T) {
 			eq(t, true, testIntegerObj(t, testEval(test.input), test.expected))
@@ -378,6 +777,52 @@ func Test_BuiltinFunction(t *testing.T) {
 	}
 }
 
+func Test_BuiltinCallback(t *testing.T) {
+	apply := &object.Builtin{Fn: func(ctx object.Context, args ...object.Object) object.Object {
+		results := &object.Array{}
+		for _, elm := range args[1].(*object.Array).Elements {
+			result := ctx.Call(args[0], elm)
+			if _, ok := result.(*object.Error); ok {
+				return result
+			}
+			results.Elements = append(results.Elements, result)
+		}
+		return results
+	}}
+
+	for _, test := range []struct {
+		input    string
+		expected interface{}
+	}{
+		{"apply(fn(x) { x * 2 }, [1, 2, 3])", []interface{}{2, 4, 6}},
+		{`apply(len, ["a", "bc"])`, []interface{}{1, 2}},
+		{"let base = 10; apply(fn(x) { base + x }, [1])", []interface{}{11}},
+		{"apply(fn(x) { x / 0 }, [1])", "division by zero"},
+		{"apply(fn(x, y) { x }, [1])", "wrong number of arguments to `<anonymous>`. got=1, want=2"},
+		{"try { apply(fn(x) { throw x }, [7]) } catch (e) { e[\"value\"] }", 7},
+	} {
+		t.Run(fmt.Sprintf("Test builtin calling back %s", test.input), func(t *testing.T) {
+			program := parser.New(lexer.New(test.input)).ParseProgram()
+			env := object.NewEnvironment()
+			env.Set("apply", apply)
+
+			evaluated := Eval(program, env)
+			switch expected := test.expected.(type) {
+			case int:
+				eq(t, true, testIntegerObj(t, evaluated, int64(expected)))
+			case string:
+				eq(t, true, testErrorObj(t, evaluated, expected))
+			case []interface{}:
+				eq(t, true, testArrayObj(t, evaluated, expected))
+			}
+		})
+	}
+
+	fn := testEval("fn(a, b) { a - b }")
+	result := CallFunction(object.NewEnvironment(), fn, &object.Integer{Value: 5}, &object.Integer{Value: 3})
+	eq(t, true, testIntegerObj(t, result, 2))
+}
+
 func Test_ArrayLiterals(t *testing.T) {
 	input := `[1, 2 * 3, "asdf", true]`
 
@@ -432,7 +877,7 @@ func Test_HashLiteral(t *testing.T) {
 		expected interface{}
 	}{
 		{`let a = {"a": 1}; a["a"]`, 1},
-		{`let b = "b", {"b": 2}[b]`, 2},
+		{`let b = "b"; {"b": 2}[b]`, 2},
 		{`let a = fn(){}; {a: 1}`, "key of type FUNCTION is not hashable"},
 		{`let a = {"a": 1}; a[fn(){}]`, "index of type FUNCTION cannot be used as hash index"},
 	} {
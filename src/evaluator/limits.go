@@ -0,0 +1,86 @@
+package evaluator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"sudocoding.xyz/interpreter_in_go/src/object"
+	"sudocoding.xyz/interpreter_in_go/src/parser/ast"
+)
+
+// ErrLimitExceeded - cause of the errors stopping a program that ran out of
+// steps, nested calls too deep or whose context is done. The cause also wraps
+// the error of the context.
+var ErrLimitExceeded = errors.New("limit exceeded")
+
+// contextCheckInterval - number of steps between two checks of the context
+const contextCheckInterval = 1024
+
+// EvalContext - evaluates the node like Eval, stopping once the context is
+// done. Limits are given to `env` if it has none.
+func EvalContext(ctx context.Context, node ast.Node, env *object.Environment) object.Object {
+	limits := env.Limits()
+	if limits == nil {
+		limits = &object.Limits{}
+		env.SetLimits(limits)
+	}
+
+	limits.Reset(ctx)
+	defer limits.Reset(nil)
+
+	return Eval(node, env)
+}
+
+// step - counts one more evaluation step, returning the error stopping the
+// program if it exceeded its limits. Once a limit is exceeded every step
+// fails, until the limits are reset.
+func step(limits *object.Limits) *object.Error {
+	if limits.Tripped != nil {
+		return limitError(limits.Tripped)
+	}
+
+	limits.Steps += 1
+
+	if limits.MaxSteps > 0 && limits.Steps > limits.MaxSteps {
+		return trip(limits, fmt.Errorf("%w: more than %d steps", ErrLimitExceeded, limits.MaxSteps))
+	}
+
+	if limits.Context != nil && limits.Steps%contextCheckInterval == 1 {
+		if err := limits.Context.Err(); err != nil {
+			return trip(limits, fmt.Errorf("%w: %w", ErrLimitExceeded, err))
+		}
+	}
+
+	return nil
+}
+
+// enterCall - counts one more nested function call, returning the error
+// stopping the program if calls are nested too deep. Calls entered must be
+// left with leaveCall.
+func enterCall(limits *object.Limits) *object.Error {
+	if limits.Tripped != nil {
+		return limitError(limits.Tripped)
+	}
+
+	if limits.MaxDepth > 0 && limits.Depth >= limits.MaxDepth {
+		return trip(limits, fmt.Errorf("%w: more than %d nested calls", ErrLimitExceeded, limits.MaxDepth))
+	}
+
+	limits.Depth += 1
+	return nil
+}
+
+func leaveCall(limits *object.Limits) {
+	limits.Depth -= 1
+}
+
+// trip - notes the limit the program exceeded, so that it stays stopped
+func trip(limits *object.Limits, err error) *object.Error {
+	limits.Tripped = err
+	return limitError(err)
+}
+
+func limitError(err error) *object.Error {
+	return &object.Error{Message: err.Error(), Limit: err}
+}
@@ -2,7 +2,6 @@ package evaluator
 
 import (
 	"fmt"
-	"strings"
 	"testing"
 
 	"sudocoding.xyz/interpreter_in_go/src/lexer"
@@ -12,7 +11,7 @@ import (
 )
 
 func testParseProgram(input string) *ast.Program {
-	l := lexer.New_V2(strings.NewReader(input))
+	l := lexer.New(input)
 	p := parser.New(l)
 	return p.ParseProgram()
 }
@@ -52,6 +52,16 @@ func convertObjectToAstNode(obj object.Object) ast.Node {
 			Token: token.Token{Type: token.INT, Literal: fmt.Sprintf("%d", obj.Value)},
 			Value: obj.Value,
 		}
+	case *object.BigInteger:
+		return &ast.BigIntegerLiteral{
+			Token: token.Token{Type: token.INT, Literal: obj.Inspect()},
+			Value: obj.Value,
+		}
+	case *object.Float:
+		return &ast.FloatLiteral{
+			Token: token.Token{Type: token.FLOAT, Literal: obj.Inspect()},
+			Value: obj.Value,
+		}
 	case *object.Boolean:
 		var t token.Token
 		if obj.Value {
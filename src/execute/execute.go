@@ -3,35 +3,92 @@ package execute
 import (
 	"fmt"
 	"os"
+	"path/filepath"
+	"strings"
 
-	"sudocoding.xyz/interpreter_in_go/src/evaluator"
-	"sudocoding.xyz/interpreter_in_go/src/lexer"
-	"sudocoding.xyz/interpreter_in_go/src/object"
-	"sudocoding.xyz/interpreter_in_go/src/parser"
+	"sudocoding.xyz/interpreter_in_go/src/compiler"
+	"sudocoding.xyz/interpreter_in_go/src/monkie"
+	"sudocoding.xyz/interpreter_in_go/src/parser/ast"
 )
 
-func Execute(filepath string) {
-	file, err := os.Open(filepath)
+// CompiledExt - extension of the files written by Compile, run on the VM
+const CompiledExt = ".monkiec"
+
+// Execute - runs the file, compiled or not
+func Execute(path string, options ...monkie.Option) {
+	interpreter := monkie.New(options...)
+
+	run := interpreter.EvalFile
+	if strings.HasSuffix(path, CompiledExt) {
+		run = interpreter.EvalCompiledFile
+	}
+
+	if _, err := run(path); err != nil {
+		interpreter.Report(err)
+		os.Exit(1)
+	}
+}
+
+// DumpAST - writes the program the file runs to stdout, its macros expanded
+// and optimized, one top level statement per line
+func DumpAST(path string, options ...monkie.Option) {
+	interpreter := monkie.New(options...)
+
+	program, err := interpreter.ParseFile(path)
 	if err != nil {
-		panic(err)
+		interpreter.Report(err)
+		os.Exit(1)
+	}
+
+	for _, statement := range program.(*ast.Program).Statements {
+		fmt.Println(statement.String())
 	}
+}
 
-	l := lexer.New_V2(file)
-	p := parser.New(l)
-	program := p.ParseProgram()
+// Disasm - compiles the file for the VM and writes the disassembled bytecode
+// to stdout, along with the source lines it comes from
+func Disasm(path string) {
+	interpreter := monkie.New(monkie.WithBackend(monkie.VM))
 
-	if len(p.Errors()) > 0 {
-		panic(p.Errors())
+	src, err := os.ReadFile(path)
+	if err != nil {
+		interpreter.Report(err)
+		os.Exit(1)
 	}
 
-	env := object.NewEnvironment()
-	macroEnv := object.NewEnvironment()
+	bytecode, err := interpreter.CompileFile(path)
+	if err != nil {
+		interpreter.Report(err)
+		os.Exit(1)
+	}
+
+	compiler.Disassemble(os.Stdout, bytecode, string(src))
+}
 
-	evaluator.DefineMacros(program, macroEnv)
-	expanded := evaluator.ExpandMacros(program, macroEnv)
+// Compile - compiles the file for the VM and writes the program to `out`,
+// next to the file with the CompiledExt extension if `out` is empty
+func Compile(path, out string) {
+	interpreter := monkie.New(monkie.WithBackend(monkie.VM))
 
-	switch result := evaluator.Eval(expanded, env).(type) {
-	case *object.Error:
-		fmt.Println("Error Occured: ", result.Message)
+	bytecode, err := interpreter.CompileFile(path)
+	if err != nil {
+		interpreter.Report(err)
+		os.Exit(1)
+	}
+
+	if out == "" {
+		out = strings.TrimSuffix(path, filepath.Ext(path)) + CompiledExt
+	}
+
+	file, err := os.Create(out)
+	if err == nil {
+		err = compiler.Encode(file, bytecode)
+		if closeErr := file.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	if err != nil {
+		interpreter.Report(err)
+		os.Exit(1)
 	}
 }
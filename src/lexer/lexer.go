@@ -1,111 +1,249 @@
 package lexer
 
-import "sudocoding.xyz/interpreter_in_go/src/token"
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"unicode"
 
-// Lexer - Contains the lexer struct to parse input to tokens
+	"sudocoding.xyz/interpreter_in_go/src/diagnostic"
+	"sudocoding.xyz/interpreter_in_go/src/token"
+)
+
+// Diagnostic codes reported by the lexer
+const (
+	ErrIllegalCharacter    diagnostic.Code = "L0001"
+	ErrUnterminatedString  diagnostic.Code = "L0002"
+	ErrUnterminatedComment diagnostic.Code = "L0003"
+	ErrInvalidEscape       diagnostic.Code = "L0004"
+)
+
+// Lexer - reads the tokens of Monkie source code, rune by rune. The source is
+// consumed as tokens are requested, so large inputs are never fully loaded.
 type Lexer struct {
-	input        string // input will be read as ASCII (byte) instead of Unicode (rune)
-	position     int    // current position in input (points to current char)
-	readPosition int    // current reading position in input (after current char)
-	ch           byte   // current char under examination
+	input *bufio.Reader
+	ch    rune
+	size  int                      // size of `ch` in bytes, 0 at the end of the input
+	pos   token.Position           // position of `ch` in the input
+	src   strings.Builder          // source read so far, used to render snippets
+	errs  []*diagnostic.Diagnostic // errors found while reading tokens
+
+	// braces opened inside each `${ }` of the interpolated strings being
+	// read, innermost last. The `}` closing a `${` resumes its string.
+	templates []int
 }
 
-// New - creates a new lexer for for input and starts off by reading the the
-// first character
+// New - creates a lexer reading the given source code
 func New(input string) *Lexer {
-	l := &Lexer{input: input}
+	return NewFile("", strings.NewReader(input))
+}
+
+// NewReader - creates a lexer reading the source code from `reader`
+func NewReader(reader io.Reader) *Lexer {
+	return NewFile("", reader)
+}
+
+// NewFile - creates a lexer whose token positions are reported against
+// the given file name
+func NewFile(filename string, reader io.Reader) *Lexer {
+	l := &Lexer{
+		input: bufio.NewReader(reader),
+		pos:   token.Position{Filename: filename, Line: 1, Column: 1},
+	}
 	l.readChar()
 	return l
 }
 
-// NextToken - reads the token in the current postion and returns it
-// and moved the position to the beginning of the next token
+// NextToken - reads the next token and stamps it with the span of the
+// source it was read from
 func (l *Lexer) NextToken() token.Token {
-	var tok token.Token
+	doc := l.skipTrivia()
+
+	start := l.pos
+	tok := l.readToken()
+	tok.Pos = start
+	tok.End = l.pos
+	tok.Doc = doc
+
+	return tok
+}
+
+// Errors - returns the errors found in the tokens read so far
+func (l *Lexer) Errors() []*diagnostic.Diagnostic {
+	return l.errs
+}
+
+// Source - returns the source code read so far
+func (l *Lexer) Source() string {
+	return l.src.String()
+}
 
-	l.skipWhitespace()
+// errorAt - records an error about the character at `pos`
+func (l *Lexer) errorAt(code diagnostic.Code, pos token.Position, size int, format string, a ...interface{}) {
+	end := pos
+	end.Offset += size
+	end.Column += 1
+
+	l.errs = append(l.errs, &diagnostic.Diagnostic{
+		Severity: diagnostic.Error,
+		Code:     code,
+		Message:  fmt.Sprintf(format, a...),
+		Pos:      pos,
+		End:      end,
+	})
+}
+
+func (l *Lexer) readToken() token.Token {
+	var tok token.Token
 
 	switch l.ch {
-	case '=':
-		if l.peekChar() == '=' {
+	case rune('='):
+		if l.peekChar() == rune('=') {
 			ch := l.ch
 			l.readChar()
-			literal := string([]byte{ch, l.ch})
+			literal := string([]rune{ch, l.ch})
 
 			tok = token.Token{Type: token.EQ, Literal: literal}
 		} else {
 			tok = token.Token{Type: token.ASSIGN, Literal: string(l.ch)}
 		}
-	case '+':
+	case rune('+'):
 		tok = token.Token{Type: token.PLUS, Literal: string(l.ch)}
-	case '(':
+	case rune('('):
 		tok = token.Token{Type: token.LPAREN, Literal: string(l.ch)}
-	case ')':
+	case rune(')'):
 		tok = token.Token{Type: token.RPAREN, Literal: string(l.ch)}
-	case '{':
+	case rune('{'):
+		if n := len(l.templates); n > 0 {
+			l.templates[n-1] += 1
+		}
 		tok = token.Token{Type: token.LBRACE, Literal: string(l.ch)}
-	case '}':
-		tok = token.Token{Type: token.RBRACE, Literal: string(l.ch)}
-	case ',':
+	case rune('}'):
+		if n := len(l.templates); n > 0 && l.templates[n-1] == 0 {
+			l.templates = l.templates[:n-1]
+			tok = l.readStr()
+		} else {
+			if n > 0 {
+				l.templates[n-1] -= 1
+			}
+			tok = token.Token{Type: token.RBRACE, Literal: string(l.ch)}
+		}
+	case rune('['):
+		tok = token.Token{Type: token.LBRACKET, Literal: string(l.ch)}
+	case rune(']'):
+		tok = token.Token{Type: token.RBRACKET, Literal: string(l.ch)}
+	case rune(','):
 		tok = token.Token{Type: token.COMMA, Literal: string(l.ch)}
-	case ';':
+	case rune(':'):
+		tok = token.Token{Type: token.COLON, Literal: string(l.ch)}
+	case rune(';'):
 		tok = token.Token{Type: token.SEMICOLON, Literal: string(l.ch)}
-	case '-':
+	case rune('-'):
 		tok = token.Token{Type: token.MINUS, Literal: string(l.ch)}
-	case '*':
-		tok = token.Token{Type: token.ASTERISK, Literal: string(l.ch)}
-	case '/':
+	case rune('*'):
+		if l.peekChar() == rune('*') {
+			ch := l.ch
+			l.readChar()
+			literal := string([]rune{ch, l.ch})
+
+			tok = token.Token{Type: token.POWER, Literal: literal}
+		} else {
+			tok = token.Token{Type: token.ASTERISK, Literal: string(l.ch)}
+		}
+	case rune('/'):
 		tok = token.Token{Type: token.SLASH, Literal: string(l.ch)}
-	case '!':
-		if l.peekChar() == '=' {
+	case rune('&'):
+		if l.peekChar() == rune('&') {
+			ch := l.ch
+			l.readChar()
+			literal := string([]rune{ch, l.ch})
+
+			tok = token.Token{Type: token.AND, Literal: literal}
+		} else {
+			tok = token.Token{Type: token.BIT_AND, Literal: string(l.ch)}
+		}
+	case rune('|'):
+		if l.peekChar() == rune('|') {
 			ch := l.ch
 			l.readChar()
-			literal := string([]byte{ch, l.ch})
+			literal := string([]rune{ch, l.ch})
+
+			tok = token.Token{Type: token.OR, Literal: literal}
+		} else {
+			tok = token.Token{Type: token.BIT_OR, Literal: string(l.ch)}
+		}
+	case rune('^'):
+		tok = token.Token{Type: token.BIT_XOR, Literal: string(l.ch)}
+	case rune('%'):
+		tok = token.Token{Type: token.PERCENT, Literal: string(l.ch)}
+	case rune('~'):
+		if l.peekChar() == rune('/') {
+			ch := l.ch
+			l.readChar()
+			literal := string([]rune{ch, l.ch})
+
+			tok = token.Token{Type: token.FLOOR_DIV, Literal: literal}
+		} else {
+			tok = token.Token{Type: token.BIT_NOT, Literal: string(l.ch)}
+		}
+	case rune('!'):
+		if l.peekChar() == rune('=') {
+			ch := l.ch
+			l.readChar()
+			literal := string([]rune{ch, l.ch})
 
 			tok = token.Token{Type: token.NOT_EQ, Literal: literal}
 		} else {
 			tok = token.Token{Type: token.BANG, Literal: string(l.ch)}
 		}
-	case '>':
-		if l.peekChar() == '=' {
+	case rune('>'):
+		if l.peekChar() == rune('=') {
 			ch := l.ch
 			l.readChar()
-			literal := string([]byte{ch, l.ch})
+			literal := string([]rune{ch, l.ch})
 
 			tok = token.Token{Type: token.GTE, Literal: literal}
+		} else if l.peekChar() == rune('>') {
+			ch := l.ch
+			l.readChar()
+			literal := string([]rune{ch, l.ch})
+
+			tok = token.Token{Type: token.SHR, Literal: literal}
 		} else {
 			tok = token.Token{Type: token.GT, Literal: string(l.ch)}
 		}
-	case '<':
-		if l.peekChar() == '=' {
+	case rune('<'):
+		if l.peekChar() == rune('=') {
 			ch := l.ch
 			l.readChar()
-			literal := string([]byte{ch, l.ch})
+			literal := string([]rune{ch, l.ch})
 
 			tok = token.Token{Type: token.LTE, Literal: literal}
+		} else if l.peekChar() == rune('<') {
+			ch := l.ch
+			l.readChar()
+			literal := string([]rune{ch, l.ch})
+
+			tok = token.Token{Type: token.SHL, Literal: literal}
 		} else {
 			tok = token.Token{Type: token.LT, Literal: string(l.ch)}
 		}
-	case '"':
-		if str, ok := l.readStr(); ok {
-			tok = token.Token{Type: token.STR, Literal: str}
-		} else {
-			tok = token.Token{Type: token.ILLEGAL, Literal: string(l.ch)}
-		}
-	case 0:
-		tok = token.Token{Type: token.EOF, Literal: ""}
+	case rune('"'), rune('`'):
+		tok = l.readStr()
+	case rune(0):
+		tok = token.Token{Type: token.EOF, Literal: string(l.ch)}
 	default:
 		if isLetter(l.ch) {
-			tok.Literal = l.readIdentifier()
+			tok.Literal = l.readGroup(isLetter)
 			tok.Type = token.LookupIdent(tok.Literal)
-
 			return tok
-		} else if isDigit(l.ch) {
-			tok.Type = token.INT
-			tok.Literal = l.readNumber()
-
+		} else if isDigit(l.ch) || l.ch == rune('.') && isDigit(l.peekChar()) {
+			tok.Literal, tok.Type = l.readNumber()
 			return tok
 		} else {
+			l.errorAt(ErrIllegalCharacter, l.pos, l.size, "illegal character %q", l.ch)
 			tok = token.Token{Type: token.ILLEGAL, Literal: string(l.ch)}
 		}
 	}
@@ -114,86 +252,282 @@ func (l *Lexer) NextToken() token.Token {
 	return tok
 }
 
-// peekChar - returns the character at the `readPosition`. 0 if at the end of
-// the input. Doesn't modify the lexer object
-func (l *Lexer) peekChar() byte {
-	if l.readPosition >= len(l.input) {
-		return 0
+func (l *Lexer) peekChar() rune {
+	ch, _, err := l.input.ReadRune()
+	if err != nil {
+		ch = rune(0)
+	} else {
+		l.input.UnreadRune()
 	}
 
-	return l.input[l.readPosition]
+	return ch
+}
+
+// peekBytes - returns up to `n` bytes following the current character
+// without consuming them
+func (l *Lexer) peekBytes(n int) []byte {
+	peeked, _ := l.input.Peek(n)
+	return peeked
 }
 
-// readChar - updates `ch` to the character in `readPosition`.
-// sets `ch` to `0` if `readPosition` is out of bound in input
-// updates `positon` to `readPosition` and increments `readPosition` by `1`.
 func (l *Lexer) readChar() {
-	if l.readPosition >= len(l.input) {
-		l.ch = 0 // `NUL` in ASCII
+	l.advancePos()
+
+	ch, size, err := l.input.ReadRune()
+	if err != nil {
+		ch = rune(0)
+		size = 0
+	}
+
+	l.ch = ch
+	l.size = size
+
+	if size > 0 {
+		l.src.WriteRune(ch)
+	}
+}
+
+// advancePos - moves `pos` past the current character. Nothing moves once
+// the end of the input is reached.
+func (l *Lexer) advancePos() {
+	if l.size == 0 {
+		return
+	}
+
+	l.pos.Offset += l.size
+	if l.ch == rune('\n') {
+		l.pos.Line += 1
+		l.pos.Column = 1
 	} else {
-		l.ch = l.input[l.readPosition]
+		l.pos.Column += 1
 	}
+}
+
+// readStr - reads a string literal and leaves `ch` on the last character
+// of its closing delimiter. Strings in `"` and `"""` may hold escape
+// sequences, the latter span multiple lines and get their indentation
+// stripped. Raw strings in backticks are taken verbatim.
+// A `${` in a `"` string stops the reading, the embedded expression is read
+// as regular tokens and the `}` closing it resumes the string, see STR_HEAD.
+func (l *Lexer) readStr() token.Token {
+	start := l.pos
+	delim, kind := string(l.ch), "string literal"
+	tokType := token.TokenType(token.STR)
 
-	l.position = l.readPosition
-	l.readPosition += 1
+	if l.ch == rune('}') {
+		delim, tokType = `"`, token.STR_TAIL
+	} else if l.ch == rune('`') {
+		kind = "raw string literal"
+	} else if bytes.Equal(l.peekBytes(2), []byte(`""`)) {
+		delim, kind = `"""`, "multi-line string literal"
+		l.readChar()
+		l.readChar()
+	}
+
+	var raw strings.Builder
+	escapes := []token.Position{}
+	offsets := []int{}
+
+	for {
+		l.readChar()
+
+		if l.ch == rune(0) {
+			l.errorAt(ErrUnterminatedString, start, len(delim), "unterminated %s", kind)
+			return token.Token{Type: token.ILLEGAL, Literal: delim + raw.String()}
+		}
+
+		if l.ch == rune(delim[0]) && (len(delim) == 1 || bytes.Equal(l.peekBytes(2), []byte(`""`))) {
+			for i := 1; i < len(delim); i++ {
+				l.readChar()
+			}
+			break
+		}
+
+		if delim == `"` && l.ch == rune('$') && l.peekChar() == rune('{') {
+			l.readChar()
+			l.templates = append(l.templates, 0)
+
+			if tokType == token.STR {
+				tokType = token.STR_HEAD
+			} else {
+				tokType = token.STR_MID
+			}
+			break
+		}
+
+		raw.WriteRune(l.ch)
+		if l.ch == rune('\\') && delim != "`" && l.peekChar() != rune(0) {
+			escapes = append(escapes, l.pos)
+			offsets = append(offsets, raw.Len()-1)
+
+			l.readChar()
+			raw.WriteRune(l.ch)
+		}
+	}
+
+	str := raw.String()
+	if delim == "`" {
+		return token.Token{Type: token.STR, Literal: str}
+	}
+
+	for i, pos := range escapes {
+		if _, size, msg := decodeEscape(str[offsets[i]:]); msg != "" {
+			l.errorAt(ErrInvalidEscape, pos, size, "%s", msg)
+		}
+	}
+
+	if delim == `"""` {
+		str = dedent(str)
+	}
+	return token.Token{Type: tokType, Literal: unescape(str)}
 }
 
-// readIdentifier - keeps reading char till non letter (based on `isLetter` func)
-// is reached and returns the sequence of chars read.
-func (l *Lexer) readIdentifier() string {
-	position := l.position
+// readNumber - reads an integer or a float literal. Floats have a fraction
+// (`1.5`, `.5`), an exponent (`2e10`, `1e-3`) or both. Integers may have a
+// base prefix (`0xFF`, `0o755`, `0b1010`) and digits may be separated by `_`
+// (`1_000_000`). Whether the digits suit the base is left to the parser.
+func (l *Lexer) readNumber() (string, token.TokenType) {
+	var out bytes.Buffer
+	tokType := token.TokenType(token.INT)
 
-	for isLetter(l.ch) {
+	if l.ch == rune('0') && strings.ContainsRune("xXoObB", l.peekChar()) {
+		out.WriteString(l.readGroup(isAlphanumeric))
+		return out.String(), tokType
+	}
+
+	out.WriteString(l.readGroup(isDigitOrSeparator))
+
+	if l.ch == rune('.') && isDigit(l.peekChar()) {
+		tokType = token.FLOAT
+		out.WriteRune(l.ch)
 		l.readChar()
+		out.WriteString(l.readGroup(isDigitOrSeparator))
+	}
+
+	if l.ch == rune('e') || l.ch == rune('E') {
+		next := l.peekBytes(2)
+		signed := len(next) == 2 && (next[0] == '+' || next[0] == '-') && isDigit(rune(next[1]))
+
+		if signed || len(next) > 0 && isDigit(rune(next[0])) {
+			tokType = token.FLOAT
+			out.WriteRune(l.ch)
+			l.readChar()
+
+			if signed {
+				out.WriteRune(l.ch)
+				l.readChar()
+			}
+			out.WriteString(l.readGroup(isDigitOrSeparator))
+		}
 	}
 
-	return l.input[position:l.position]
+	return out.String(), tokType
 }
 
-// readNumber - keeps reading char till non number (base on `isDigit` func) is
-// reached and returns the sequence of numbers read.
-func (l *Lexer) readNumber() string {
-	position := l.position
+func (l *Lexer) readGroup(filterFn func(ch rune) bool) string {
+	var idBuffer bytes.Buffer
 
-	for isDigit(l.ch) {
+	for filterFn(l.ch) {
+		idBuffer.WriteRune(l.ch)
 		l.readChar()
 	}
 
-	return l.input[position:l.position]
+	return idBuffer.String()
 }
 
-// readStr - for string data type, skips the opening " reads the charracters till
-// the end " is reached. If no closing " is reached then returns ok as false
-func (l *Lexer) readStr() (string, bool) {
-	l.readChar()
-	position := l.position
+func (l *Lexer) skipWhitespace() {
+	for unicode.IsSpace(l.ch) {
+		l.readChar()
+	}
+}
+
+// skipTrivia - skips whitespace and comments till the start of the next
+// token. Returns the doc comments found on the way, nil if there were none.
+func (l *Lexer) skipTrivia() *token.CommentGroup {
+	var doc *token.CommentGroup
+
+	for {
+		l.skipWhitespace()
+
+		switch {
+		case l.ch == rune('#'):
+			l.readLine()
+		case l.ch == rune('/') && l.peekChar() == rune('/'):
+			start := l.pos
+			l.readChar()
+			l.readChar()
 
-	for l.ch != '"' {
-		if l.ch == 0 {
-			return "", false
+			if l.ch != rune('/') {
+				l.readLine()
+				continue
+			}
+
+			l.readChar()
+			comment := &token.Comment{Text: l.readLine(), Pos: start, End: l.pos}
+
+			if doc == nil {
+				doc = &token.CommentGroup{}
+			}
+			doc.List = append(doc.List, comment)
+		case l.ch == rune('/') && l.peekChar() == rune('*'):
+			l.skipBlockComment()
+		default:
+			return doc
 		}
+	}
+}
+
+// readLine - reads till the end of the line and returns what was read,
+// without the line break
+func (l *Lexer) readLine() string {
+	var out bytes.Buffer
+
+	for l.ch != rune('\n') && l.ch != rune(0) {
+		out.WriteRune(l.ch)
 		l.readChar()
 	}
 
-	return l.input[position:l.position], true
+	return strings.TrimSuffix(out.String(), "\r")
 }
 
-// skipWhitespace - skips all whitespace characters (\s \n \t \r) and moves the
-// `position` to the next non-whitespace character.
-func (l *Lexer) skipWhitespace() {
-	for l.ch == ' ' || l.ch == '\t' || l.ch == '\n' || l.ch == '\r' {
+// skipBlockComment - skips a `/* */` comment. Block comments nest, so
+// `/* a /* b */ c */` is a single comment.
+func (l *Lexer) skipBlockComment() {
+	start := l.pos
+	depth := 0
+
+	for {
+		switch {
+		case l.ch == rune(0):
+			l.errorAt(ErrUnterminatedComment, start, 1, "unterminated block comment")
+			return
+		case l.ch == rune('/') && l.peekChar() == rune('*'):
+			depth += 1
+			l.readChar()
+		case l.ch == rune('*') && l.peekChar() == rune('/'):
+			depth -= 1
+			l.readChar()
+		}
+
 		l.readChar()
+		if depth == 0 {
+			return
+		}
 	}
 }
 
-// isLetter - returns true if a given char follows the following regex
-// `[a-zA-Z]|_`
-func isLetter(ch byte) bool {
-	return 'a' <= ch && ch <= 'z' || 'A' <= ch && ch <= 'Z' || ch == '_'
+func isLetter(ch rune) bool {
+	return unicode.IsLetter(ch) || ch == rune('_')
+}
+
+func isDigit(ch rune) bool {
+	return unicode.IsDigit(ch)
+}
+
+func isDigitOrSeparator(ch rune) bool {
+	return isDigit(ch) || ch == rune('_')
 }
 
-// isDigit - returns truw if a given char follows the following regex
-// `[0-9]`
-func isDigit(ch byte) bool {
-	return '0' <= ch && ch <= '9'
+func isAlphanumeric(ch rune) bool {
+	return isLetter(ch) || isDigit(ch)
 }
@@ -1,13 +1,14 @@
 package lexer
 
 import (
+	"strings"
 	"testing"
 
 	"sudocoding.xyz/interpreter_in_go/src/token"
 )
 
-func TestBasicNextToken(t *testing.T) {
-	input := "=+(){},;-!*/><"
+func Test_BaseNew(t *testing.T) {
+	input := strings.NewReader("=+(){},;-!*/><")
 
 	expectedTokens := []token.Token{
 		{Type: token.ASSIGN, Literal: "="},
@@ -24,10 +25,10 @@ func TestBasicNextToken(t *testing.T) {
 		{Type: token.SLASH, Literal: "/"},
 		{Type: token.GT, Literal: ">"},
 		{Type: token.LT, Literal: "<"},
-		{Type: token.EOF, Literal: ""},
+		{Type: token.EOF, Literal: "\x00"},
 	}
 
-	lexer := New(input)
+	lexer := NewReader(input)
 
 	for i, expectedToken := range expectedTokens {
 		tok := lexer.NextToken()
@@ -42,8 +43,8 @@ func TestBasicNextToken(t *testing.T) {
 	}
 }
 
-func TestNextToken(t *testing.T) {
-	input := `let five = 5;
+func Test_NextToken(t *testing.T) {
+	input := strings.NewReader(`let five = 5;
   let ten=10;
 
   let add = fn(x, y){
@@ -63,10 +64,15 @@ func TestNextToken(t *testing.T) {
   5 >= 10;
   5 <= 10;
 
+  [1, "a"];
+  {"a": 1};
+
+  macro(x,y){x+y};
+
   "abcd";
   ""
-  "asdf;
-  `
+  ";
+  `)
 
 	expectedTokens := []token.Token{
 		{Type: token.LET, Literal: "let"},
@@ -137,14 +143,357 @@ func TestNextToken(t *testing.T) {
 		{Type: token.LTE, Literal: "<="},
 		{Type: token.INT, Literal: "10"},
 		{Type: token.SEMICOLON, Literal: ";"},
+		{Type: token.LBRACKET, Literal: "["},
+		{Type: token.INT, Literal: "1"},
+		{Type: token.COMMA, Literal: ","},
+		{Type: token.STR, Literal: "a"},
+		{Type: token.RBRACKET, Literal: "]"},
+		{Type: token.SEMICOLON, Literal: ";"},
+		{Type: token.LBRACE, Literal: "{"},
+		{Type: token.STR, Literal: "a"},
+		{Type: token.COLON, Literal: ":"},
+		{Type: token.INT, Literal: "1"},
+		{Type: token.RBRACE, Literal: "}"},
+		{Type: token.SEMICOLON, Literal: ";"},
+		{Type: token.MACRO, Literal: "macro"},
+		{Type: token.LPAREN, Literal: "("},
+		{Type: token.IDENT, Literal: "x"},
+		{Type: token.COMMA, Literal: ","},
+		{Type: token.IDENT, Literal: "y"},
+		{Type: token.RPAREN, Literal: ")"},
+		{Type: token.LBRACE, Literal: "{"},
+		{Type: token.IDENT, Literal: "x"},
+		{Type: token.PLUS, Literal: "+"},
+		{Type: token.IDENT, Literal: "y"},
+		{Type: token.RBRACE, Literal: "}"},
+		{Type: token.SEMICOLON, Literal: ";"},
 		{Type: token.STR, Literal: "abcd"},
 		{Type: token.SEMICOLON, Literal: ";"},
 		{Type: token.STR, Literal: ""},
-		{Type: token.ILLEGAL, Literal: "\x00"},
-		{Type: token.EOF, Literal: ""},
+		{Type: token.ILLEGAL, Literal: "\";\n  "},
+		{Type: token.EOF, Literal: "\x00"},
+	}
+
+	lexer := NewReader(input)
+
+	for i, expectedToken := range expectedTokens {
+		tok := lexer.NextToken()
+
+		if tok.Type != expectedToken.Type {
+			t.Fatalf("test[%d] - tokentype wrong. expected=%q, got=%q", i, expectedToken.Type, tok.Type)
+		}
+
+		if tok.Literal != expectedToken.Literal {
+			t.Fatalf("test[%d] - literal wrong. expected=%q, got=%q", i, expectedToken.Literal, tok.Literal)
+		}
+	}
+}
+
+func Test_TokenPositions(t *testing.T) {
+	input := strings.NewReader("let café = 5;\n  add(x)")
+
+	expectedSpans := []struct {
+		literal string
+		pos     token.Position
+		end     token.Position
+	}{
+		{"let", token.Position{Filename: "a.monkie", Offset: 0, Line: 1, Column: 1}, token.Position{Filename: "a.monkie", Offset: 3, Line: 1, Column: 4}},
+		{"café", token.Position{Filename: "a.monkie", Offset: 4, Line: 1, Column: 5}, token.Position{Filename: "a.monkie", Offset: 9, Line: 1, Column: 9}},
+		{"=", token.Position{Filename: "a.monkie", Offset: 10, Line: 1, Column: 10}, token.Position{Filename: "a.monkie", Offset: 11, Line: 1, Column: 11}},
+		{"5", token.Position{Filename: "a.monkie", Offset: 12, Line: 1, Column: 12}, token.Position{Filename: "a.monkie", Offset: 13, Line: 1, Column: 13}},
+		{";", token.Position{Filename: "a.monkie", Offset: 13, Line: 1, Column: 13}, token.Position{Filename: "a.monkie", Offset: 14, Line: 1, Column: 14}},
+		{"add", token.Position{Filename: "a.monkie", Offset: 17, Line: 2, Column: 3}, token.Position{Filename: "a.monkie", Offset: 20, Line: 2, Column: 6}},
+		{"(", token.Position{Filename: "a.monkie", Offset: 20, Line: 2, Column: 6}, token.Position{Filename: "a.monkie", Offset: 21, Line: 2, Column: 7}},
+		{"x", token.Position{Filename: "a.monkie", Offset: 21, Line: 2, Column: 7}, token.Position{Filename: "a.monkie", Offset: 22, Line: 2, Column: 8}},
+		{")", token.Position{Filename: "a.monkie", Offset: 22, Line: 2, Column: 8}, token.Position{Filename: "a.monkie", Offset: 23, Line: 2, Column: 9}},
+	}
+
+	lexer := NewFile("a.monkie", input)
+
+	for i, expected := range expectedSpans {
+		tok := lexer.NextToken()
+
+		if tok.Literal != expected.literal {
+			t.Fatalf("test[%d] - literal wrong. expected=%q, got=%q", i, expected.literal, tok.Literal)
+		}
+
+		if tok.Pos != expected.pos {
+			t.Fatalf("test[%d] - pos wrong. expected=%+v, got=%+v", i, expected.pos, tok.Pos)
+		}
+
+		if tok.End != expected.end {
+			t.Fatalf("test[%d] - end wrong. expected=%+v, got=%+v", i, expected.end, tok.End)
+		}
+	}
+
+	eof := lexer.NextToken()
+	if eof.Type != token.EOF || eof.Pos.Offset != 23 {
+		t.Fatalf("expected EOF at offset 23, got=%+v", eof)
+	}
+}
+
+func Test_Numbers(t *testing.T) {
+	input := strings.NewReader("5 1.5 .5 2e10 1.5E-3 3e+2 1e 7.x")
+
+	expectedTokens := []token.Token{
+		{Type: token.INT, Literal: "5"},
+		{Type: token.FLOAT, Literal: "1.5"},
+		{Type: token.FLOAT, Literal: ".5"},
+		{Type: token.FLOAT, Literal: "2e10"},
+		{Type: token.FLOAT, Literal: "1.5E-3"},
+		{Type: token.FLOAT, Literal: "3e+2"},
+		{Type: token.INT, Literal: "1"},
+		{Type: token.IDENT, Literal: "e"},
+		{Type: token.INT, Literal: "7"},
+		{Type: token.ILLEGAL, Literal: "."},
+		{Type: token.IDENT, Literal: "x"},
+		{Type: token.EOF, Literal: "\x00"},
+	}
+
+	lexer := NewReader(input)
+
+	for i, expectedToken := range expectedTokens {
+		tok := lexer.NextToken()
+
+		if tok.Type != expectedToken.Type {
+			t.Fatalf("test[%d] - tokentype wrong. expected=%q, got=%q", i, expectedToken.Type, tok.Type)
+		}
+
+		if tok.Literal != expectedToken.Literal {
+			t.Fatalf("test[%d] - literal wrong. expected=%q, got=%q", i, expectedToken.Literal, tok.Literal)
+		}
+	}
+}
+
+func Test_ArithmeticOperators(t *testing.T) {
+	input := strings.NewReader("7 % 2 ** 3 ~/ 4 * 5 ~1")
+
+	expectedTokens := []token.Token{
+		{Type: token.INT, Literal: "7"},
+		{Type: token.PERCENT, Literal: "%"},
+		{Type: token.INT, Literal: "2"},
+		{Type: token.POWER, Literal: "**"},
+		{Type: token.INT, Literal: "3"},
+		{Type: token.FLOOR_DIV, Literal: "~/"},
+		{Type: token.INT, Literal: "4"},
+		{Type: token.ASTERISK, Literal: "*"},
+		{Type: token.INT, Literal: "5"},
+		{Type: token.BIT_NOT, Literal: "~"},
+		{Type: token.INT, Literal: "1"},
+	}
+
+	lexer := NewReader(input)
+
+	for i, expectedToken := range expectedTokens {
+		tok := lexer.NextToken()
+
+		if tok.Type != expectedToken.Type {
+			t.Fatalf("test[%d] - tokentype wrong. expected=%q, got=%q", i, expectedToken.Type, tok.Type)
+		}
+
+		if tok.Literal != expectedToken.Literal {
+			t.Fatalf("test[%d] - literal wrong. expected=%q, got=%q", i, expectedToken.Literal, tok.Literal)
+		}
+	}
+}
+
+func Test_LogicalOperators(t *testing.T) {
+	input := strings.NewReader("a && b || c & d")
+
+	expectedTokens := []token.Token{
+		{Type: token.IDENT, Literal: "a"},
+		{Type: token.AND, Literal: "&&"},
+		{Type: token.IDENT, Literal: "b"},
+		{Type: token.OR, Literal: "||"},
+		{Type: token.IDENT, Literal: "c"},
+		{Type: token.BIT_AND, Literal: "&"},
+		{Type: token.IDENT, Literal: "d"},
+	}
+
+	lexer := NewReader(input)
+
+	for i, expectedToken := range expectedTokens {
+		tok := lexer.NextToken()
+
+		if tok.Type != expectedToken.Type {
+			t.Fatalf("test[%d] - tokentype wrong. expected=%q, got=%q", i, expectedToken.Type, tok.Type)
+		}
+
+		if tok.Literal != expectedToken.Literal {
+			t.Fatalf("test[%d] - literal wrong. expected=%q, got=%q", i, expectedToken.Literal, tok.Literal)
+		}
+	}
+}
+
+func Test_Comments(t *testing.T) {
+	input := strings.NewReader(`# shebang-like comment
+let a = 1; // trailing comment
+/* block /* nested */ still comment */ a / 2;
+/// Adds two numbers.
+///
+///  Indented line.
+// plain comment between
+let add = fn(x, y) { x + y };
+/**/ a`)
+
+	expected := []struct {
+		tokType token.TokenType
+		literal string
+		doc     string
+	}{
+		{token.LET, "let", ""},
+		{token.IDENT, "a", ""},
+		{token.ASSIGN, "=", ""},
+		{token.INT, "1", ""},
+		{token.SEMICOLON, ";", ""},
+		{token.IDENT, "a", ""},
+		{token.SLASH, "/", ""},
+		{token.INT, "2", ""},
+		{token.SEMICOLON, ";", ""},
+		{token.LET, "let", "Adds two numbers.\n\n Indented line."},
+		{token.IDENT, "add", ""},
+	}
+
+	lexer := NewReader(input)
+
+	for i, exp := range expected {
+		tok := lexer.NextToken()
+
+		if tok.Type != exp.tokType {
+			t.Fatalf("test[%d] - tokentype wrong. expected=%q, got=%q", i, exp.tokType, tok.Type)
+		}
+
+		if tok.Literal != exp.literal {
+			t.Fatalf("test[%d] - literal wrong. expected=%q, got=%q", i, exp.literal, tok.Literal)
+		}
+
+		if tok.Doc.Text() != exp.doc {
+			t.Fatalf("test[%d] - doc wrong. expected=%q, got=%q", i, exp.doc, tok.Doc.Text())
+		}
+	}
+}
+
+func Test_UnterminatedComment(t *testing.T) {
+	lexer := New("let a = 1;\n/* open /* nested */")
+
+	for tok := lexer.NextToken(); tok.Type != token.EOF; tok = lexer.NextToken() {
+	}
+
+	errs := lexer.Errors()
+	if len(errs) != 1 {
+		t.Fatalf("expected 1 error, got=%d", len(errs))
+	}
+
+	if errs[0].Error() != "2:1: error[L0003]: unterminated block comment" {
+		t.Fatalf("wrong error. got=%q", errs[0].Error())
+	}
+}
+
+func Test_Strings(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`"a\nb\tc\r\\d\"e\'f\0"`, "a\nb\tc\r\\d\"e'f\x00"},
+		{`"\x41\x7e"`, "A~"},
+		{`"\u{1F600} \u{e9}"`, "\U0001F600 é"},
+		{"`raw \\n ${x} \"q\"`", `raw \n ${x} "q"`},
+		{"`multi\nline`", "multi\nline"},
+		{`""""""`, ""},
+		{`"""one line"""`, "one line"},
+		{"\"\"\"\n    first\n      second\n\n    third\n    \"\"\"", "first\n  second\n\nthird"},
+		{"\"\"\"\n    kept\n  \"\"\"", "  kept"},
+		{"\"\"\"\n\tescaped\\n\\ttab\n\t\"\"\"", "escaped\n\ttab"},
+		{"\"\"\"\r\n  crlf\r\n  \"\"\"", "crlf"},
+		{"\"\"\"text\n    next\n    \"\"\"", "text\nnext"},
+		{`"""has "quotes" inside"""`, `has "quotes" inside`},
+	}
+
+	for _, test := range tests {
+		lexer := New(test.input)
+		tok := lexer.NextToken()
+
+		if tok.Type != token.STR {
+			t.Fatalf("input %q - tokentype wrong. expected=%q, got=%q", test.input, token.STR, tok.Type)
+		}
+
+		if tok.Literal != test.expected {
+			t.Fatalf("input %q - literal wrong. expected=%q, got=%q", test.input, test.expected, tok.Literal)
+		}
+
+		if len(lexer.Errors()) != 0 {
+			t.Fatalf("input %q - unexpected errors: %v", test.input, lexer.Errors())
+		}
+
+		if next := lexer.NextToken(); next.Type != token.EOF {
+			t.Fatalf("input %q - expected EOF after the string, got=%q", test.input, next.Type)
+		}
+	}
+}
+
+func Test_StringErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		tokType  token.TokenType
+		expected string
+	}{
+		{`"a\qb"`, token.STR, `1:3: error[L0004]: unknown escape sequence \q`},
+		{`"\xZ1"`, token.STR, `1:2: error[L0004]: invalid escape sequence \x: \x takes 2 hex digits`},
+		{`"\u41"`, token.STR, `1:2: error[L0004]: invalid escape sequence \u: expected \u{...}`},
+		{`"\u{}"`, token.STR, `1:2: error[L0004]: invalid escape sequence \u{: expected 1 to 6 hex digits and '}'`},
+		{`"\u{110000}"`, token.STR, `1:2: error[L0004]: invalid escape sequence \u{110000}: not a valid code point`},
+		{`"\u{D800}"`, token.STR, `1:2: error[L0004]: invalid escape sequence \u{D800}: not a valid code point`},
+		{`x = "abc`, token.ILLEGAL, `1:5: error[L0002]: unterminated string literal`},
+		{`"abc\"`, token.ILLEGAL, `1:1: error[L0002]: unterminated string literal`},
+		{"`abc", token.ILLEGAL, `1:1: error[L0002]: unterminated raw string literal`},
+		{"\"\"\"abc\n\"\"", token.ILLEGAL, `1:1: error[L0002]: unterminated multi-line string literal`},
+	}
+
+	for _, test := range tests {
+		lexer := New(test.input)
+
+		tok := lexer.NextToken()
+		for ; tok.Type != token.STR && tok.Type != token.ILLEGAL; tok = lexer.NextToken() {
+		}
+
+		if tok.Type != test.tokType {
+			t.Fatalf("input %q - tokentype wrong. expected=%q, got=%q", test.input, test.tokType, tok.Type)
+		}
+
+		errs := lexer.Errors()
+		if len(errs) != 1 {
+			t.Fatalf("input %q - expected 1 error, got=%d", test.input, len(errs))
+		}
+
+		if errs[0].Error() != test.expected {
+			t.Fatalf("input %q - wrong error. got=%q", test.input, errs[0].Error())
+		}
+	}
+}
+
+func Test_InterpolatedStrings(t *testing.T) {
+	input := strings.NewReader(`"hi ${name}, ${ {"k": "${v}"}["k"] }!" "\${no}"`)
+
+	expectedTokens := []token.Token{
+		{Type: token.STR_HEAD, Literal: "hi "},
+		{Type: token.IDENT, Literal: "name"},
+		{Type: token.STR_MID, Literal: ", "},
+		{Type: token.LBRACE, Literal: "{"},
+		{Type: token.STR, Literal: "k"},
+		{Type: token.COLON, Literal: ":"},
+		{Type: token.STR_HEAD, Literal: ""},
+		{Type: token.IDENT, Literal: "v"},
+		{Type: token.STR_TAIL, Literal: ""},
+		{Type: token.RBRACE, Literal: "}"},
+		{Type: token.LBRACKET, Literal: "["},
+		{Type: token.STR, Literal: "k"},
+		{Type: token.RBRACKET, Literal: "]"},
+		{Type: token.STR_TAIL, Literal: "!"},
+		{Type: token.STR, Literal: "${no}"},
+		{Type: token.EOF, Literal: "\x00"},
 	}
 
-	lexer := New(input)
+	lexer := NewReader(input)
 
 	for i, expectedToken := range expectedTokens {
 		tok := lexer.NextToken()
@@ -158,3 +507,97 @@ func TestNextToken(t *testing.T) {
 		}
 	}
 }
+
+func Test_BitwiseOperators(t *testing.T) {
+	input := strings.NewReader("a & b | c ^ ~d << 2 >> 1 <= >=")
+
+	expectedTokens := []token.Token{
+		{Type: token.IDENT, Literal: "a"},
+		{Type: token.BIT_AND, Literal: "&"},
+		{Type: token.IDENT, Literal: "b"},
+		{Type: token.BIT_OR, Literal: "|"},
+		{Type: token.IDENT, Literal: "c"},
+		{Type: token.BIT_XOR, Literal: "^"},
+		{Type: token.BIT_NOT, Literal: "~"},
+		{Type: token.IDENT, Literal: "d"},
+		{Type: token.SHL, Literal: "<<"},
+		{Type: token.INT, Literal: "2"},
+		{Type: token.SHR, Literal: ">>"},
+		{Type: token.INT, Literal: "1"},
+		{Type: token.LTE, Literal: "<="},
+		{Type: token.GTE, Literal: ">="},
+		{Type: token.EOF, Literal: "\x00"},
+	}
+
+	lexer := NewReader(input)
+
+	for i, expectedToken := range expectedTokens {
+		tok := lexer.NextToken()
+
+		if tok.Type != expectedToken.Type {
+			t.Fatalf("test[%d] - tokentype wrong. expected=%q, got=%q", i, expectedToken.Type, tok.Type)
+		}
+
+		if tok.Literal != expectedToken.Literal {
+			t.Fatalf("test[%d] - literal wrong. expected=%q, got=%q", i, expectedToken.Literal, tok.Literal)
+		}
+	}
+}
+
+func Test_NumberLiterals(t *testing.T) {
+	input := strings.NewReader("0xFF 0Xdead_BEEF 0o755 0b1010 1_000_000 1_000.5e1_0 0xZZ 1_ 07")
+
+	expectedTokens := []token.Token{
+		{Type: token.INT, Literal: "0xFF"},
+		{Type: token.INT, Literal: "0Xdead_BEEF"},
+		{Type: token.INT, Literal: "0o755"},
+		{Type: token.INT, Literal: "0b1010"},
+		{Type: token.INT, Literal: "1_000_000"},
+		{Type: token.FLOAT, Literal: "1_000.5e1_0"},
+		{Type: token.INT, Literal: "0xZZ"},
+		{Type: token.INT, Literal: "1_"},
+		{Type: token.INT, Literal: "07"},
+		{Type: token.EOF, Literal: "\x00"},
+	}
+
+	lexer := NewReader(input)
+
+	for i, expectedToken := range expectedTokens {
+		tok := lexer.NextToken()
+
+		if tok.Type != expectedToken.Type {
+			t.Fatalf("test[%d] - tokentype wrong. expected=%q, got=%q", i, expectedToken.Type, tok.Type)
+		}
+
+		if tok.Literal != expectedToken.Literal {
+			t.Fatalf("test[%d] - literal wrong. expected=%q, got=%q", i, expectedToken.Literal, tok.Literal)
+		}
+	}
+}
+
+func Test_SliceSource(t *testing.T) {
+	tokens, errs := Tokenize("let a = 1;")
+	if len(errs) != 0 {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+
+	// drop the EOF, the slice source adds it back
+	source := NewSliceSource(tokens[:len(tokens)-1])
+
+	expected := []token.TokenType{token.LET, token.IDENT, token.ASSIGN, token.INT, token.SEMICOLON, token.EOF, token.EOF}
+	for i, tokType := range expected {
+		tok := source.NextToken()
+
+		if tok.Type != tokType {
+			t.Fatalf("test[%d] - tokentype wrong. expected=%q, got=%q", i, tokType, tok.Type)
+		}
+	}
+
+	if eof := source.NextToken(); eof.Pos.Offset != len("let a = 1;") {
+		t.Fatalf("EOF should start where the last token ends, got=%s", eof.Pos)
+	}
+
+	if empty := NewSliceSource(nil); empty.NextToken().Type != token.EOF {
+		t.Fatalf("an empty slice source should only return EOF")
+	}
+}
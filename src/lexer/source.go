@@ -0,0 +1,88 @@
+package lexer
+
+import (
+	"sudocoding.xyz/interpreter_in_go/src/diagnostic"
+	"sudocoding.xyz/interpreter_in_go/src/token"
+)
+
+// TokenSource - a stream of tokens, what the parser reads from. Once the
+// tokens run out every call to NextToken returns an EOF token.
+type TokenSource interface {
+	// NextToken - returns the next token of the stream
+	NextToken() token.Token
+	// Errors - returns the errors found in the tokens read so far
+	Errors() []*diagnostic.Diagnostic
+	// Source - returns the source code read so far, used to render snippets.
+	// Empty if the tokens don't come from source code.
+	Source() string
+}
+
+var _ TokenSource = (*Lexer)(nil)
+var _ TokenSource = (*SliceSource)(nil)
+
+// SliceSource - a token source over tokens that are already known, like the
+// ones built by tests or by tools rewriting token streams
+type SliceSource struct {
+	tokens []token.Token
+	next   int
+	src    string
+}
+
+// NewSliceSource - creates a token source returning the given tokens in
+// order. An EOF token is added if the tokens don't end with one.
+func NewSliceSource(tokens []token.Token) *SliceSource {
+	if len(tokens) == 0 || tokens[len(tokens)-1].Type != token.EOF {
+		eof := token.Token{Type: token.EOF}
+		if len(tokens) > 0 {
+			eof.Pos = tokens[len(tokens)-1].End
+			eof.End = eof.Pos
+		}
+		tokens = append(tokens[:len(tokens):len(tokens)], eof)
+	}
+
+	return &SliceSource{tokens: tokens}
+}
+
+// Tokenize - reads all the tokens of the source, EOF included, along with the
+// errors found while reading them
+func Tokenize(input string) ([]token.Token, []*diagnostic.Diagnostic) {
+	l := New(input)
+
+	tokens := []token.Token{}
+	for {
+		tok := l.NextToken()
+		tokens = append(tokens, tok)
+
+		if tok.Type == token.EOF {
+			return tokens, l.Errors()
+		}
+	}
+}
+
+// WithSource - sets the source code the tokens were read from, so errors on
+// them can show snippets
+func (s *SliceSource) WithSource(src string) *SliceSource {
+	s.src = src
+	return s
+}
+
+// NextToken - returns the next token of the slice, the last one (EOF) once
+// all have been returned
+func (s *SliceSource) NextToken() token.Token {
+	tok := s.tokens[s.next]
+	if s.next < len(s.tokens)-1 {
+		s.next += 1
+	}
+
+	return tok
+}
+
+// Errors - a slice source has no errors of its own
+func (s *SliceSource) Errors() []*diagnostic.Diagnostic {
+	return nil
+}
+
+// Source - returns the source set with WithSource, if any
+func (s *SliceSource) Source() string {
+	return s.src
+}
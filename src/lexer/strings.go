@@ -0,0 +1,148 @@
+package lexer
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// decodeEscape - decodes the escape sequence at the start of `s`, which begins
+// with a `\`. Returns the decoded value and the number of bytes the sequence
+// spans. For an invalid sequence the value is the sequence itself and the
+// returned message explains what is wrong with it.
+func decodeEscape(s string) (string, int, string) {
+	if len(s) < 2 {
+		return s, len(s), "unterminated escape sequence"
+	}
+
+	switch s[1] {
+	case 'n':
+		return "\n", 2, ""
+	case 't':
+		return "\t", 2, ""
+	case 'r':
+		return "\r", 2, ""
+	case '0':
+		return "\x00", 2, ""
+	case '\\', '"', '\'', '$':
+		return s[1:2], 2, ""
+	case 'x':
+		n := hexDigits(s[2:], 2)
+		if n < 2 {
+			return s[:2+n], 2 + n, fmt.Sprintf("invalid escape sequence %s: \\x takes 2 hex digits", s[:2+n])
+		}
+
+		value, _ := strconv.ParseUint(s[2:4], 16, 8)
+		return string([]byte{byte(value)}), 4, ""
+	case 'u':
+		if len(s) < 3 || s[2] != '{' {
+			return s[:2], 2, "invalid escape sequence \\u: expected \\u{...}"
+		}
+
+		n := hexDigits(s[3:], 6)
+		if n == 0 || len(s) <= 3+n || s[3+n] != '}' {
+			return s[:3+n], 3 + n, fmt.Sprintf("invalid escape sequence %s: expected 1 to 6 hex digits and '}'", s[:3+n])
+		}
+
+		value, _ := strconv.ParseUint(s[3:3+n], 16, 32)
+		if value > utf8.MaxRune || value >= 0xD800 && value <= 0xDFFF {
+			return s[:4+n], 4 + n, fmt.Sprintf("invalid escape sequence %s: not a valid code point", s[:4+n])
+		}
+		return string(rune(value)), 4 + n, ""
+	default:
+		_, size := utf8.DecodeRuneInString(s[1:])
+		return s[:1+size], 1 + size, fmt.Sprintf("unknown escape sequence %s", s[:1+size])
+	}
+}
+
+// unescape - replaces the escape sequences in `raw` by the characters they
+// stand for. Invalid sequences are kept as they are.
+func unescape(raw string) string {
+	if !strings.Contains(raw, `\`) {
+		return raw
+	}
+
+	var out strings.Builder
+	for i := 0; i < len(raw); {
+		if raw[i] != '\\' {
+			out.WriteByte(raw[i])
+			i += 1
+			continue
+		}
+
+		value, size, _ := decodeEscape(raw[i:])
+		out.WriteString(value)
+		i += size
+	}
+
+	return out.String()
+}
+
+// dedent - strips the layout of a multi-line string: the line break right
+// after the opening `"""`, the line holding the closing `"""` when it is blank
+// and the indentation common to the remaining lines. The closing line counts
+// towards the common indentation, so it decides how much is stripped.
+func dedent(raw string) string {
+	lines := strings.Split(strings.ReplaceAll(raw, "\r\n", "\n"), "\n")
+	if len(lines) == 1 {
+		return raw
+	}
+
+	// text right after the opening `"""` is kept as it is
+	first := 1
+	if isBlank(lines[0]) {
+		lines = lines[1:]
+		first = 0
+	}
+
+	common := ""
+	found := false
+	for i, line := range lines {
+		last := i == len(lines)-1
+		if i < first || isBlank(line) && !last {
+			continue
+		}
+
+		indent := line[:len(line)-len(strings.TrimLeft(line, " \t"))]
+		if !found {
+			common, found = indent, true
+		}
+		for !strings.HasPrefix(indent, common) {
+			common = common[:len(common)-1]
+		}
+	}
+
+	if len(lines) > first && isBlank(lines[len(lines)-1]) {
+		lines = lines[:len(lines)-1]
+	}
+
+	for i := first; i < len(lines); i++ {
+		if strings.HasPrefix(lines[i], common) {
+			lines[i] = lines[i][len(common):]
+		} else {
+			lines[i] = ""
+		}
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// isBlank - returns true if the line only holds spaces and tabs
+func isBlank(line string) bool {
+	return strings.TrimLeft(line, " \t") == ""
+}
+
+// hexDigits - counts the hex digits at the start of `s`, up to `max`
+func hexDigits(s string, max int) int {
+	n := 0
+	for n < len(s) && n < max && isHex(s[n]) {
+		n += 1
+	}
+
+	return n
+}
+
+func isHex(ch byte) bool {
+	return '0' <= ch && ch <= '9' || 'a' <= ch && ch <= 'f' || 'A' <= ch && ch <= 'F'
+}
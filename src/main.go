@@ -6,24 +6,82 @@ import (
 	"os"
 
 	"sudocoding.xyz/interpreter_in_go/src/execute"
+	"sudocoding.xyz/interpreter_in_go/src/monkie"
+	"sudocoding.xyz/interpreter_in_go/src/optimizer"
 	"sudocoding.xyz/interpreter_in_go/src/repl"
 )
 
 var replIt = flag.Bool("repl", true, "run repl mode")
 var exeFile = flag.String("exe", "", "execute file")
+var useVM = flag.Bool("vm", false, "run the code with the bytecode VM instead of the evaluator")
+var trace = flag.Bool("trace", false, "log every instruction the VM runs to stderr, implies -vm")
+var dumpAST = flag.Bool("dump-ast", false, "print the optimized program of the -exe file instead of running it")
+var inline = flag.Bool("inline", false, "inline the calls of small functions")
 
 func main() {
+	// Commands come before the flags: `disasm FILE`, `compile FILE -o OUT`
+	if len(os.Args) > 1 && os.Args[1] == "disasm" {
+		if len(os.Args) != 3 {
+			fmt.Fprintln(os.Stderr, "usage: monkie disasm FILE")
+			os.Exit(2)
+		}
+		execute.Disasm(os.Args[2])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "compile" {
+		compile(os.Args[2:])
+		return
+	}
+
 	flag.Parse()
 
+	options := []monkie.Option{}
+	if *useVM || *trace {
+		options = append(options, monkie.WithBackend(monkie.VM))
+	}
+	if *trace {
+		options = append(options, monkie.WithTrace(os.Stderr))
+	}
+	if *inline {
+		options = append(options, monkie.WithOptimizer(optimizer.Options{Fold: true, Prune: true, Inline: true}))
+	}
+
+	if *exeFile != "" && *dumpAST {
+		execute.DumpAST(*exeFile, options...)
+		return
+	}
 	if *exeFile != "" {
-		execute.Execute(*exeFile)
+		execute.Execute(*exeFile, options...)
 		return
 	}
 
 	fmt.Println("Welcome to Monkie Lang!!")
 	if *replIt {
 		fmt.Println("Starting Repl. Type `exit` to quit ")
-		repl.Start(os.Stdin, os.Stdout)
+		repl.Start(os.Stdin, os.Stdout, options...)
 		return
 	}
 }
+
+// compile - the `compile` command, taking the flags before or after the file
+func compile(args []string) {
+	flags := flag.NewFlagSet("compile", flag.ExitOnError)
+	out := flags.String("o", "", "file to write, FILE with the "+execute.CompiledExt+" extension by default")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: monkie compile FILE [-o OUT]")
+		flags.PrintDefaults()
+	}
+
+	flags.Parse(args)
+	files := []string{}
+	for flags.NArg() > 0 {
+		files = append(files, flags.Arg(0))
+		flags.Parse(flags.Args()[1:])
+	}
+
+	if len(files) != 1 {
+		flags.Usage()
+		os.Exit(2)
+	}
+	execute.Compile(files[0], *out)
+}
@@ -0,0 +1,596 @@
+package monkie
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"reflect"
+
+	"sudocoding.xyz/interpreter_in_go/src/evaluator"
+	"sudocoding.xyz/interpreter_in_go/src/object"
+)
+
+var (
+	objectType = reflect.TypeOf((*object.Object)(nil)).Elem()
+	errorType  = reflect.TypeOf((*error)(nil)).Elem()
+	bigIntType = reflect.TypeOf((*big.Int)(nil))
+)
+
+// ToObject - converts a Go value to its Monkie counterpart:
+//
+//	nil, nil pointers       null
+//	bool                    boolean
+//	integers, *big.Int      integer
+//	floats                  float
+//	string                  string
+//	slices, arrays          array
+//	maps                    hash
+//	structs                 hash of the exported fields, named as the field or
+//	                        by a `monkie:"name"` tag
+//	functions               builtin, see Wrap
+//	object.Object           itself
+//
+// Pointers are followed. Other values, like channels, can't be converted.
+func ToObject(value interface{}) (object.Object, error) {
+	if value == nil {
+		return evaluator.NULL, nil
+	}
+	return toObject(reflect.ValueOf(value))
+}
+
+func toObject(value reflect.Value) (object.Object, error) {
+	if value.Type().Implements(objectType) {
+		if (value.Kind() == reflect.Pointer || value.Kind() == reflect.Interface) && value.IsNil() {
+			return evaluator.NULL, nil
+		}
+		return value.Interface().(object.Object), nil
+	}
+
+	if value.Type() == bigIntType {
+		if value.IsNil() {
+			return evaluator.NULL, nil
+		}
+		return object.NewInteger(new(big.Int).Set(value.Interface().(*big.Int))), nil
+	}
+
+	switch value.Kind() {
+	case reflect.Bool:
+		if value.Bool() {
+			return evaluator.TRUE, nil
+		}
+		return evaluator.FALSE, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return &object.Integer{Value: value.Int()}, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return object.NewInteger(new(big.Int).SetUint64(value.Uint())), nil
+	case reflect.Float32, reflect.Float64:
+		return &object.Float{Value: value.Float()}, nil
+	case reflect.String:
+		return &object.String{Value: value.String()}, nil
+	case reflect.Slice, reflect.Array:
+		if value.Kind() == reflect.Slice && value.IsNil() {
+			return evaluator.NULL, nil
+		}
+
+		elements := make([]object.Object, value.Len())
+		for i := range elements {
+			elm, err := toObject(value.Index(i))
+			if err != nil {
+				return nil, fmt.Errorf("element %d: %w", i, err)
+			}
+			elements[i] = elm
+		}
+		return &object.Array{Elements: elements}, nil
+	case reflect.Map:
+		if value.IsNil() {
+			return evaluator.NULL, nil
+		}
+
+		hash := &object.Hash{Pairs: map[object.HashKey]object.HashPair{}}
+		iter := value.MapRange()
+		for iter.Next() {
+			if err := setPair(hash, iter.Key(), iter.Value()); err != nil {
+				return nil, err
+			}
+		}
+		return hash, nil
+	case reflect.Struct:
+		hash := &object.Hash{Pairs: map[object.HashKey]object.HashPair{}}
+		for i := 0; i < value.NumField(); i++ {
+			if name, ok := fieldName(value.Type().Field(i)); ok {
+				if err := setPair(hash, reflect.ValueOf(name), value.Field(i)); err != nil {
+					return nil, err
+				}
+			}
+		}
+		return hash, nil
+	case reflect.Func:
+		if value.IsNil() {
+			return evaluator.NULL, nil
+		}
+		return Wrap("<host function>", value.Interface())
+	case reflect.Pointer, reflect.Interface:
+		if value.IsNil() {
+			return evaluator.NULL, nil
+		}
+		return toObject(value.Elem())
+	}
+
+	return nil, fmt.Errorf("cannot convert %s to a Monkie value", value.Type())
+}
+
+// setPair - converts the key and the value and adds them to the hash
+func setPair(hash *object.Hash, key, value reflect.Value) error {
+	keyObj, err := toObject(key)
+	if err != nil {
+		return fmt.Errorf("key %v: %w", key, err)
+	}
+
+	hashable, ok := keyObj.(object.Hashable)
+	if !ok {
+		return fmt.Errorf("key %v: %s is not hashable", key, keyObj.Type())
+	}
+
+	valueObj, err := toObject(value)
+	if err != nil {
+		return fmt.Errorf("key %v: %w", key, err)
+	}
+
+	hash.Pairs[hashable.Hash()] = object.HashPair{Key: keyObj, Value: valueObj}
+	return nil
+}
+
+// fieldName - name of the struct field in a hash, false for the fields that
+// are left out: unexported ones and the ones tagged `monkie:"-"`
+func fieldName(field reflect.StructField) (string, bool) {
+	if !field.IsExported() {
+		return "", false
+	}
+
+	tag := field.Tag.Get("monkie")
+	if tag == "-" {
+		return "", false
+	}
+	if tag != "" {
+		return tag, true
+	}
+	return field.Name, true
+}
+
+// FromObject - converts a Monkie value to the Go value `target` points to,
+// the reverse of ToObject. Integers and floats must fit the target type. An
+// `interface{}` target gets int64, *big.Int, float64, string, bool, nil,
+// []interface{} or, for hashes, map[string]interface{} when all the keys are
+// strings and map[interface{}]interface{} otherwise.
+func FromObject(obj object.Object, target interface{}) error {
+	ptr := reflect.ValueOf(target)
+	if ptr.Kind() != reflect.Pointer || ptr.IsNil() {
+		return fmt.Errorf("target must be a non nil pointer, got %T", target)
+	}
+
+	value, err := fromObject(nil, obj, ptr.Type().Elem())
+	if err != nil {
+		return err
+	}
+
+	ptr.Elem().Set(value)
+	return nil
+}
+
+func fromObject(ctx object.Context, obj object.Object, typ reflect.Type) (reflect.Value, error) {
+	if typ.Implements(objectType) {
+		if !reflect.TypeOf(obj).AssignableTo(typ) {
+			return reflect.Value{}, mismatch(obj, typ)
+		}
+		return reflect.ValueOf(obj), nil
+	}
+
+	if typ == bigIntType {
+		switch obj := obj.(type) {
+		case *object.Integer:
+			return reflect.ValueOf(big.NewInt(obj.Value)), nil
+		case *object.BigInteger:
+			return reflect.ValueOf(new(big.Int).Set(obj.Value)), nil
+		}
+		return reflect.Value{}, mismatch(obj, typ)
+	}
+
+	switch typ.Kind() {
+	case reflect.Interface:
+		if typ.NumMethod() != 0 {
+			return reflect.Value{}, mismatch(obj, typ)
+		}
+		return naturalValue(obj)
+	case reflect.Bool:
+		if obj, ok := obj.(*object.Boolean); ok {
+			return reflect.ValueOf(obj.Value).Convert(typ), nil
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if obj, ok := obj.(*object.Integer); ok {
+			value := reflect.New(typ).Elem()
+			if value.OverflowInt(obj.Value) {
+				return reflect.Value{}, fmt.Errorf("%d overflows %s", obj.Value, typ)
+			}
+			value.SetInt(obj.Value)
+			return value, nil
+		}
+		if obj, ok := obj.(*object.BigInteger); ok {
+			return reflect.Value{}, fmt.Errorf("%s overflows %s", obj.Inspect(), typ)
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if isInteger(obj) {
+			integer := toBigInt(obj)
+			value := reflect.New(typ).Elem()
+			if integer.Sign() < 0 || !integer.IsUint64() || value.OverflowUint(integer.Uint64()) {
+				return reflect.Value{}, fmt.Errorf("%s overflows %s", integer, typ)
+			}
+			value.SetUint(integer.Uint64())
+			return value, nil
+		}
+	case reflect.Float32, reflect.Float64:
+		value := reflect.New(typ).Elem()
+		switch obj := obj.(type) {
+		case *object.Float:
+			value.SetFloat(obj.Value)
+			return value, nil
+		case *object.Integer:
+			value.SetFloat(float64(obj.Value))
+			return value, nil
+		case *object.BigInteger:
+			float, _ := new(big.Float).SetInt(obj.Value).Float64()
+			value.SetFloat(float)
+			return value, nil
+		}
+	case reflect.String:
+		if obj, ok := obj.(*object.String); ok {
+			return reflect.ValueOf(obj.Value).Convert(typ), nil
+		}
+	case reflect.Slice:
+		if _, ok := obj.(*object.Null); ok {
+			return reflect.Zero(typ), nil
+		}
+		if obj, ok := obj.(*object.Array); ok {
+			slice := reflect.MakeSlice(typ, len(obj.Elements), len(obj.Elements))
+			for i, elm := range obj.Elements {
+				value, err := fromObject(ctx, elm, typ.Elem())
+				if err != nil {
+					return reflect.Value{}, fmt.Errorf("element %d: %w", i, err)
+				}
+				slice.Index(i).Set(value)
+			}
+			return slice, nil
+		}
+	case reflect.Array:
+		if obj, ok := obj.(*object.Array); ok {
+			if len(obj.Elements) != typ.Len() {
+				return reflect.Value{}, fmt.Errorf("array of %d elements can't fill %s", len(obj.Elements), typ)
+			}
+
+			array := reflect.New(typ).Elem()
+			for i, elm := range obj.Elements {
+				value, err := fromObject(ctx, elm, typ.Elem())
+				if err != nil {
+					return reflect.Value{}, fmt.Errorf("element %d: %w", i, err)
+				}
+				array.Index(i).Set(value)
+			}
+			return array, nil
+		}
+	case reflect.Map:
+		if _, ok := obj.(*object.Null); ok {
+			return reflect.Zero(typ), nil
+		}
+		if obj, ok := obj.(*object.Hash); ok {
+			m := reflect.MakeMapWithSize(typ, len(obj.Pairs))
+			for _, pair := range obj.SortedPairs() {
+				key, err := fromObject(ctx, pair.Key, typ.Key())
+				if err != nil {
+					return reflect.Value{}, fmt.Errorf("key %s: %w", pair.Key.Inspect(), err)
+				}
+				value, err := fromObject(ctx, pair.Value, typ.Elem())
+				if err != nil {
+					return reflect.Value{}, fmt.Errorf("key %s: %w", pair.Key.Inspect(), err)
+				}
+				m.SetMapIndex(key, value)
+			}
+			return m, nil
+		}
+	case reflect.Struct:
+		if obj, ok := obj.(*object.Hash); ok {
+			return structFromHash(ctx, obj, typ)
+		}
+	case reflect.Func:
+		if _, ok := obj.(*object.Null); ok {
+			return reflect.Zero(typ), nil
+		}
+		if ctx != nil && (obj.Type() == object.FUNCTION || obj.Type() == object.BUILTIN_OBJ) {
+			return callback(ctx, obj, typ), nil
+		}
+	case reflect.Pointer:
+		if _, ok := obj.(*object.Null); ok {
+			return reflect.Zero(typ), nil
+		}
+
+		value, err := fromObject(ctx, obj, typ.Elem())
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		ptr := reflect.New(typ.Elem())
+		ptr.Elem().Set(value)
+		return ptr, nil
+	}
+
+	return reflect.Value{}, mismatch(obj, typ)
+}
+
+// callback - turns a Monkie function given to a wrapped Go function into a Go
+// function of type `typ`, calling it back through the context of the call. A
+// failure of the Monkie function is returned as a *RuntimeError, Wrap makes
+// sure `typ` returns an error, see checkCallbacks.
+func callback(ctx object.Context, fn object.Object, typ reflect.Type) reflect.Value {
+	return reflect.MakeFunc(typ, func(in []reflect.Value) []reflect.Value {
+		out := make([]reflect.Value, typ.NumOut())
+		for i := range out {
+			out[i] = reflect.Zero(typ.Out(i))
+		}
+
+		fail := func(err *object.Error) []reflect.Value {
+			out[len(out)-1] = reflect.ValueOf(&RuntimeError{Err: err})
+			return out
+		}
+
+		args := make([]object.Object, len(in))
+		for i, value := range in {
+			arg, err := toObject(value)
+			if err != nil {
+				return fail(&object.Error{Message: fmt.Sprintf("argument %d of callback: %s", i+1, err)})
+			}
+			args[i] = arg
+		}
+
+		result := ctx.Call(fn, args...)
+		if err, ok := result.(*object.Error); ok {
+			return fail(err)
+		}
+
+		if len(out) == 2 {
+			value, err := fromObject(ctx, result, typ.Out(0))
+			if err != nil {
+				return fail(&object.Error{Message: fmt.Sprintf("result of callback: %s", err)})
+			}
+			out[0] = value
+		}
+		return out
+	})
+}
+
+// checkResults - whether a function of type `typ` returns an error, an error
+// if its results are not nothing, a value, an error, or a value and an error
+func checkResults(typ reflect.Type) (bool, error) {
+	returnsErr := typ.NumOut() > 0 && typ.Out(typ.NumOut()-1) == errorType
+	if typ.NumOut() > 2 || typ.NumOut() == 2 && !returnsErr {
+		return false, fmt.Errorf("%s must return at most a value and an error", typ)
+	}
+	return returnsErr, nil
+}
+
+// checkCallbacks - an error if a value of type `typ` converted from Monkie
+// may hold a callback not returning an error. Such a callback would have no
+// way to report the failure of the Monkie function, which may be called long
+// after the wrapped function returned.
+func checkCallbacks(typ reflect.Type, seen map[reflect.Type]bool) error {
+	if seen[typ] || typ.Implements(objectType) || typ == bigIntType {
+		return nil
+	}
+	seen[typ] = true
+
+	switch typ.Kind() {
+	case reflect.Slice, reflect.Array, reflect.Pointer:
+		return checkCallbacks(typ.Elem(), seen)
+	case reflect.Map:
+		if err := checkCallbacks(typ.Key(), seen); err != nil {
+			return err
+		}
+		return checkCallbacks(typ.Elem(), seen)
+	case reflect.Struct:
+		for i := 0; i < typ.NumField(); i++ {
+			if _, ok := fieldName(typ.Field(i)); !ok {
+				continue
+			}
+			if err := checkCallbacks(typ.Field(i).Type, seen); err != nil {
+				return err
+			}
+		}
+	case reflect.Func:
+		returnsErr, err := checkResults(typ)
+		if err != nil {
+			return err
+		}
+		if !returnsErr {
+			return fmt.Errorf("callback %s must return an error", typ)
+		}
+		if typ.NumOut() == 2 {
+			return checkCallbacks(typ.Out(0), seen)
+		}
+	}
+	return nil
+}
+
+// structFromHash - fills the fields of a new struct with the values of the
+// hash, the keys being the names given by fieldName. Keys that don't match a
+// field are ignored, fields with no key keep their zero value.
+func structFromHash(ctx object.Context, hash *object.Hash, typ reflect.Type) (reflect.Value, error) {
+	value := reflect.New(typ).Elem()
+
+	for i := 0; i < typ.NumField(); i++ {
+		name, ok := fieldName(typ.Field(i))
+		if !ok {
+			continue
+		}
+
+		pair, ok := hash.Pairs[(&object.String{Value: name}).Hash()]
+		if !ok {
+			continue
+		}
+
+		field, err := fromObject(ctx, pair.Value, typ.Field(i).Type)
+		if err != nil {
+			return reflect.Value{}, fmt.Errorf("field %s: %w", name, err)
+		}
+		value.Field(i).Set(field)
+	}
+
+	return value, nil
+}
+
+// naturalValue - the Go value closest to the Monkie value, for `interface{}`
+// targets
+func naturalValue(obj object.Object) (reflect.Value, error) {
+	var value interface{}
+
+	switch obj := obj.(type) {
+	case *object.Null:
+		return reflect.Zero(reflect.TypeOf((*interface{})(nil)).Elem()), nil
+	case *object.Integer:
+		value = obj.Value
+	case *object.BigInteger:
+		value = new(big.Int).Set(obj.Value)
+	case *object.Float:
+		value = obj.Value
+	case *object.String:
+		value = obj.Value
+	case *object.Boolean:
+		value = obj.Value
+	case *object.Array:
+		elements := make([]interface{}, len(obj.Elements))
+		for i, elm := range obj.Elements {
+			if err := FromObject(elm, &elements[i]); err != nil {
+				return reflect.Value{}, fmt.Errorf("element %d: %w", i, err)
+			}
+		}
+		value = elements
+	case *object.Hash:
+		stringKeys := true
+		for _, pair := range obj.Pairs {
+			_, ok := pair.Key.(*object.String)
+			stringKeys = stringKeys && ok
+		}
+
+		var target interface{} = &map[interface{}]interface{}{}
+		if stringKeys {
+			target = &map[string]interface{}{}
+		}
+		if err := FromObject(obj, target); err != nil {
+			return reflect.Value{}, err
+		}
+		value = reflect.ValueOf(target).Elem().Interface()
+	default:
+		value = obj
+	}
+
+	return reflect.ValueOf(&value).Elem(), nil
+}
+
+// mismatch - error for a Monkie value that can't become a value of the type
+func mismatch(obj object.Object, typ reflect.Type) error {
+	return fmt.Errorf("cannot use %s as %s", obj.Type(), typ)
+}
+
+func isInteger(obj object.Object) bool {
+	return obj.Type() == object.INTEGER_OBJ || obj.Type() == object.BIG_INTEGER_OBJ
+}
+
+func toBigInt(obj object.Object) *big.Int {
+	if integer, ok := obj.(*object.Integer); ok {
+		return big.NewInt(integer.Value)
+	}
+	return obj.(*object.BigInteger).Value
+}
+
+// Wrap - turns a Go function into a builtin. The arguments it gets are
+// converted with FromObject to the parameter types, its result with ToObject.
+// Function parameters accept Monkie functions, see callback, and must return
+// an error for their failures.
+// The function may return nothing, a value, an error, or a value and an
+// error. A non nil error becomes a Monkie error, catchable with try/catch, as
+// does a panic of the function. `name` is used in the error messages.
+func Wrap(name string, fn interface{}) (*object.Builtin, error) {
+	value := reflect.ValueOf(fn)
+	typ := value.Type()
+	if typ.Kind() != reflect.Func {
+		return nil, fmt.Errorf("%s is not a function", typ)
+	}
+
+	returnsErr, err := checkResults(typ)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	for i := 0; i < typ.NumIn(); i++ {
+		if err := checkCallbacks(typ.In(i), map[reflect.Type]bool{}); err != nil {
+			return nil, fmt.Errorf("%s: argument %d: %w", name, i+1, err)
+		}
+	}
+
+	return &object.Builtin{Fn: func(ctx object.Context, args ...object.Object) (result object.Object) {
+		in, err := wrappedArgs(ctx, typ, args)
+		if err != nil {
+			return &object.Error{Message: fmt.Sprintf("%s in call to `%s`", err, name)}
+		}
+
+		defer func() {
+			if r := recover(); r != nil {
+				result = &object.Error{Message: fmt.Sprintf("`%s` panicked: %v", name, r)}
+			}
+		}()
+
+		out := value.Call(in)
+		if returnsErr {
+			if err := out[len(out)-1]; !err.IsNil() {
+				var runtimeErr *RuntimeError
+				if errors.As(err.Interface().(error), &runtimeErr) {
+					return runtimeErr.Err
+				}
+				return &object.Error{Message: err.Interface().(error).Error()}
+			}
+			out = out[:len(out)-1]
+		}
+
+		if len(out) == 0 {
+			return evaluator.NULL
+		}
+
+		obj, err := toObject(out[0])
+		if err != nil {
+			return &object.Error{Message: fmt.Sprintf("result of `%s`: %s", name, err)}
+		}
+		return obj
+	}}, nil
+}
+
+// wrappedArgs - converts the arguments of a call to a wrapped Go function
+func wrappedArgs(ctx object.Context, typ reflect.Type, args []object.Object) ([]reflect.Value, error) {
+	params := typ.NumIn()
+	if typ.IsVariadic() && len(args) < params-1 || !typ.IsVariadic() && len(args) != params {
+		want := fmt.Sprint(params)
+		if typ.IsVariadic() {
+			want = fmt.Sprintf("at least %d", params-1)
+		}
+		return nil, fmt.Errorf("wrong number of arguments. got=%d, want=%s", len(args), want)
+	}
+
+	in := make([]reflect.Value, len(args))
+	for i, arg := range args {
+		paramType := typ.In(min(i, params-1))
+		if typ.IsVariadic() && i >= params-1 {
+			paramType = paramType.Elem()
+		}
+
+		value, err := fromObject(ctx, arg, paramType)
+		if err != nil {
+			return nil, fmt.Errorf("argument %d: %s", i+1, err)
+		}
+		in[i] = value
+	}
+
+	return in, nil
+}
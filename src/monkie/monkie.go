@@ -0,0 +1,544 @@
+// Package monkie - embeds the Monkie interpreter in Go programs
+package monkie
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"strings"
+	"time"
+
+	"sudocoding.xyz/interpreter_in_go/src/compiler"
+	"sudocoding.xyz/interpreter_in_go/src/diagnostic"
+	"sudocoding.xyz/interpreter_in_go/src/evaluator"
+	"sudocoding.xyz/interpreter_in_go/src/lexer"
+	"sudocoding.xyz/interpreter_in_go/src/object"
+	"sudocoding.xyz/interpreter_in_go/src/optimizer"
+	"sudocoding.xyz/interpreter_in_go/src/parser"
+	"sudocoding.xyz/interpreter_in_go/src/parser/ast"
+	"sudocoding.xyz/interpreter_in_go/src/resolver"
+	"sudocoding.xyz/interpreter_in_go/src/vm"
+)
+
+// Interpreter - runs Monkie code. The globals and macros defined by a call to
+// Eval are visible to the following ones, like lines typed in the REPL.
+type Interpreter struct {
+	env      *object.Environment // globals
+	macroEnv *object.Environment // macros defined so far
+	resolver *resolver.Resolver  // globals declared so far, of either backend
+	stdout   io.Writer
+	stderr   io.Writer
+	stdin    io.Reader
+	io       *object.IO
+	limits   *object.Limits
+	timeout  time.Duration
+	trace    io.Writer
+	optimize optimizer.Options // rewrites made to the programs before they run
+
+	backend   Backend
+	symbols   *compiler.SymbolTable // globals of the VM backend
+	constants []object.Object
+	globals   []object.Object
+	machine   *vm.VM // VM running code, nil if none is
+}
+
+// Backend - what runs the code
+type Backend int
+
+const (
+	Evaluator Backend = iota // walks the AST, the default
+	VM                       // compiles the code to bytecode run by a stack machine
+)
+
+// DefaultMaxDepth - nested function calls allowed unless WithMaxDepth says
+// otherwise, deep enough for any sane recursion and shallow enough to keep the
+// Go stack from overflowing
+const DefaultMaxDepth = 10000
+
+// ErrLimitExceeded - what the errors of the runs stopped by their limits, their
+// timeout or their context wrap, see errors.Is
+var ErrLimitExceeded = evaluator.ErrLimitExceeded
+
+// Option - configures an Interpreter
+type Option func(*Interpreter)
+
+// WithStdout - sets where `print` and `input` write, os.Stdout by default
+func WithStdout(out io.Writer) Option {
+	return func(in *Interpreter) {
+		in.stdout = out
+	}
+}
+
+// WithStderr - sets where `eprint` and Report write, os.Stderr by default
+func WithStderr(out io.Writer) Option {
+	return func(in *Interpreter) {
+		in.stderr = out
+	}
+}
+
+// WithStdin - sets where `input` and `readLine` read, os.Stdin by default
+func WithStdin(r io.Reader) Option {
+	return func(in *Interpreter) {
+		in.stdin = r
+	}
+}
+
+// WithMaxSteps - limits the evaluation steps of each run, unlimited by
+// default. A step is the evaluation of one node of the code, or one
+// instruction run by the VM backend.
+func WithMaxSteps(steps int) Option {
+	return func(in *Interpreter) {
+		in.limits.MaxSteps = steps
+	}
+}
+
+// WithMaxDepth - limits the function calls nested in each other,
+// DefaultMaxDepth by default and unlimited for 0
+func WithMaxDepth(depth int) Option {
+	return func(in *Interpreter) {
+		in.limits.MaxDepth = depth
+	}
+}
+
+// WithTimeout - limits the time each run may take, unlimited by default
+func WithTimeout(timeout time.Duration) Option {
+	return func(in *Interpreter) {
+		in.timeout = timeout
+	}
+}
+
+// WithBackend - sets what runs the code, the Evaluator by default. The globals
+// of the backends are separate.
+func WithBackend(backend Backend) Option {
+	return func(in *Interpreter) {
+		in.backend = backend
+	}
+}
+
+// WithTrace - logs every instruction the VM backend runs to `out`, along with
+// the stack it runs on
+func WithTrace(out io.Writer) Option {
+	return func(in *Interpreter) {
+		in.trace = out
+	}
+}
+
+// WithOptimizer - sets the rewrites the optimizer makes to the programs before
+// they run, optimizer.Default by default
+func WithOptimizer(options optimizer.Options) Option {
+	return func(in *Interpreter) {
+		in.optimize = options
+	}
+}
+
+// New - creates an interpreter with no globals or macros defined
+func New(options ...Option) *Interpreter {
+	in := &Interpreter{
+		env:      object.NewEnvironment(),
+		macroEnv: object.NewEnvironment(),
+		resolver: resolver.New(),
+		stdout:   os.Stdout,
+		stderr:   os.Stderr,
+		stdin:    object.StdIO.Stdin,
+		limits:   &object.Limits{MaxDepth: DefaultMaxDepth},
+		optimize: optimizer.Default,
+
+		symbols:   compiler.NewSymbolTable(),
+		constants: []object.Object{},
+		globals:   make([]object.Object, vm.GlobalsSize),
+	}
+
+	for _, option := range options {
+		option(in)
+	}
+
+	in.io = object.NewIO(in.stdout, in.stderr, in.stdin)
+	in.env.SetIO(in.io)
+	in.macroEnv.SetIO(in.io)
+	in.env.SetLimits(in.limits)
+	in.macroEnv.SetLimits(in.limits)
+
+	return in
+}
+
+// Eval - runs the source code and returns the value of its last statement,
+// nil if there are no statements. The error is a *ParseError if the code
+// doesn't parse, a *ResolveError if it refers to variables that don't exist,
+// a *CompileError if the VM backend can't compile it and a *RuntimeError if
+// it fails while running.
+func (in *Interpreter) Eval(src string) (object.Object, error) {
+	return in.EvalContext(context.Background(), src)
+}
+
+// EvalContext - runs the source code like Eval, stopping it with a
+// *RuntimeError wrapping ErrLimitExceeded and the error of the context once
+// the context is done
+func (in *Interpreter) EvalContext(ctx context.Context, src string) (object.Object, error) {
+	return in.run(ctx, lexer.New(src))
+}
+
+// EvalFile - runs the source code in the file, see Eval. Positions in the
+// errors are reported against the file name.
+func (in *Interpreter) EvalFile(path string) (object.Object, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return in.run(context.Background(), lexer.NewFile(path, file))
+}
+
+// Compile - compiles the source code to bytecode for the VM backend, like Eval
+// does before running it. Macros are defined and globals declared, but
+// nothing runs. The error is a *ParseError, a *ResolveError or a
+// *CompileError.
+func (in *Interpreter) Compile(src string) (*compiler.Bytecode, error) {
+	return in.compileSource(lexer.New(src))
+}
+
+// CompileFile - compiles the source code in the file, see Compile
+func (in *Interpreter) CompileFile(path string) (*compiler.Bytecode, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return in.compileSource(lexer.NewFile(path, file))
+}
+
+// EvalBytecode - runs a compiled program, like one returned by Compile or read
+// with compiler.Decode, on the VM whatever the backend. Its globals are the
+// ones of the VM backend, matched by name. The error is a *RuntimeError if
+// it fails while running.
+func (in *Interpreter) EvalBytecode(bytecode *compiler.Bytecode) (object.Object, error) {
+	defer in.start(context.Background())()
+
+	if err := compiler.Link(bytecode, in.symbols, in.constants); err != nil {
+		return nil, err
+	}
+	in.constants = bytecode.Constants
+	for _, name := range bytecode.Globals {
+		in.resolver.Declare(name)
+	}
+	result := in.runMachine(bytecode)
+
+	if err, ok := result.(*object.Error); ok {
+		return nil, &RuntimeError{Err: err}
+	}
+
+	return result, nil
+}
+
+// EvalCompiledFile - runs the program compiled in the file, see
+// compiler.Encode and EvalBytecode. Files that aren't valid compiled programs
+// of this version of Monkie are refused before anything runs.
+func (in *Interpreter) EvalCompiledFile(path string) (object.Object, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	bytecode, err := compiler.Decode(file)
+	if err != nil {
+		return nil, fmt.Errorf("cannot load %s: %w", path, err)
+	}
+
+	return in.EvalBytecode(bytecode)
+}
+
+// Parse - parses the source code into the program Eval would run, its macros
+// expanded and optimized. Macros are defined and globals declared, but
+// nothing runs. The error is a *ParseError or a *ResolveError.
+func (in *Interpreter) Parse(src string) (ast.Node, error) {
+	return in.parse(lexer.New(src))
+}
+
+// ParseFile - parses the source code in the file, see Parse
+func (in *Interpreter) ParseFile(path string) (ast.Node, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return in.parse(lexer.NewFile(path, file))
+}
+
+func (in *Interpreter) compileSource(l lexer.TokenSource) (*compiler.Bytecode, error) {
+	program, err := in.parse(l)
+	if err != nil {
+		return nil, err
+	}
+
+	return in.compile(program, l.Source())
+}
+
+// CallFunction - calls a Monkie function, like one read with Get, or a
+// builtin with the arguments. The error is a *RuntimeError if the call fails.
+// Called while code runs, from a registered function, the call counts against
+// the limits of the run.
+func (in *Interpreter) CallFunction(fn object.Object, args ...object.Object) (object.Object, error) {
+	if in.limits.Context == nil {
+		in.limits.Reset(context.Background())
+		defer in.limits.Reset(nil)
+	}
+
+	var result object.Object
+	switch {
+	case in.backend == Evaluator:
+		result = evaluator.CallFunction(in.env, fn, args...)
+	case in.machine != nil:
+		result = in.machine.Call(fn, args...)
+	default:
+		result = in.newMachine(&compiler.Bytecode{Constants: in.constants}).Call(fn, args...)
+	}
+
+	if err, ok := result.(*object.Error); ok {
+		return nil, &RuntimeError{Err: err}
+	}
+
+	return result, nil
+}
+
+// Set - defines or replaces a global
+func (in *Interpreter) Set(name string, value object.Object) {
+	in.resolver.Declare(name)
+
+	if in.backend == VM {
+		in.globals[in.symbols.Define(name).Index] = value
+		return
+	}
+
+	in.env.Set(name, value)
+}
+
+// Register - defines or replaces a global with a Go value, converted with
+// ToObject. Functions become builtins, see Wrap.
+func (in *Interpreter) Register(name string, value interface{}) error {
+	var obj object.Object
+	var err error
+
+	if fn := reflect.ValueOf(value); fn.Kind() == reflect.Func && !fn.IsNil() {
+		obj, err = Wrap(name, value)
+	} else {
+		obj, err = ToObject(value)
+	}
+	if err != nil {
+		return fmt.Errorf("cannot register %s: %w", name, err)
+	}
+
+	in.Set(name, obj)
+	return nil
+}
+
+// Get - returns the value of a global, false if it isn't defined
+func (in *Interpreter) Get(name string) (object.Object, bool) {
+	if in.backend == VM {
+		symbol, ok := in.symbols.Resolve(name)
+		if !ok || symbol.Scope != compiler.GlobalScope || in.globals[symbol.Index] == nil {
+			return nil, false
+		}
+		return in.globals[symbol.Index], true
+	}
+
+	return in.env.Get(name)
+}
+
+// Report - writes an error returned by Eval to the interpreter's stderr, the
+// diagnostics with their snippets or the traceback of the runtime error
+func (in *Interpreter) Report(err error) {
+	switch err := err.(type) {
+	case *ParseError:
+		for _, diag := range err.Diagnostics {
+			fmt.Fprintln(in.stderr, diag.String())
+		}
+	case *ResolveError:
+		for _, diag := range err.Diagnostics {
+			fmt.Fprintln(in.stderr, diag.String())
+		}
+	case *CompileError:
+		fmt.Fprintln(in.stderr, err.Diagnostic.String())
+	case *RuntimeError:
+		fmt.Fprintln(in.stderr, err.Err.Traceback())
+	default:
+		fmt.Fprintln(in.stderr, "error:", err)
+	}
+}
+
+func (in *Interpreter) run(ctx context.Context, l lexer.TokenSource) (object.Object, error) {
+	defer in.start(ctx)()
+
+	expanded, err := in.parse(l)
+	if err != nil {
+		return nil, err
+	}
+
+	var result object.Object
+	if in.backend == VM {
+		bytecode, err := in.compile(expanded, l.Source())
+		if err != nil {
+			return nil, err
+		}
+		result = in.runMachine(bytecode)
+	} else {
+		result = evaluator.Eval(expanded, in.env)
+	}
+
+	if err, ok := result.(*object.Error); ok {
+		return nil, &RuntimeError{Err: err}
+	}
+
+	return result, nil
+}
+
+// start - starts counting against the limits for a run under the context,
+// returns the function ending the run
+func (in *Interpreter) start(ctx context.Context) func() {
+	cancel := context.CancelFunc(func() {})
+	if in.timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, in.timeout)
+	}
+
+	in.limits.Reset(ctx)
+	return func() {
+		in.limits.Reset(nil)
+		cancel()
+	}
+}
+
+// parse - parses the program, expands its macros, resolves its variables and
+// optimizes it
+func (in *Interpreter) parse(l lexer.TokenSource) (ast.Node, error) {
+	p := parser.New(l)
+	program := p.ParseProgram()
+
+	if diags := p.Errors(); len(diags) > 0 {
+		return nil, &ParseError{Diagnostics: diags}
+	}
+
+	expanded, err := in.expandMacros(program)
+	if err != nil {
+		return nil, err
+	}
+
+	// Resolved before it's optimized, so the whole program is checked
+	// whatever the optimizer leaves out
+	if diags := in.resolver.Resolve(expanded); len(diags) > 0 {
+		for _, diag := range diags {
+			diag.Snippet = diagnostic.Snippet(l.Source(), diag.Pos, diag.End)
+		}
+		return nil, &ResolveError{Diagnostics: diags}
+	}
+
+	return optimizer.Optimize(expanded, in.optimize), nil
+}
+
+// compile - compiles the program against the globals and the constants of
+// the previous ones
+func (in *Interpreter) compile(program ast.Node, src string) (*compiler.Bytecode, error) {
+	c := compiler.NewWithState(in.symbols, in.constants)
+	if err := c.Compile(program); err != nil {
+		diag := err.(*diagnostic.Diagnostic)
+		diag.Snippet = diagnostic.Snippet(src, diag.Pos, diag.End)
+		return nil, &CompileError{Diagnostic: diag}
+	}
+
+	bytecode := c.Bytecode()
+	in.constants = bytecode.Constants
+	return bytecode, nil
+}
+
+// runMachine - runs the bytecode, the running VM taking the calls of
+// CallFunction meanwhile
+func (in *Interpreter) runMachine(bytecode *compiler.Bytecode) object.Object {
+	outer := in.machine
+	in.machine = in.newMachine(bytecode)
+	defer func() { in.machine = outer }()
+
+	return in.machine.Run()
+}
+
+func (in *Interpreter) newMachine(bytecode *compiler.Bytecode) *vm.VM {
+	bytecode.Globals = in.symbols.Names()
+
+	machine := vm.NewWithGlobals(bytecode, in.globals)
+	machine.SetIO(in.io)
+	machine.SetLimits(in.limits)
+	if in.trace != nil {
+		machine.SetTrace(in.trace)
+	}
+	return machine
+}
+
+// expandMacros - defines the macros of the program and expands their calls.
+// Macros that don't return a quote are reported as errors.
+func (in *Interpreter) expandMacros(program *ast.Program) (expanded ast.Node, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("macro expansion failed: %v", r)
+		}
+	}()
+
+	evaluator.DefineMacros(program, in.macroEnv)
+	return evaluator.ExpandMacros(program, in.macroEnv), nil
+}
+
+// ParseError - the source code has syntax errors
+type ParseError struct {
+	Diagnostics []*diagnostic.Diagnostic
+}
+
+func (e *ParseError) Error() string {
+	msgs := []string{}
+	for _, diag := range e.Diagnostics {
+		msgs = append(msgs, diag.Error())
+	}
+
+	return strings.Join(msgs, "\n")
+}
+
+// ResolveError - the source code refers to variables that don't exist
+type ResolveError struct {
+	Diagnostics []*diagnostic.Diagnostic
+}
+
+func (e *ResolveError) Error() string {
+	msgs := []string{}
+	for _, diag := range e.Diagnostics {
+		msgs = append(msgs, diag.Error())
+	}
+
+	return strings.Join(msgs, "\n")
+}
+
+// CompileError - the VM backend can't compile the source code
+type CompileError struct {
+	Diagnostic *diagnostic.Diagnostic
+}
+
+func (e *CompileError) Error() string {
+	return e.Diagnostic.Error()
+}
+
+// RuntimeError - the code failed while running, with an error raised by the
+// interpreter, an exception thrown and never caught, or a limit exceeded
+type RuntimeError struct {
+	Err *object.Error
+}
+
+// Unwrap - returns the limit the code exceeded, nil if it failed otherwise
+func (e *RuntimeError) Unwrap() error {
+	return e.Err.Limit
+}
+
+func (e *RuntimeError) Error() string {
+	if e.Err.Pos.IsValid() {
+		return fmt.Sprintf("%s: %s", e.Err.Pos, e.Err.Message)
+	}
+	return e.Err.Message
+}
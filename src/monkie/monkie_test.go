@@ -0,0 +1,582 @@
+package monkie
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"sudocoding.xyz/interpreter_in_go/src/compiler"
+	"sudocoding.xyz/interpreter_in_go/src/object"
+	"sudocoding.xyz/interpreter_in_go/src/optimizer"
+)
+
+func eq[T comparable](t *testing.T, expected T, actual T, msg ...string) {
+	if expected != actual {
+		t.Fatalf("%s\nexpected: %+v\nactual: %+v\n", strings.Join(msg, " "), expected, actual)
+	}
+}
+
+func notEq[T comparable](t *testing.T, expected T, actual T, msg ...string) {
+	if expected == actual {
+		t.Fatalf("%s\nexpected not: %+v\nactual: %+v\n", strings.Join(msg, " "), expected, actual)
+	}
+}
+
+func Test_Eval(t *testing.T) {
+	for _, test := range []struct {
+		input    string
+		expected string
+	}{
+		{"1 + 2", "3"},
+		{`let greet = fn(name) { "hi " + name }; greet("ann")`, "hi ann"},
+		{"let a = [1, 2]; push(a, 3); a", "[1, 2, 3]"},
+		{"return 5; 10", "5"},
+	} {
+		t.Run(fmt.Sprintf("Test eval of %s", test.input), func(t *testing.T) {
+			result, err := New().Eval(test.input)
+
+			eq(t, nil, err, "Unexpected error")
+			eq(t, test.expected, result.Inspect(), "Result mismatch")
+		})
+	}
+}
+
+func Test_EvalKeepsState(t *testing.T) {
+	in := New()
+
+	result, err := in.Eval("let x = 40;")
+	eq(t, nil, err, "Unexpected error")
+	eq(t, "null", result.Inspect(), "A let statement has no value")
+
+	result, err = in.Eval("   ")
+	eq(t, nil, err, "Unexpected error")
+	eq(t, nil, result, "Empty source has no result")
+
+	_, err = in.Eval("let unless = macro(cond, then) { quote(if (!(unquote(cond))) { unquote(then) }) };")
+	eq(t, nil, err, "Unexpected error")
+
+	result, err = in.Eval("unless(x > 100, x + 2)")
+	eq(t, nil, err, "Unexpected error")
+	eq(t, "42", result.Inspect(), "Globals and macros should persist across calls")
+}
+
+func Test_EvalErrors(t *testing.T) {
+	in := New()
+
+	_, err := in.Eval("let = 5;")
+	var parseErr *ParseError
+	eq(t, true, errors.As(err, &parseErr), "Expected a *ParseError")
+	eq(t, "1:5: error[P0001]: expected identifier, found '='", err.Error(), "Parse error mismatch")
+
+	_, err = in.Eval("let f = fn() { 1 / 0 };\nf()")
+	var runtimeErr *RuntimeError
+	eq(t, true, errors.As(err, &runtimeErr), "Expected a *RuntimeError")
+	eq(t, "1:18: division by zero", err.Error(), "Runtime error mismatch")
+	eq(t, 2, len(runtimeErr.Err.Frames()), "Frames mismatch")
+
+	_, err = in.Eval(`throw "boom"`)
+	eq(t, "1:1: boom", err.Error(), "Uncaught exception mismatch")
+
+	_, err = in.Eval("let m = macro() { 1 }; m()")
+	notEq(t, nil, err, "A macro not returning a quote should fail")
+}
+
+func Test_SetGet(t *testing.T) {
+	in := New()
+	in.Set("limit", &object.Integer{Value: 10})
+
+	result, err := in.Eval("let doubled = limit * 2; doubled")
+	eq(t, nil, err, "Unexpected error")
+	eq(t, "20", result.Inspect(), "Result mismatch")
+
+	doubled, ok := in.Get("doubled")
+	eq(t, true, ok, "Global defined by the script should be visible")
+	eq(t, "20", doubled.Inspect(), "Global mismatch")
+
+	_, ok = in.Get("missing")
+	eq(t, false, ok, "Undefined global should not be found")
+}
+
+func Test_Output(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	in := New(WithStdout(&stdout), WithStderr(&stderr))
+
+	_, err := in.Eval(`print("a", 1, true); print("b")`)
+	eq(t, nil, err, "Unexpected error")
+	eq(t, "a1true\nb\n", stdout.String(), "print should write to the configured stdout")
+
+	_, err = in.Eval(`eprint("oops", 2)`)
+	eq(t, nil, err, "Unexpected error")
+	eq(t, "oops2\n", stderr.String(), "eprint should write to the configured stderr")
+	stderr.Reset()
+
+	_, err = in.Eval("let f = fn() { throw \"x\" };\nf()")
+	in.Report(err)
+	eq(t, "error: x\n    at f (1:16)\n    at <main> (2:1)\n", stderr.String(), "Report should write the traceback")
+
+	stderr.Reset()
+	_, err = in.Eval("let a = ;")
+	in.Report(err)
+	eq(t, "1:9: error[P0002]: expected an expression, found ';'\n   |\n 1 | let a = ;\n   |         ^\n", stderr.String(), "Report should write the diagnostics")
+}
+
+func Test_Input(t *testing.T) {
+	var stdout bytes.Buffer
+	in := New(WithStdout(&stdout), WithStdin(strings.NewReader("ann\r\n42\nlast")))
+
+	for _, test := range []struct {
+		input    string
+		expected string
+	}{
+		{`input("name? ")`, "ann"},
+		{"readLine()", "42"},
+		{"input()", "last"},
+		{"readLine()", "null"},
+		{`input("more? ")`, "null"},
+	} {
+		result, err := in.Eval(test.input)
+		eq(t, nil, err, "Unexpected error")
+		eq(t, test.expected, result.Inspect(), "Line mismatch for "+test.input)
+	}
+	eq(t, "name? more? ", stdout.String(), "input should write its prompt")
+
+	for _, test := range []struct {
+		input    string
+		expected string
+	}{
+		{"input(1)", "argument to `input` must be STRING, got INTEGER"},
+		{`input("a", "b")`, "wrong number of arguments. got=2, want=0 or 1"},
+		{"readLine(1)", "wrong number of arguments. got=1, want=0"},
+	} {
+		_, err := in.Eval(test.input)
+		notEq(t, nil, err, "Expected an error for "+test.input)
+		eq(t, test.expected, err.(*RuntimeError).Err.Message, "Error mismatch")
+	}
+}
+
+func Test_Limits(t *testing.T) {
+	in := New(WithMaxSteps(10000))
+
+	_, err := in.Eval("while (true) { }")
+	eq(t, true, errors.Is(err, ErrLimitExceeded), "Expected the step limit to stop the loop")
+	eq(t, "1:8: limit exceeded: more than 10000 steps", err.Error(), "Error mismatch")
+
+	result, err := in.Eval("let n = 0; while (n < 100) { n = n + 1 } n")
+	eq(t, nil, err, "Steps should be counted per run")
+	eq(t, "100", result.Inspect(), "Result mismatch")
+
+	_, err = New().Eval("let f = fn(n) { f(n + 1) }; f(0)")
+	eq(t, true, errors.Is(err, ErrLimitExceeded), "Expected the default depth to stop the recursion")
+
+	_, err = New(WithTimeout(10 * time.Millisecond)).Eval("while (true) { }")
+	eq(t, true, errors.Is(err, context.DeadlineExceeded), "Expected the timeout to stop the loop")
+	eq(t, true, errors.Is(err, ErrLimitExceeded), "Timeouts are exceeded limits")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = New().EvalContext(ctx, "let i = 0; while (true) { i = i + 1 }")
+	eq(t, true, errors.Is(err, context.Canceled), "Expected the cancellation to stop the loop")
+
+	_, err = New().Eval("1 / 0")
+	eq(t, false, errors.Is(err, ErrLimitExceeded), "Other errors are not exceeded limits")
+}
+
+func Test_EvalFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "script.monkie")
+	err := os.WriteFile(path, []byte("let x = 1;\nx + undefined"), 0o644)
+	eq(t, nil, err, "Failed to write the script")
+
+	_, err = New().EvalFile(path)
+	eq(t, path+":2:5: error[R0001]: identifier not found: undefined", err.Error(), "Error should point into the file")
+
+	_, err = New().EvalFile(filepath.Join(t.TempDir(), "missing.monkie"))
+	eq(t, true, errors.Is(err, os.ErrNotExist), "Expected a file not found error")
+}
+
+type point struct {
+	X     int
+	Y     int
+	Label string `monkie:"label"`
+	note  string
+}
+
+func Test_Register(t *testing.T) {
+	in := New()
+
+	for name, value := range map[string]interface{}{
+		"add":  func(a, b int) int { return a + b },
+		"join": func(sep string, parts ...string) string { return strings.Join(parts, sep) },
+		"scale": func(p point, by float64) point {
+			return point{X: int(float64(p.X) * by), Y: int(float64(p.Y) * by), Label: p.Label}
+		},
+		"checked": func(n int) (int, error) {
+			if n < 0 {
+				return 0, fmt.Errorf("negative: %d", n)
+			}
+			return n, nil
+		},
+		"nothing": func() {},
+		"explode": func() int { panic("kaboom") },
+		"origin":  point{Label: "o", note: "hidden"},
+		"big":     uint64(1) << 63,
+		"ratio":   float32(0.5),
+		"names":   []string{"a", "b"},
+		"ages":    map[string]int{"ann": 30},
+	} {
+		eq(t, nil, in.Register(name, value), "Unexpected error registering "+name)
+	}
+
+	for _, test := range []struct {
+		input    string
+		expected string
+	}{
+		{"add(2, 3)", "5"},
+		{`join("-", "a", "b", "c")`, "a-b-c"},
+		{`join(",")`, ""},
+		{`let s = scale({"X": 1, "Y": 2, "label": "p"}, 2.5); [s["X"], s["Y"], s["label"]]`, "[2, 5, p]"},
+		{"checked(4)", "4"},
+		{`try { checked(-1) } catch (e) { e["message"] }`, "negative: -1"},
+		{"nothing()", "null"},
+		{`[origin["X"], origin["label"], origin["note"]]`, "[0, o, null]"},
+		{"big", "9223372036854775808"},
+		{"ratio", "0.5"},
+		{"names", "[a, b]"},
+		{`ages["ann"]`, "30"},
+	} {
+		t.Run(fmt.Sprintf("Test registered values in %s", test.input), func(t *testing.T) {
+			result, err := in.Eval(test.input)
+
+			eq(t, nil, err, "Unexpected error")
+			eq(t, test.expected, result.Inspect(), "Result mismatch")
+		})
+	}
+
+	for _, test := range []struct {
+		input    string
+		expected string
+	}{
+		{"add(1)", "wrong number of arguments. got=1, want=2 in call to `add`"},
+		{`add(1, "2")`, "argument 2: cannot use STRING as int in call to `add`"},
+		{"add(1, 99999999999999999999)", "argument 2: 99999999999999999999 overflows int in call to `add`"},
+		{"join()", "wrong number of arguments. got=0, want=at least 1 in call to `join`"},
+		{"checked(-2)", "negative: -2"},
+		{"explode()", "`explode` panicked: kaboom"},
+	} {
+		t.Run(fmt.Sprintf("Test registered function errors in %s", test.input), func(t *testing.T) {
+			_, err := in.Eval(test.input)
+
+			notEq(t, nil, err, "Expected an error")
+			eq(t, test.expected, err.(*RuntimeError).Err.Message, "Error mismatch")
+		})
+	}
+
+	notEq(t, nil, in.Register("pair", func() (int, int) { return 1, 2 }), "Two results without an error can't be registered")
+	notEq(t, nil, in.Register("ch", make(chan int)), "Channels can't be converted")
+}
+
+func Test_FromObject(t *testing.T) {
+	in := New()
+
+	result, err := in.Eval(`{"X": 3, "Y": -4, "label": "p", "extra": true}`)
+	eq(t, nil, err, "Unexpected error")
+
+	var p point
+	eq(t, nil, FromObject(result, &p), "Unexpected error")
+	eq(t, point{X: 3, Y: -4, Label: "p"}, p, "Struct mismatch")
+
+	var any interface{}
+	result, _ = in.Eval(`[1, 2.5, "s", first([]), {"k": [true]}]`)
+	eq(t, nil, FromObject(result, &any), "Unexpected error")
+	eq(t, `[]interface {}{1, 2.5, "s", interface {}(nil), map[string]interface {}{"k":[]interface {}{true}}}`, fmt.Sprintf("%#v", any), "Natural value mismatch")
+
+	var small uint8
+	result, _ = in.Eval("256")
+	eq(t, "256 overflows uint8", FromObject(result, &small).Error(), "Overflow should be reported")
+
+	var obj object.Object
+	eq(t, nil, FromObject(result, &obj), "Unexpected error")
+	eq(t, result, obj, "Objects should pass through")
+
+	notEq(t, nil, FromObject(result, p), "Target must be a pointer")
+}
+
+func Test_CallFunction(t *testing.T) {
+	in := New()
+	_, err := in.Eval("let greet = fn(name) { \"hi \" + name };\nlet fail = fn() { 1 / 0 };")
+	eq(t, nil, err, "Unexpected error")
+
+	greet, _ := in.Get("greet")
+	result, err := in.CallFunction(greet, &object.String{Value: "bob"})
+	eq(t, nil, err, "Unexpected error")
+	eq(t, "hi bob", result.Inspect(), "Result mismatch")
+
+	fail, _ := in.Get("fail")
+	_, err = in.CallFunction(fail)
+	eq(t, "2:21: division by zero", err.Error(), "Error mismatch")
+
+	_, err = in.CallFunction(&object.Integer{Value: 1})
+	eq(t, "not a function: INTEGER", err.Error(), "Calling a non function should fail")
+}
+
+func Test_RegisterCallbacks(t *testing.T) {
+	in := New()
+	in.Register("mapInts", func(xs []int, f func(int) (int, error)) ([]int, error) {
+		results := []int{}
+		for _, x := range xs {
+			result, err := f(x)
+			if err != nil {
+				return nil, err
+			}
+			results = append(results, result)
+		}
+		return results, nil
+	})
+	in.Register("sortBy", func(xs []string, less func(a, b string) (bool, error)) ([]string, error) {
+		sorted := append([]string{}, xs...)
+		for i := range sorted {
+			for j := i + 1; j < len(sorted); j++ {
+				swap, err := less(sorted[j], sorted[i])
+				if err != nil {
+					return nil, err
+				}
+				if swap {
+					sorted[i], sorted[j] = sorted[j], sorted[i]
+				}
+			}
+		}
+		return sorted, nil
+	})
+
+	for _, test := range []struct {
+		input    string
+		expected string
+	}{
+		{"mapInts([1, 2, 3], fn(x) { x * x })", "[1, 4, 9]"},
+		{`sortBy(["ccc", "a", "bb"], fn(a, b) { len(a) < len(b) })`, "[a, bb, ccc]"},
+		{`try { mapInts([1], fn(x) { throw "no" }) } catch (e) { e["message"] }`, "no"},
+	} {
+		t.Run(fmt.Sprintf("Test callbacks in %s", test.input), func(t *testing.T) {
+			result, err := in.Eval(test.input)
+
+			eq(t, nil, err, "Unexpected error")
+			eq(t, test.expected, result.Inspect(), "Result mismatch")
+		})
+	}
+
+	for _, test := range []struct {
+		input    string
+		expected string
+	}{
+		{"mapInts([1],\n fn(x) { x / 0 })", "2:12: division by zero"},
+		{`sortBy(["a", "b"], fn(a, b) { a < b })`, "1:33: unknown operator: STRING < STRING"},
+		{`mapInts([1], fn(x) { "s" })`, "1:1: result of callback: cannot use STRING as int"},
+	} {
+		t.Run(fmt.Sprintf("Test callback errors in %s", test.input), func(t *testing.T) {
+			_, err := in.Eval(test.input)
+
+			notEq(t, nil, err, "Expected an error")
+			eq(t, test.expected, err.Error(), "Error mismatch")
+		})
+	}
+
+	for _, test := range []struct {
+		fn       interface{}
+		expected string
+	}{
+		{func(f func(int) int) {}, "cannot register bad: bad: argument 1: callback func(int) int must return an error"},
+		{func(fs []func()) {}, "cannot register bad: bad: argument 1: callback func() must return an error"},
+		{func(s struct{ F func() (func(), error) }) {}, "cannot register bad: bad: argument 1: callback func() must return an error"},
+	} {
+		t.Run(fmt.Sprintf("Test registering %T", test.fn), func(t *testing.T) {
+			err := in.Register("bad", test.fn)
+
+			notEq(t, nil, err, "Expected an error")
+			eq(t, test.expected, err.Error(), "Error mismatch")
+		})
+	}
+}
+
+// Callbacks stored by a registered function can be called once it returned,
+// their failures are returned, not raised
+func Test_StoredCallbacks(t *testing.T) {
+	for _, backend := range []Backend{Evaluator, VM} {
+		t.Run(fmt.Sprintf("Test stored callbacks with backend %d", backend), func(t *testing.T) {
+			in := New(WithBackend(backend))
+			var stored []func(int) (int, error)
+			in.Register("onEvent", func(f func(int) (int, error)) { stored = append(stored, f) })
+
+			_, err := in.Eval(`onEvent(fn(x) { x * 2 }); onEvent(fn(x) { x / 0 }); onEvent(fn(x) { "s" })`)
+			eq(t, nil, err, "Unexpected error")
+			eq(t, 3, len(stored), "Callbacks not stored")
+
+			result, err := stored[0](21)
+			eq(t, nil, err, "Unexpected error")
+			eq(t, 42, result, "Result mismatch")
+
+			for i, expected := range []string{"1:45: division by zero", "result of callback: cannot use STRING as int"} {
+				result, err := stored[i+1](1)
+				notEq(t, nil, err, "Expected an error")
+				eq(t, expected, err.Error(), "Error mismatch")
+				eq(t, 0, result, "Failed callbacks return the zero value")
+
+				var runtimeErr *RuntimeError
+				eq(t, true, errors.As(err, &runtimeErr), "Expected a *RuntimeError")
+			}
+		})
+	}
+}
+
+func Test_VMBackend(t *testing.T) {
+	var stderr bytes.Buffer
+	in := New(WithBackend(VM), WithStderr(&stderr), WithMaxSteps(100000))
+	in.Set("base", &object.Integer{Value: 40})
+	in.Register("twice", func(f func(int) (int, error), x int) (int, error) {
+		x, err := f(x)
+		if err != nil {
+			return 0, err
+		}
+		return f(x)
+	})
+
+	for _, test := range []struct {
+		input    string
+		expected string
+	}{
+		{"let unless = macro(cond, then) { quote(if (!(unquote(cond))) { unquote(then) }) }; 1", "1"},
+		{"let add = fn(x) { base + x };", "null"},
+		{"unless(base > 100, add(2))", "42"},
+		{"twice(fn(x) { x * 3 }, 2)", "18"},
+		{`try { twice(fn(x) { throw "no" }, 1) } catch (e) { e["message"] }`, "no"},
+	} {
+		t.Run(fmt.Sprintf("Test VM eval of %s", test.input), func(t *testing.T) {
+			result, err := in.Eval(test.input)
+
+			eq(t, nil, err, "Unexpected error")
+			eq(t, test.expected, result.Inspect(), "Result mismatch")
+		})
+	}
+
+	add, ok := in.Get("add")
+	eq(t, true, ok, "Global defined by the script should be visible")
+	result, err := in.CallFunction(add, &object.Integer{Value: 1})
+	eq(t, nil, err, "Unexpected error")
+	eq(t, "41", result.Inspect(), "Result mismatch")
+
+	_, ok = in.Get("missing")
+	eq(t, false, ok, "Undefined global should not be found")
+
+	_, err = in.Eval("while (true) { }")
+	eq(t, true, errors.Is(err, ErrLimitExceeded), "Expected the step limit to stop the loop")
+
+	_, err = in.Eval("let f = fn() { throw \"x\" };\nf()")
+	in.Report(err)
+	eq(t, "error: x\n    at f (1:16)\n    at <main> (2:1)\n", stderr.String(), "Report should write the traceback")
+
+	stderr.Reset()
+	_, err = in.Eval("quote(1)")
+	var compileErr *CompileError
+	eq(t, true, errors.As(err, &compileErr), "Expected a *CompileError")
+	in.Report(err)
+	eq(t, "1:1: error[C0001]: `quote` is only supported by the evaluator\n   |\n 1 | quote(1)\n   | ^^^^^^^^\n", stderr.String(), "Report should write the diagnostic")
+
+	constants := len(in.constants)
+	for i := 0; i < 3; i++ {
+		result, err := in.Eval(`12345678 + len("abc")`)
+		eq(t, nil, err, "Unexpected error")
+		eq(t, "12345681", result.Inspect(), "Result mismatch")
+	}
+	eq(t, constants+2, len(in.constants), "Literals should be added to the constants once")
+}
+
+func Test_CompileAndTrace(t *testing.T) {
+	var trace bytes.Buffer
+	in := New(WithBackend(VM), WithTrace(&trace))
+
+	bytecode, err := in.Compile("let x = 1;")
+	eq(t, nil, err, "Unexpected error")
+	eq(t, "x", bytecode.Globals[0], "Globals should be named")
+	eq(t, 0, trace.Len(), "Compiling runs nothing")
+
+	_, err = in.Compile("let = 1;")
+	var parseErr *ParseError
+	eq(t, true, errors.As(err, &parseErr), "Expected a *ParseError")
+
+	result, err := in.Eval("let y = 2; y + 3")
+	eq(t, nil, err, "Unexpected error")
+	eq(t, "5", result.Inspect(), "Result mismatch")
+	eq(t, true, strings.Contains(trace.String(), "OpAdd                    [2, 3]"), "Trace should show the stack")
+}
+
+func Test_EvalCompiledFile(t *testing.T) {
+	compiling := New(WithBackend(VM))
+	compiling.Set("base", &object.Integer{})
+	compiling.Set("zero", &object.Integer{})
+	bytecode, err := compiling.Compile("let twice = fn(x) { x * 2 };\ntwice(base) + 1 / zero")
+	eq(t, nil, err, "Unexpected error")
+
+	var file bytes.Buffer
+	eq(t, nil, compiler.Encode(&file, bytecode), "Unexpected error")
+	path := filepath.Join(t.TempDir(), "script.monkiec")
+	eq(t, nil, os.WriteFile(path, file.Bytes(), 0o644), "Failed to write the program")
+
+	// The globals of the program are linked by name to the ones already set
+	in := New(WithBackend(VM))
+	in.Set("zero", &object.Integer{Value: 1})
+	in.Set("base", &object.Integer{Value: 20})
+	result, err := in.EvalCompiledFile(path)
+	eq(t, nil, err, "Unexpected error")
+	eq(t, "41", result.Inspect(), "Result mismatch")
+
+	twice, ok := in.Get("twice")
+	eq(t, true, ok, "Globals of the program should be visible")
+	result, err = in.CallFunction(twice, &object.Integer{Value: 4})
+	eq(t, nil, err, "Unexpected error")
+	eq(t, "8", result.Inspect(), "Result mismatch")
+
+	in.Set("zero", &object.Integer{Value: 0})
+	_, err = in.EvalCompiledFile(path)
+	var runtimeErr *RuntimeError
+	eq(t, true, errors.As(err, &runtimeErr), "Expected a *RuntimeError")
+
+	source := filepath.Join(t.TempDir(), "script.monkie")
+	eq(t, nil, os.WriteFile(source, []byte("1"), 0o644), "Failed to write the script")
+	_, err = in.EvalCompiledFile(source)
+	eq(t, true, errors.Is(err, compiler.ErrNotCompiled), "Expected ErrNotCompiled")
+}
+
+func Test_Optimizer(t *testing.T) {
+	in := New()
+	program, err := in.Parse("let unless = macro(cond, then) { quote(if (!(unquote(cond))) { unquote(then) }) };\nunless(1 > 2, 3 * 4)")
+	eq(t, nil, err, "Unexpected error")
+	eq(t, "12", program.String(), "Macros should be expanded and the program optimized")
+
+	for _, options := range []optimizer.Options{optimizer.Default, {}} {
+		_, err = New(WithOptimizer(options)).Parse("if (false) { missing }")
+		var resolveErr *ResolveError
+		eq(t, true, errors.As(err, &resolveErr), "Expected a *ResolveError")
+		eq(t, "1:14: error[R0001]: identifier not found: missing", err.Error(), "Pruned code is resolved all the same")
+	}
+
+	program, err = New(WithOptimizer(optimizer.Options{})).Parse("1 + 2")
+	eq(t, nil, err, "Unexpected error")
+	eq(t, "(1 + 2)", program.String(), "Nothing should be optimized")
+
+	for _, backend := range []Backend{Evaluator, VM} {
+		var stderr bytes.Buffer
+		in := New(WithBackend(backend), WithStderr(&stderr), WithOptimizer(optimizer.Options{Fold: true, Prune: true, Inline: true}))
+
+		result, err := in.Eval("let sq = fn(x) { x * x }; let n = 3; sq(n) + sq(2)")
+		eq(t, nil, err, "Unexpected error")
+		eq(t, "13", result.Inspect(), "Result mismatch")
+
+		_, err = in.Eval("let f = fn(x) { x / 0 };\nf(1)")
+		in.Report(err)
+		eq(t, "error: division by zero\n    at <main> (1:19)\n", stderr.String(), "Inlined calls don't show in traces")
+	}
+}
@@ -1,23 +1,50 @@
 package object
 
+// Environment - variables of the program by name, or of a call of a resolved
+// function by slot, see NewFrame
 type Environment struct {
-	store map[string]Object
-	outer *Environment
+	store  map[string]Object
+	slots  []Object
+	names  []string // Names of the slots
+	outer  *Environment
+	io     *IO
+	limits *Limits
 }
 
 func NewEnvironment() *Environment {
-	return &Environment{store: make(map[string]Object), outer: nil}
+	return &Environment{store: make(map[string]Object), outer: nil, io: StdIO}
 }
 
 func NewEnclosedEnv(outerEnv *Environment) *Environment {
 	env := NewEnvironment()
 	env.outer = outerEnv
+	env.io = outerEnv.io
+	env.limits = outerEnv.limits
 	return env
 }
 
+// NewFrame - Creates the environment of a call of a resolved function, with a
+// slot for each of the variables in `names`. Identifiers resolved to the
+// slots read them by index, the others by name like in any environment.
+func NewFrame(outerEnv *Environment, names []string) *Environment {
+	return &Environment{
+		slots:  make([]Object, len(names)),
+		names:  names,
+		outer:  outerEnv,
+		io:     outerEnv.io,
+		limits: outerEnv.limits,
+	}
+}
+
 func (e *Environment) Get(name string) (Object, bool) {
 	obj, ok := e.store[name]
 
+	if !ok {
+		if slot := e.slot(name); slot >= 0 && e.slots[slot] != nil {
+			obj, ok = e.slots[slot], true
+		}
+	}
+
 	if !ok && e.outer != nil {
 		obj, ok = e.outer.Get(name)
 	}
@@ -26,6 +53,77 @@ func (e *Environment) Get(name string) (Object, bool) {
 }
 
 func (e *Environment) Set(name string, value Object) Object {
+	if slot := e.slot(name); slot >= 0 {
+		e.slots[slot] = value
+		return value
+	}
+
+	if e.store == nil {
+		e.store = make(map[string]Object)
+	}
 	e.store[name] = value
 	return value
 }
+
+// Slot - Returns the variable in the slot of the frame `depth` frames out, nil
+// if it isn't set yet
+func (e *Environment) Slot(depth, slot int) Object {
+	env := e
+	for ; depth > 0; depth-- {
+		env = env.outer
+	}
+	return env.slots[slot]
+}
+
+// SetSlot - Sets the variable in the slot of the frame `depth` frames out
+func (e *Environment) SetSlot(depth, slot int, value Object) {
+	env := e
+	for ; depth > 0; depth-- {
+		env = env.outer
+	}
+	env.slots[slot] = value
+}
+
+// Globals - Returns the environment of the globals, the outermost one
+func (e *Environment) Globals() *Environment {
+	env := e
+	for env.outer != nil {
+		env = env.outer
+	}
+	return env
+}
+
+// slot - Returns the index of the slot of the variable, -1 if the frame has
+// no such slot
+func (e *Environment) slot(name string) int {
+	for i := range e.names {
+		if e.names[i] == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// IO - Returns the streams of the program the environment belongs to,
+// inherited by the environments enclosed in it
+func (e *Environment) IO() *IO {
+	return e.io
+}
+
+// SetIO - Sets the streams of the program. Must be called on the global
+// environment before any code runs in it.
+func (e *Environment) SetIO(io *IO) {
+	e.io = io
+}
+
+// Limits - Returns the limits of the program the environment belongs to, nil
+// if it runs without limits
+func (e *Environment) Limits() *Limits {
+	return e.limits
+}
+
+// SetLimits - Sets the limits of the program. Must be called on the global
+// environment before any code runs in it.
+func (e *Environment) SetLimits(limits *Limits) {
+	e.limits = limits
+}
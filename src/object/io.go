@@ -0,0 +1,29 @@
+package object
+
+import (
+	"bufio"
+	"io"
+	"os"
+)
+
+// IO - Where the builtins of a program write their output and read their
+// input from
+type IO struct {
+	Stdout io.Writer
+	Stderr io.Writer
+	Stdin  *bufio.Reader
+}
+
+// StdIO - The standard streams of the process, used by environments with no
+// IO of their own
+var StdIO = &IO{Stdout: os.Stdout, Stderr: os.Stderr, Stdin: bufio.NewReader(os.Stdin)}
+
+// NewIO - Creates an IO over the given streams
+func NewIO(stdout, stderr io.Writer, stdin io.Reader) *IO {
+	reader, ok := stdin.(*bufio.Reader)
+	if !ok {
+		reader = bufio.NewReader(stdin)
+	}
+
+	return &IO{Stdout: stdout, Stderr: stderr, Stdin: reader}
+}
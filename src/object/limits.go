@@ -0,0 +1,22 @@
+package object
+
+import "context"
+
+// Limits - Bounds on the execution of a program, checked by the evaluator
+type Limits struct {
+	MaxSteps int // Nodes evaluated per run, 0 for no limit
+	MaxDepth int // Nested function calls, 0 for no limit
+
+	Context context.Context // Stops the run once done, nil for none
+	Steps   int             // Nodes evaluated so far in the run
+	Depth   int             // Function calls in progress
+	Tripped error           // Limit the run exceeded, failing every step after
+}
+
+// Reset - Starts a new run, bounded by the context
+func (l *Limits) Reset(ctx context.Context) {
+	l.Context = ctx
+	l.Steps = 0
+	l.Depth = 0
+	l.Tripped = nil
+}
@@ -4,22 +4,46 @@ import (
 	"bytes"
 	"fmt"
 	"hash/fnv"
+	"math"
+	"math/big"
+	"sort"
+	"strconv"
 	"strings"
 
+	"sudocoding.xyz/interpreter_in_go/src/code"
 	"sudocoding.xyz/interpreter_in_go/src/parser/ast"
+	"sudocoding.xyz/interpreter_in_go/src/token"
 )
 
 type ObjectType string
-type BuiltinFn func(args ...Object) Object
+
+// BuiltinFn - Go function behind a builtin, called with the context of the
+// call and the evaluated arguments
+type BuiltinFn func(ctx Context, args ...Object) Object
+
+// Context - Gives builtins access to the interpreter running them
+type Context interface {
+	// Call - Calls a function or a builtin with the arguments and returns its
+	// result, an *Error if it failed
+	Call(fn Object, args ...Object) Object
+	// IO - Returns the streams builtins read and write
+	IO() *IO
+}
 
 const (
 	INTEGER_OBJ      ObjectType = "INTEGER"
+	FLOAT_OBJ        ObjectType = "FLOAT"
+	BIG_INTEGER_OBJ  ObjectType = "BIG_INTEGER"
 	BOOLEAN_OBJ      ObjectType = "BOOLEAN"
 	STRING_OBJ       ObjectType = "STRING"
 	NULL_OBJ         ObjectType = "NULL"
 	RETURN_VALUE_OBJ ObjectType = "RETURN_VALUE"
+	BREAK_OBJ        ObjectType = "BREAK"
+	CONTINUE_OBJ     ObjectType = "CONTINUE"
 	ERROR_OBJ        ObjectType = "ERROR"
+	EXCEPTION_OBJ    ObjectType = "EXCEPTION"
 	FUNCTION         ObjectType = "FUNCTION"
+	COMPILED_FN_OBJ  ObjectType = "COMPILED_FUNCTION"
 	BUILTIN_OBJ      ObjectType = "BUILTIN"
 	ARRAY_OBJ        ObjectType = "ARRAY"
 	HASH_OBJ         ObjectType = "HASH"
@@ -45,6 +69,54 @@ func (i *Integer) Inspect() string {
 	return fmt.Sprintf("%d", i.Value)
 }
 
+// BigInteger - arbitrary-precision integer obj type. Holds only values that
+// don't fit an Integer, smaller values are always Integers.
+type BigInteger struct {
+	Value *big.Int
+}
+
+func (bi *BigInteger) Type() ObjectType {
+	return BIG_INTEGER_OBJ
+}
+
+func (bi *BigInteger) Inspect() string {
+	return bi.Value.String()
+}
+
+// NewInteger - Returns the value as an Integer if it fits one, as a BigInteger
+// otherwise
+func NewInteger(value *big.Int) Object {
+	if value.IsInt64() {
+		return &Integer{Value: value.Int64()}
+	}
+	return &BigInteger{Value: value}
+}
+
+// Float - float obj type
+type Float struct {
+	Value float64
+}
+
+func (f *Float) Type() ObjectType {
+	return FLOAT_OBJ
+}
+
+// Inspect - Formats the float in the shortest form that reads back to the same
+// value. Very large and very small floats use the exponent notation. Whole
+// floats keep a `.0` so they can be told apart from integers.
+func (f *Float) Inspect() string {
+	format := byte('f')
+	if abs := math.Abs(f.Value); abs != 0 && (abs < 1e-6 || abs >= 1e21) {
+		format = 'g'
+	}
+
+	str := strconv.FormatFloat(f.Value, format, -1, 64)
+	if strings.ContainsAny(str, ".eIN") {
+		return str
+	}
+	return str + ".0"
+}
+
 // Boolean - boolean obj type
 type Boolean struct {
 	Value bool
@@ -96,9 +168,43 @@ func (rv *ReturnValue) Inspect() string {
 	return rv.Value.Inspect()
 }
 
+// Break Object - Marks that a `break` was reached and the statements up to the
+// innermost loop should be skipped
+type Break struct{}
+
+func (b *Break) Type() ObjectType {
+	return BREAK_OBJ
+}
+
+func (b *Break) Inspect() string {
+	return "break"
+}
+
+// Continue Object - Marks that a `continue` was reached and the statements up
+// to the end of the innermost loop body should be skipped
+type Continue struct{}
+
+func (c *Continue) Type() ObjectType {
+	return CONTINUE_OBJ
+}
+
+func (c *Continue) Inspect() string {
+	return "continue"
+}
+
 // Error Object - err in the program
 type Error struct {
 	Message string
+	Pos     token.Position // Position of the node that failed
+	Stack   []Frame        // Functions the error unwound, innermost first
+	Value   Object         // Value given to `throw`, nil for errors raised by the interpreter
+	Limit   error          // Limit the program exceeded, if that's what stopped it. Such errors can't be caught.
+}
+
+// Frame - A call of a Monkie function that an error unwound
+type Frame struct {
+	Function string         // Name of the called function
+	Pos      token.Position // Position of the call
 }
 
 func (e *Error) Type() ObjectType {
@@ -109,11 +215,109 @@ func (e *Error) Inspect() string {
 	return fmt.Sprintf("ERROR: %s", e.Message)
 }
 
+// Traceback - Renders the error followed by the frames it unwound, innermost
+// first, each with the position the execution was at in it:
+//
+//	error: identifier not found: x
+//	    at inner (sample.monkie:2:3)
+//	    at outer (sample.monkie:5:3)
+//	    at <main> (sample.monkie:8:1)
+//
+// Only the first and last few frames of very deep stacks are kept.
+func (e *Error) Traceback() string {
+	var out bytes.Buffer
+
+	out.WriteString("error: ")
+	out.WriteString(e.Message)
+
+	frames := e.Frames()
+	for i, frame := range frames {
+		if len(frames) > 2*TracebackEdge && i == TracebackEdge {
+			out.WriteString(fmt.Sprintf("\n    ... %d more frames ...", len(frames)-2*TracebackEdge))
+		}
+		if len(frames) > 2*TracebackEdge && i >= TracebackEdge && i < len(frames)-TracebackEdge {
+			continue
+		}
+
+		out.WriteString("\n    at ")
+		out.WriteString(frame.String())
+	}
+
+	return out.String()
+}
+
+// Frames - Returns the frames the error went through, innermost first and
+// ending with `<main>`. Unlike `Stack`, every frame holds the position the
+// execution was at in the function: where the error occurred for the
+// innermost one, and the call to the next function for the others.
+func (e *Error) Frames() []Frame {
+	frames := []Frame{}
+
+	pos := e.Pos
+	for _, frame := range e.Stack {
+		frames = append(frames, Frame{Function: frame.Function, Pos: pos})
+		pos = frame.Pos
+	}
+
+	return append(frames, Frame{Function: "<main>", Pos: pos})
+}
+
+// String - Returns the frame in the `function (file:line:column)` form
+func (f Frame) String() string {
+	if !f.Pos.IsValid() {
+		return f.Function
+	}
+	return fmt.Sprintf("%s (%s)", f.Function, f.Pos)
+}
+
+// Exception - An error caught by `try`/`catch`. Gives the script access to the
+// error through the `message`, `position`, `stack` and `value` fields.
+type Exception struct {
+	Err *Error
+}
+
+func (e *Exception) Type() ObjectType {
+	return EXCEPTION_OBJ
+}
+
+func (e *Exception) Inspect() string {
+	return fmt.Sprintf("EXCEPTION: %s", e.Err.Message)
+}
+
+// Field - Returns the field of the exception with the given name
+func (e *Exception) Field(name string) (Object, bool) {
+	switch name {
+	case "message":
+		return &String{Value: e.Err.Message}, true
+	case "position":
+		return &String{Value: e.Err.Pos.String()}, true
+	case "stack":
+		stack := &Array{}
+		for _, frame := range e.Err.Frames() {
+			stack.Elements = append(stack.Elements, &String{Value: frame.String()})
+		}
+		return stack, true
+	case "value":
+		if e.Err.Value == nil {
+			return &String{Value: e.Err.Message}, true
+		}
+		return e.Err.Value, true
+	}
+
+	return nil, false
+}
+
+// TracebackEdge - Number of innermost and outermost frames kept by Traceback
+const TracebackEdge = 10
+
 // Function Object - functions
 type Function struct {
 	Parameters []*ast.Identifier
 	Body       *ast.BlockStatement
 	Env        *Environment
+	Name       string
+	Locals     []string // Slots of the frames of its calls, see ast.FunctionLiteral
+	Assigned   []int    // Slots starting as the variables outside of the function
 }
 
 func (f *Function) Type() ObjectType {
@@ -138,6 +342,49 @@ func (f *Function) Inspect() string {
 	return out.String()
 }
 
+// CompiledFunction - Function compiled to bytecode, a constant of the
+// compiled program. Running it takes a Closure.
+type CompiledFunction struct {
+	Instructions  code.Instructions
+	Positions     code.PosTable // Source positions of the instructions
+	NumLocals     int           // Parameters included
+	NumParameters int
+	Name          string
+	LocalNames    []string // Names of the locals by slot, parameters first
+}
+
+func (cf *CompiledFunction) Type() ObjectType {
+	return COMPILED_FN_OBJ
+}
+
+func (cf *CompiledFunction) Inspect() string {
+	return fmt.Sprintf("fn(%s) { <compiled> }", strings.Join(cf.LocalNames[:cf.NumParameters], ", "))
+}
+
+// Closure - Compiled function along with the locals of the functions it was
+// created in. Scripts see closures as functions, like the ones of the
+// evaluator.
+type Closure struct {
+	Fn    *CompiledFunction
+	Outer *Scope
+}
+
+func (c *Closure) Type() ObjectType {
+	return FUNCTION
+}
+
+func (c *Closure) Inspect() string {
+	return c.Fn.Inspect()
+}
+
+// Scope - Locals of a call of a compiled function, outliving the call when
+// closures created in it capture them
+type Scope struct {
+	Locals []Object
+	Names  []string // Names of the locals by slot
+	Outer  *Scope   // Scope of the function the called one was created in
+}
+
 // Built-in Function - predefined function that Monkie lang provides
 type Builtin struct {
 	Fn BuiltinFn
@@ -214,6 +461,36 @@ func (h *Hash) Inspect() string {
 	return out.String()
 }
 
+// SortedPairs - Returns the pairs of the hash in a deterministic order: keys
+// are grouped by type, then ordered by value
+func (h *Hash) SortedPairs() []HashPair {
+	pairs := make([]HashPair, 0, len(h.Pairs))
+	for _, pair := range h.Pairs {
+		pairs = append(pairs, pair)
+	}
+
+	sort.Slice(pairs, func(i, j int) bool {
+		a, b := pairs[i].Key, pairs[j].Key
+		if a.Type() != b.Type() {
+			return a.Type() < b.Type()
+		}
+
+		switch a := a.(type) {
+		case *Integer:
+			return a.Value < b.(*Integer).Value
+		case *Float:
+			return a.Value < b.(*Float).Value
+		case *BigInteger:
+			return a.Value.Cmp(b.(*BigInteger).Value) < 0
+		case *Boolean:
+			return !a.Value && b.(*Boolean).Value
+		}
+		return a.Inspect() < b.Inspect()
+	})
+
+	return pairs
+}
+
 // Hashing Function for Objects
 
 func (b *Boolean) Hash() HashKey {
@@ -227,6 +504,16 @@ func (i *Integer) Hash() HashKey {
 	return HashKey{Type: i.Type(), Value: uint64(i.Value)}
 }
 
+func (f *Float) Hash() HashKey {
+	return HashKey{Type: f.Type(), Value: math.Float64bits(f.Value)}
+}
+
+func (bi *BigInteger) Hash() HashKey {
+	h := fnv.New64()
+	h.Write([]byte(bi.Value.String()))
+	return HashKey{Type: bi.Type(), Value: h.Sum64()}
+}
+
 func (s *String) Hash() HashKey {
 	h := fnv.New64()
 	h.Write([]byte(s.Value))
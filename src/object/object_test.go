@@ -1,8 +1,13 @@
 package object
 
 import (
+	"fmt"
+	"math"
+	"math/big"
 	"strings"
 	"testing"
+
+	"sudocoding.xyz/interpreter_in_go/src/token"
 )
 
 func eq[T comparable](t *testing.T, expected T, actual T, msg ...string) {
@@ -41,3 +46,63 @@ func Test_HashFetching(t *testing.T) {
 	eq(t, monkie, pairs[name2.Hash()].(*String))
 	eq(t, monkie.Inspect(), pairs[name2.Hash()].Inspect())
 }
+
+func Test_ErrorTraceback(t *testing.T) {
+	at := func(line, column int) token.Position {
+		return token.Position{Filename: "a.monkie", Line: line, Column: column}
+	}
+
+	err := &Error{
+		Message: "identifier not found: x",
+		Pos:     at(2, 3),
+		Stack:   []Frame{{Function: "inner", Pos: at(5, 3)}, {Function: "outer", Pos: at(8, 1)}},
+	}
+	eq(t, "error: identifier not found: x\n"+
+		"    at inner (a.monkie:2:3)\n"+
+		"    at outer (a.monkie:5:3)\n"+
+		"    at <main> (a.monkie:8:1)", err.Traceback())
+
+	eq(t, "error: oops\n    at <main>", (&Error{Message: "oops"}).Traceback())
+
+	deep := &Error{Message: "deep", Pos: at(1, 1)}
+	for i := 0; i < 100; i++ {
+		deep.Stack = append(deep.Stack, Frame{Function: fmt.Sprintf("f%d", i), Pos: at(1, 1)})
+	}
+	lines := strings.Split(deep.Traceback(), "\n")
+	eq(t, 2*TracebackEdge+2, len(lines), "Expected deep stacks to be truncated")
+	eq(t, "    ... 81 more frames ...", lines[TracebackEdge+1])
+	eq(t, "    at <main> (a.monkie:1:1)", lines[len(lines)-1])
+}
+
+func Test_FloatInspect(t *testing.T) {
+	for _, test := range []struct {
+		value    float64
+		expected string
+	}{
+		{1.5, "1.5"},
+		{2, "2.0"},
+		{-0.25, "-0.25"},
+		{2e10, "20000000000.0"},
+		{1e21, "1e+21"},
+		{1e-7, "1e-07"},
+		{0, "0.0"},
+		{math.Inf(1), "+Inf"},
+		{math.NaN(), "NaN"},
+	} {
+		t.Run(fmt.Sprintf("Test inspect for %v", test.value), func(t *testing.T) {
+			eq(t, test.expected, (&Float{Value: test.value}).Inspect())
+		})
+	}
+}
+
+func Test_BigInteger(t *testing.T) {
+	huge, _ := new(big.Int).SetString("99999999999999999999", 10)
+	same, _ := new(big.Int).SetString("99999999999999999999", 10)
+
+	eq(t, (&BigInteger{Value: huge}).Hash(), (&BigInteger{Value: same}).Hash())
+	notEq(t, (&BigInteger{Value: huge}).Hash(), (&BigInteger{Value: big.NewInt(1)}).Hash())
+
+	eq(t, BIG_INTEGER_OBJ, NewInteger(huge).Type(), "Expected large values to stay big")
+	eq(t, INTEGER_OBJ, NewInteger(big.NewInt(42)).Type(), "Expected small values to become Integers")
+	eq(t, int64(42), NewInteger(big.NewInt(42)).(*Integer).Value)
+}
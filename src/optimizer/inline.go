@@ -0,0 +1,225 @@
+package optimizer
+
+import (
+	"sudocoding.xyz/interpreter_in_go/src/evaluator"
+	"sudocoding.xyz/interpreter_in_go/src/parser/ast"
+)
+
+// collectBindings - counts the declarations and the assignments of each name
+// in the program and notes the names declared in its functions
+func (o *optimizer) collectBindings(program ast.Node) {
+	o.declared = map[string]int{}
+	o.locals = map[string]bool{}
+
+	o.bindings(program, func(id *ast.Identifier, declaration bool) {
+		o.declared[id.Value] += 1
+	})
+}
+
+// bindings - calls bind with the identifiers the node declares or assigns,
+// at any depth. The names declared in the functions met on the way are noted
+// as locals.
+func (o *optimizer) bindings(node ast.Node, bind func(id *ast.Identifier, declaration bool)) {
+	ast.Modify(node, func(node ast.Node) ast.Node {
+		switch node := node.(type) {
+		case *ast.LetStatement:
+			bind(node.Name, true)
+		case *ast.Assignment:
+			bind(node.Identifier, false)
+		case *ast.ForStatement:
+			if node.Key != nil {
+				bind(node.Key, true)
+			}
+			bind(node.Value, true)
+		case *ast.TryExpression:
+			if node.Catch != nil {
+				bind(node.Param, true)
+			}
+		case *ast.FunctionLiteral:
+			for _, param := range node.Parameters {
+				bind(param, true)
+			}
+
+			local := func(id *ast.Identifier, declaration bool) {
+				if declaration {
+					o.locals[id.Value] = true
+				}
+			}
+			for _, param := range node.Parameters {
+				local(param, true)
+			}
+			o.bindings(node.Body, local)
+		case *ast.CallExpression:
+			// Modify doesn't go through calls
+			o.bindings(node.Function, bind)
+			for _, arg := range node.Arguments {
+				o.bindings(arg, bind)
+			}
+		}
+		return node
+	})
+}
+
+// isInlinable - whether the calls of the function bound to the name can be
+// replaced by its body: a small expression of its parameters and of globals
+// no function can hide, not calling the function itself
+func (o *optimizer) isInlinable(name string, fn *ast.FunctionLiteral) bool {
+	if !o.options.Inline || o.declared[name] != 1 || o.locals[name] {
+		return false
+	}
+
+	body := inlinedBody(fn)
+	if body == nil {
+		return false
+	}
+
+	params := map[string]bool{}
+	for _, param := range fn.Parameters {
+		params[param.Value] = true
+	}
+
+	size := 0
+	ok := true
+	var check func(node ast.Expression)
+	check = func(node ast.Expression) {
+		size += 1
+
+		switch node := node.(type) {
+		case *ast.IntegerLiteral, *ast.BigIntegerLiteral, *ast.FloatLiteral, *ast.StringLiteral, *ast.Boolean:
+		case *ast.Identifier:
+			if node.Value == name || (!params[node.Value] && o.locals[node.Value]) {
+				ok = false
+			}
+		case *ast.PrefixExpression:
+			check(node.Right)
+		case *ast.InfixExpression:
+			check(node.Left)
+			check(node.Right)
+		case *ast.IndexExpression:
+			check(node.Left)
+			check(node.Index)
+		case *ast.ArrayLiteral:
+			for _, elm := range node.Elements {
+				check(elm)
+			}
+		case *ast.InterpolatedString:
+			for _, part := range node.Parts {
+				check(part)
+			}
+		case *ast.CallExpression:
+			if node.Function.TokenLiteral() == evaluator.QUOTE_LITERAL {
+				ok = false
+			}
+			check(node.Function)
+			for _, arg := range node.Arguments {
+				check(arg)
+			}
+		default:
+			ok = false
+		}
+	}
+	check(body)
+
+	return ok && size <= maxInlineSize
+}
+
+// inlinedBody - the expression the function is worth, nil if its body isn't
+// a single expression
+func inlinedBody(fn *ast.FunctionLiteral) ast.Expression {
+	if len(fn.Body.Statements) != 1 {
+		return nil
+	}
+
+	switch statement := fn.Body.Statements[0].(type) {
+	case *ast.ExpressionStatement:
+		return statement.Expression
+	case *ast.ReturnStatement:
+		return statement.ReturnValue
+	}
+	return nil
+}
+
+// inline - the body of the called function in place of the call, if the
+// function is inlinable and the arguments are constants or variables, which
+// can be used any number of times
+func (o *optimizer) inline(call *ast.CallExpression) ast.Expression {
+	id, ok := call.Function.(*ast.Identifier)
+	if !ok || o.inlining[id.Value] {
+		return call
+	}
+
+	fn, ok := o.inlinable[id.Value]
+	if !ok || len(call.Arguments) != len(fn.Parameters) {
+		return call
+	}
+
+	args := map[string]ast.Expression{}
+	for i, arg := range call.Arguments {
+		if _, ok := arg.(*ast.Identifier); !ok && !isConstant(arg) {
+			return call
+		}
+		args[fn.Parameters[i].Value] = arg
+	}
+
+	// Functions called by the body are inlined in turn, but not this one
+	// again
+	o.inlining[id.Value] = true
+	defer delete(o.inlining, id.Value)
+
+	return o.expression(substitute(inlinedBody(fn), args))
+}
+
+// substitute - a copy of the expression with the arguments in place of the
+// parameters
+func substitute(node ast.Expression, args map[string]ast.Expression) ast.Expression {
+	switch node := node.(type) {
+	case *ast.Identifier:
+		if arg, ok := args[node.Value]; ok {
+			if id, ok := arg.(*ast.Identifier); ok {
+				copied := *id
+				return &copied
+			}
+			return arg
+		}
+		copied := *node
+		return &copied
+	case *ast.PrefixExpression:
+		copied := *node
+		copied.Right = substitute(node.Right, args)
+		return &copied
+	case *ast.InfixExpression:
+		copied := *node
+		copied.Left = substitute(node.Left, args)
+		copied.Right = substitute(node.Right, args)
+		return &copied
+	case *ast.IndexExpression:
+		copied := *node
+		copied.Left = substitute(node.Left, args)
+		copied.Index = substitute(node.Index, args)
+		return &copied
+	case *ast.ArrayLiteral:
+		copied := *node
+		copied.Elements = substituteAll(node.Elements, args)
+		return &copied
+	case *ast.InterpolatedString:
+		copied := *node
+		copied.Parts = substituteAll(node.Parts, args)
+		return &copied
+	case *ast.CallExpression:
+		copied := *node
+		copied.Function = substitute(node.Function, args)
+		copied.Arguments = substituteAll(node.Arguments, args)
+		return &copied
+	}
+
+	// Literals, never changed in place
+	return node
+}
+
+func substituteAll(nodes []ast.Expression, args map[string]ast.Expression) []ast.Expression {
+	copied := make([]ast.Expression, len(nodes))
+	for i, node := range nodes {
+		copied[i] = substitute(node, args)
+	}
+	return copied
+}
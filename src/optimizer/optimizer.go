@@ -0,0 +1,340 @@
+// Package optimizer - rewrites programs, once their macros are expanded, into
+// simpler ones computing the same
+package optimizer
+
+import (
+	"math"
+	"math/big"
+
+	"sudocoding.xyz/interpreter_in_go/src/evaluator"
+	"sudocoding.xyz/interpreter_in_go/src/object"
+	"sudocoding.xyz/interpreter_in_go/src/parser/ast"
+	"sudocoding.xyz/interpreter_in_go/src/token"
+)
+
+// Options - the rewrites to make
+type Options struct {
+	// Compute the expressions of constants: arithmetic, comparisons, string
+	// concatenation and interpolation. Expressions failing, like `1 / 0`,
+	// are left to fail when the program runs.
+	Fold bool
+
+	// Drop the branches of `if`s that can't run, their conditions being
+	// constants, and the statements after `return`, `throw`, `break` and
+	// `continue`
+	Prune bool
+
+	// Replace the calls of small functions by their bodies. Only functions
+	// bound once by a `let` at the top of the program, whose body is a single
+	// expression of their parameters and of globals, are inlined, in the code
+	// after the `let`. Inlined calls don't show in stack traces and don't
+	// count against the depth limit, and redefining the function from Go or
+	// from a later program doesn't change them.
+	Inline bool
+}
+
+// Default - the rewrites made unless asked otherwise, the ones programs can't
+// tell apart
+var Default = Options{Fold: true, Prune: true}
+
+const (
+	maxInlineSize = 24  // Nodes of the largest function body inlined
+	maxExponent   = 256 // Largest constant exponent or shift folded, bigger ones make huge numbers
+)
+
+// Optimize - rewrites the program with the options, in place
+func Optimize(program ast.Node, options Options) ast.Node {
+	o := &optimizer{options: options, inlinable: map[string]*ast.FunctionLiteral{}, inlining: map[string]bool{}}
+	if options.Inline {
+		o.collectBindings(program)
+	}
+
+	return o.node(program)
+}
+
+type optimizer struct {
+	options Options
+
+	declared  map[string]int                  // Times each name is declared in the program, or assigned
+	locals    map[string]bool                 // Names declared in functions
+	inlinable map[string]*ast.FunctionLiteral // Functions whose calls are inlined from here on
+	inlining  map[string]bool                 // Functions whose body is being inlined, not to inline again
+}
+
+func (o *optimizer) node(node ast.Node) ast.Node {
+	switch node := node.(type) {
+	case *ast.Program:
+		node.Statements = o.statements(node.Statements, true)
+	case *ast.BlockStatement:
+		node.Statements = o.statements(node.Statements, false)
+	case *ast.ExpressionStatement:
+		node.Expression = o.expression(node.Expression)
+	case *ast.LetStatement:
+		node.Value = o.expression(node.Value)
+	case *ast.Assignment:
+		node.Value = o.expression(node.Value)
+	case *ast.ReturnStatement:
+		node.ReturnValue = o.expression(node.ReturnValue)
+	case *ast.ThrowStatement:
+		node.Value = o.expression(node.Value)
+	case *ast.WhileStatement:
+		node.Condition = o.expression(node.Condition)
+		o.node(node.Body)
+	case *ast.ForStatement:
+		node.Iterable = o.expression(node.Iterable)
+		o.node(node.Body)
+	default:
+		if expression, ok := node.(ast.Expression); ok {
+			return o.expression(expression)
+		}
+	}
+
+	return node
+}
+
+// statements - optimizes the statements of a program or a block. The value of
+// the last one may be the value of the block, the others' are dropped.
+// Functions let at the top of the program, which are always bound after
+// their `let`, are inlined in the statements following it.
+func (o *optimizer) statements(statements []ast.Statement, top bool) []ast.Statement {
+	out := []ast.Statement{}
+
+	for i, statement := range statements {
+		o.node(statement)
+
+		if let, ok := statement.(*ast.LetStatement); ok && top {
+			if fn, ok := let.Value.(*ast.FunctionLiteral); ok && o.isInlinable(let.Name.Value, fn) {
+				o.inlinable[let.Name.Value] = fn
+			}
+		}
+
+		if branch, ok := o.staticBranch(statement); ok && (i < len(statements)-1 || len(branch) > 0) {
+			// The statements of the branch run in place of the `if`. Blocks
+			// don't scope variables, so they mean the same there.
+			out = append(out, branch...)
+		} else {
+			out = append(out, statement)
+		}
+	}
+
+	if o.options.Prune {
+		for i, statement := range out {
+			if isTerminal(statement) {
+				return out[:i+1]
+			}
+		}
+	}
+
+	return out
+}
+
+// staticBranch - the statements of the branch an `if` statement with a
+// constant condition runs
+func (o *optimizer) staticBranch(statement ast.Statement) ([]ast.Statement, bool) {
+	es, ok := statement.(*ast.ExpressionStatement)
+	if !ok || !o.options.Prune {
+		return nil, false
+	}
+
+	ie, ok := es.Expression.(*ast.IfExpression)
+	if !ok || !isConstant(ie.Condition) {
+		return nil, false
+	}
+
+	if truthy(ie.Condition) {
+		return ie.Consequence.Statements, true
+	}
+	if ie.Alternative != nil {
+		return ie.Alternative.Statements, true
+	}
+	return []ast.Statement{}, true
+}
+
+// isTerminal - whether the statements after this one never run
+func isTerminal(statement ast.Statement) bool {
+	switch statement.(type) {
+	case *ast.ReturnStatement, *ast.ThrowStatement, *ast.BreakStatement, *ast.ContinueStatement:
+		return true
+	}
+	return false
+}
+
+func (o *optimizer) expression(node ast.Expression) ast.Expression {
+	switch node := node.(type) {
+	case *ast.PrefixExpression:
+		node.Right = o.expression(node.Right)
+		if isConstant(node.Right) {
+			return o.fold(node)
+		}
+	case *ast.InfixExpression:
+		node.Left = o.expression(node.Left)
+		node.Right = o.expression(node.Right)
+
+		// `&&` and `||` are the deciding operand, the left one when it's
+		// enough
+		switch token.TokenType(node.Operator) {
+		case token.AND, token.OR:
+			if o.options.Fold && isConstant(node.Left) {
+				if truthy(node.Left) == (token.TokenType(node.Operator) == token.AND) {
+					return node.Right
+				}
+				return node.Left
+			}
+			return node
+		}
+
+		if isConstant(node.Left) && isConstant(node.Right) && !isHuge(node) {
+			return o.fold(node)
+		}
+	case *ast.InterpolatedString:
+		constant := true
+		for i, part := range node.Parts {
+			node.Parts[i] = o.expression(part)
+			constant = constant && isConstant(node.Parts[i])
+		}
+		if constant {
+			return o.fold(node)
+		}
+	case *ast.ArrayLiteral:
+		for i, elm := range node.Elements {
+			node.Elements[i] = o.expression(elm)
+		}
+	case *ast.HashLiteral:
+		pairs := map[ast.Expression]ast.Expression{}
+		for _, key := range node.SortedKeys() {
+			pairs[o.expression(key)] = o.expression(node.Pairs[key])
+		}
+		node.Pairs = pairs
+	case *ast.IndexExpression:
+		node.Left = o.expression(node.Left)
+		node.Index = o.expression(node.Index)
+	case *ast.IfExpression:
+		node.Condition = o.expression(node.Condition)
+		o.node(node.Consequence)
+		if node.Alternative != nil {
+			o.node(node.Alternative)
+		}
+		return o.pruneIf(node)
+	case *ast.TryExpression:
+		o.node(node.Block)
+		if node.Catch != nil {
+			o.node(node.Catch)
+		}
+		if node.Finally != nil {
+			o.node(node.Finally)
+		}
+	case *ast.FunctionLiteral:
+		o.node(node.Body)
+	case *ast.CallExpression:
+		// Quoted code is data, for macros to expand somewhere else
+		if node.Function.TokenLiteral() == evaluator.QUOTE_LITERAL {
+			return node
+		}
+
+		node.Function = o.expression(node.Function)
+		for i, arg := range node.Arguments {
+			node.Arguments[i] = o.expression(arg)
+		}
+		return o.inline(node)
+	}
+
+	return node
+}
+
+// pruneIf - the `if` without the branch its constant condition never runs.
+// Ifs whose value doesn't matter are replaced by their branch altogether,
+// see statements.
+func (o *optimizer) pruneIf(ie *ast.IfExpression) ast.Expression {
+	if !o.options.Prune || !isConstant(ie.Condition) {
+		return ie
+	}
+
+	branch := ie.Alternative
+	if truthy(ie.Condition) {
+		branch = ie.Consequence
+	}
+
+	// A branch of a single expression is worth that expression
+	if branch != nil && len(branch.Statements) == 1 {
+		if es, ok := branch.Statements[0].(*ast.ExpressionStatement); ok && es.Expression != nil {
+			return es.Expression
+		}
+	}
+
+	pruned := *ie
+	pruned.Alternative = nil
+	if branch == nil {
+		// Worth null, the condition being false
+		pruned.Consequence = &ast.BlockStatement{Token: ie.Consequence.Token, RBrace: ie.Consequence.RBrace}
+	} else {
+		pruned.Condition = &ast.Boolean{Token: token.Token{Type: token.TRUE, Literal: "true", Pos: ie.Condition.Pos(), End: ie.Condition.End()}, Value: true}
+		pruned.Consequence = branch
+	}
+	return &pruned
+}
+
+// fold - the literal of the value of the expression of constants, the
+// expression itself if computing it fails
+func (o *optimizer) fold(node ast.Expression) ast.Expression {
+	if !o.options.Fold {
+		return node
+	}
+
+	value := evaluator.Eval(node, object.NewEnvironment())
+	pos, end := node.Pos(), node.End()
+
+	switch value := value.(type) {
+	case *object.Integer:
+		return &ast.IntegerLiteral{Token: token.Token{Type: token.INT, Literal: value.Inspect(), Pos: pos, End: end}, Value: value.Value}
+	case *object.BigInteger:
+		return &ast.BigIntegerLiteral{Token: token.Token{Type: token.INT, Literal: value.Inspect(), Pos: pos, End: end}, Value: value.Value}
+	case *object.Float:
+		if math.IsInf(value.Value, 0) || math.IsNaN(value.Value) {
+			return node
+		}
+		return &ast.FloatLiteral{Token: token.Token{Type: token.FLOAT, Literal: value.Inspect(), Pos: pos, End: end}, Value: value.Value}
+	case *object.String:
+		return &ast.StringLiteral{Token: token.Token{Type: token.STR, Literal: value.Value, Pos: pos, End: end}, Value: value.Value}
+	case *object.Boolean:
+		t := token.Token{Type: token.FALSE, Literal: "false", Pos: pos, End: end}
+		if value.Value {
+			t.Type, t.Literal = token.TRUE, "true"
+		}
+		return &ast.Boolean{Token: t, Value: value.Value}
+	}
+
+	return node
+}
+
+// isConstant - whether the expression is a literal of a number, a string or
+// a boolean
+func isConstant(node ast.Expression) bool {
+	switch node.(type) {
+	case *ast.IntegerLiteral, *ast.BigIntegerLiteral, *ast.FloatLiteral, *ast.StringLiteral, *ast.Boolean:
+		return true
+	}
+	return false
+}
+
+// truthy - whether the constant counts as true in conditions
+func truthy(node ast.Expression) bool {
+	return evaluator.IsTruthy(evaluator.Eval(node, object.NewEnvironment()))
+}
+
+// isHuge - whether folding the operation of constants would make a number
+// too big to hold in the program
+func isHuge(node *ast.InfixExpression) bool {
+	switch token.TokenType(node.Operator) {
+	case token.POWER, token.SHL:
+	default:
+		return false
+	}
+
+	switch right := node.Right.(type) {
+	case *ast.IntegerLiteral:
+		return right.Value > maxExponent
+	case *ast.BigIntegerLiteral:
+		return right.Value.Cmp(big.NewInt(maxExponent)) > 0
+	}
+	return false
+}
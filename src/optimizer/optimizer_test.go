@@ -0,0 +1,163 @@
+package optimizer
+
+import (
+	"strings"
+	"testing"
+
+	"sudocoding.xyz/interpreter_in_go/src/evaluator"
+	"sudocoding.xyz/interpreter_in_go/src/lexer"
+	"sudocoding.xyz/interpreter_in_go/src/object"
+	"sudocoding.xyz/interpreter_in_go/src/parser"
+	"sudocoding.xyz/interpreter_in_go/src/parser/ast"
+)
+
+func eq[T comparable](t *testing.T, expected T, actual T, msg ...string) {
+	if expected != actual {
+		t.Fatalf("%s\nexpected: %+v\nactual: %+v\n", strings.Join(msg, " "), expected, actual)
+	}
+}
+
+func parse(t *testing.T, input string) *ast.Program {
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	eq(t, 0, len(p.Errors()), "parser errors")
+	return program
+}
+
+// dump - the statements of the program, one per line
+func dump(node ast.Node) string {
+	out := []string{}
+	for _, statement := range node.(*ast.Program).Statements {
+		out = append(out, statement.String())
+	}
+	return strings.Join(out, "\n")
+}
+
+func Test_Fold(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"1 + 2 * 3", "7"},
+		{"-(2 - 5)", "3"},
+		{"2.5 * 2", "5.0"},
+		{"1 < 2 == true", "true"},
+		{`"a" + "b" + "c"`, `"abc"`},
+		{`"n = ${1 + 1}"`, `"n = 2"`},
+		{"9223372036854775807 + 1", "9223372036854775808"},
+		{"!0", "true"},
+		{"x + 1 * 2", "(x + 2)"},
+		{"let f = fn(a) { a * (2 + 3) }", "let f = fn(a)(a * 5);"},
+		{"[1 + 1, {2 * 2: 3 - 3}][0]", "([2, {4 : 0}][0])"},
+		{"true && x", "x"},
+		{"0 || x", "x"},
+		{"false && x", "false"},
+		// Failing or huge expressions are left to run
+		{"1 / 0", "(1 / 0)"},
+		{`1 + "a"`, `(1 + "a")`},
+		{"2 ** 1000", "(2 ** 1000)"},
+		{"1.0 / 0", "(1.0 / 0)"},
+		// Quoted code is data
+		{"quote(1 + 2)", "quote((1 + 2))"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.input, func(t *testing.T) {
+			eq(t, test.expected, dump(Optimize(parse(t, test.input), Default)))
+		})
+	}
+}
+
+func Test_Prune(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"if (true) { a } else { b }", "a"},
+		{"if (1 > 2) { a } else { b }", "b"},
+		{"if (false) { a }; b", "b"},
+		{"if (true) { let x = 1; x }", "let x = 1;\nx"},
+		{"let v = if (false) { a }", "let v = iffalse  ;"},
+		{"let v = if (true) { a; b }", "let v = iftrue  ab;"},
+		{"if (x) { 1 } else { 2 }", "ifx  1else2"},
+		{"let f = fn() { return 1; g() }", "let f = fn()return 1;"},
+		{"while (x) { break; y }\nz", "whilex break;\nz"},
+		{"let f = fn() { if (true) { return 1 }; 2 }", "let f = fn()return 1;"},
+		{"throw \"no\"; x", `throw "no";`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.input, func(t *testing.T) {
+			eq(t, test.expected, dump(Optimize(parse(t, test.input), Default)))
+		})
+	}
+}
+
+func Test_Inline(t *testing.T) {
+	inline := Options{Fold: true, Prune: true, Inline: true}
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let sq = fn(x) { x * x }; sq(3)", "let sq = fn(x)(x * x);\n9"},
+		{"let sq = fn(x) { x * x }; sq(y)", "let sq = fn(x)(x * x);\n(y * y)"},
+		{"let add = fn(a, b) { return a + b }; add(1, 2)", "let add = fn(a,b)return (a + b);\n3"},
+		{"let k = 2; let f = fn(a) { a * k }; f(3)", "let k = 2;\nlet f = fn(a)(a * k);\n(3 * k)"},
+		{"let sq = fn(x) { x * x }; let q = fn(x) { sq(x) + 1 }; q(2)", "let sq = fn(x)(x * x);\nlet q = fn(x)((x * x) + 1);\n5"},
+		// Arguments doing something run once, as calls
+		{"let sq = fn(x) { x * x }; sq(g())", "let sq = fn(x)(x * x);\nsq(g())"},
+		{"let sq = fn(x) { x * x }; sq(1, 2)", "let sq = fn(x)(x * x);\nsq(1, 2)"},
+		// Calls before the function is bound aren't inlined
+		{"let g = fn() { sq(2) }; let sq = fn(x) { x * x }", "let g = fn()sq(2);\nlet sq = fn(x)(x * x);"},
+		// Recursive, rebound, local or big functions aren't either
+		{"let f = fn(n) { f(n - 1) }; f(3)", "let f = fn(n)f((n - 1));\nf(3)"},
+		{"let f = fn() { 1 }; f = fn() { 2 }; f()", "let f = fn()1;\nf = fn()2\nf()"},
+		{"let g = fn() { let f = fn() { 1 }; f() }", "let g = fn()let f = fn()1;f();"},
+		{"let f = fn(a) { a + b }; let g = fn(b) { f(b) }", "let f = fn(a)(a + b);\nlet g = fn(b)f(b);"},
+		{"let f = fn() { let a = 1; a }; f()", "let f = fn()let a = 1;a;\nf()"},
+		{"let f = fn(a) { [a, a, a, a, a, a, a, a, a, a, a, a, a, a, a, a, a, a, a, a, a, a, a, a] }; f(1)",
+			"let f = fn(a)[a, a, a, a, a, a, a, a, a, a, a, a, a, a, a, a, a, a, a, a, a, a, a, a];\nf(1)"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.input, func(t *testing.T) {
+			eq(t, test.expected, dump(Optimize(parse(t, test.input), inline)))
+		})
+	}
+
+	eq(t, "let sq = fn(x)(x * x);\nsq(3)", dump(Optimize(parse(t, "let sq = fn(x) { x * x }; sq(3)"), Default)), "Only inlined when asked")
+}
+
+// Optimized programs give the same results as the ones they come from
+func Test_OptimizedEval(t *testing.T) {
+	tests := []string{
+		"let fib = fn(n) { if (n < 2) { n } else { fib(n - 1) + fib(n - 2) } }; fib(15)",
+		"let sq = fn(x) { x * x }; let sum = fn(a, b) { sq(a) + sq(b) }; sum(3, 4) + sq(2 + 3)",
+		"let k = 10; let f = fn(a) { a * k }; let g = fn(k) { f(k) }; g(2)",
+		"let f = fn(n) { if (n > 0) { return \"pos\"; n } else { return \"neg\" }; 0 }; f(1) + f(-1)",
+		"let i = 0; while (true) { i = i + 1; if (i == 3) { break; i = 100 } }\n i",
+		`let name = "x"; "${1 + 2} ${name} ${"a" + "b"}"`,
+		"if (false) { 1 }",
+		"let v = if (2 > 1) { let t = 5; t * 2 }; v",
+		"let f = fn() { try { throw 1 + 1 } catch (e) { e } }; f()",
+		"2 ** 10 + (1 << 4) - 7 % 3",
+		"[1, 2][3 - 2] + {\"k\" + \"k\": 5}[\"kk\"]",
+	}
+
+	for _, input := range tests {
+		t.Run(input, func(t *testing.T) {
+			expected := evaluator.Eval(parse(t, input), object.NewEnvironment())
+			actual := evaluator.Eval(Optimize(parse(t, input), Options{Fold: true, Prune: true, Inline: true}), object.NewEnvironment())
+
+			eq(t, inspect(expected), inspect(actual))
+		})
+	}
+}
+
+func inspect(result object.Object) string {
+	if result == nil {
+		return "nil"
+	}
+	return result.Inspect()
+}
@@ -10,6 +10,7 @@ import (
 type ArrayLiteral struct {
 	Token    token.Token
 	Elements []Expression
+	RBracket token.Token // The ']' token
 }
 
 func (al *ArrayLiteral) expressionNode() {}
@@ -32,3 +33,11 @@ func (al *ArrayLiteral) String() string {
 
 	return out.String()
 }
+
+func (al *ArrayLiteral) Pos() token.Position {
+	return al.Token.Pos
+}
+
+func (al *ArrayLiteral) End() token.Position {
+	return al.RBracket.End
+}
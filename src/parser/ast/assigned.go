@@ -0,0 +1,83 @@
+package ast
+
+// AssignedNames - the names the statements of the body of a function assign,
+// in order and once each. The functions defined in the body assign their own
+// variables, they are left out.
+func AssignedNames(body *BlockStatement) []string {
+	names := []string{}
+	seen := map[string]bool{}
+
+	var walk func(node Node)
+	walkAll := func(nodes []Expression) {
+		for _, node := range nodes {
+			walk(node)
+		}
+	}
+
+	walk = func(node Node) {
+		switch node := node.(type) {
+		case *BlockStatement:
+			for _, statement := range node.Statements {
+				walk(statement)
+			}
+		case *ExpressionStatement:
+			walk(node.Expression)
+		case *LetStatement:
+			walk(node.Value)
+		case *Assignment:
+			walk(node.Value)
+			if !seen[node.Identifier.Value] {
+				seen[node.Identifier.Value] = true
+				names = append(names, node.Identifier.Value)
+			}
+		case *ReturnStatement:
+			walk(node.ReturnValue)
+		case *ThrowStatement:
+			walk(node.Value)
+		case *WhileStatement:
+			walk(node.Condition)
+			walk(node.Body)
+		case *ForStatement:
+			walk(node.Iterable)
+			walk(node.Body)
+
+		case *PrefixExpression:
+			walk(node.Right)
+		case *InfixExpression:
+			walk(node.Left)
+			walk(node.Right)
+		case *IndexExpression:
+			walk(node.Left)
+			walk(node.Index)
+		case *ArrayLiteral:
+			walkAll(node.Elements)
+		case *InterpolatedString:
+			walkAll(node.Parts)
+		case *HashLiteral:
+			for _, key := range node.SortedKeys() {
+				walk(key)
+				walk(node.Pairs[key])
+			}
+		case *IfExpression:
+			walk(node.Condition)
+			walk(node.Consequence)
+			if node.Alternative != nil {
+				walk(node.Alternative)
+			}
+		case *TryExpression:
+			walk(node.Block)
+			if node.Catch != nil {
+				walk(node.Catch)
+			}
+			if node.Finally != nil {
+				walk(node.Finally)
+			}
+		case *CallExpression:
+			walk(node.Function)
+			walkAll(node.Arguments)
+		}
+	}
+	walk(body)
+
+	return names
+}
@@ -27,3 +27,14 @@ func (a *Assignment) String() string {
 
 	return out.String()
 }
+
+func (a *Assignment) Pos() token.Position {
+	if a.Identifier != nil {
+		return a.Identifier.Pos()
+	}
+	return a.Token.Pos
+}
+
+func (a *Assignment) End() token.Position {
+	return endOf(a.Value, a.Token.End)
+}
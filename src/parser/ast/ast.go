@@ -1,6 +1,10 @@
 package ast
 
-import "bytes"
+import (
+	"bytes"
+
+	"sudocoding.xyz/interpreter_in_go/src/token"
+)
 
 /*
  Top Down Operator Precedence (Pratt Parser)
@@ -13,9 +17,13 @@ import "bytes"
 // Node - The AST is literally a tree with nodes. Each node is suppose to
 // implement the `TokenLiteral` method which is to return the literal of the
 // token. This will be used for debugging and testing purpose.
+// `Pos` and `End` report the span of source code the node was parsed from,
+// `End` being the position right after the last character of the node.
 type Node interface {
 	TokenLiteral() string
 	String() string
+	Pos() token.Position
+	End() token.Position
 }
 
 // Statement - The nodes in the AST that are statements are to implement this.
@@ -60,3 +68,28 @@ func (p *Program) String() string {
 	}
 	return out.String()
 }
+
+// Pos - Position of the first statement of the program
+func (p *Program) Pos() token.Position {
+	if len(p.Statements) > 0 {
+		return p.Statements[0].Pos()
+	}
+	return token.Position{}
+}
+
+// End - Position right after the last statement of the program
+func (p *Program) End() token.Position {
+	if len(p.Statements) > 0 {
+		return p.Statements[len(p.Statements)-1].End()
+	}
+	return token.Position{}
+}
+
+// endOf - returns the end of the node or the `fallback` position if the node
+// is missing
+func endOf(node Node, fallback token.Position) token.Position {
+	if node == nil {
+		return fallback
+	}
+	return node.End()
+}
@@ -0,0 +1,31 @@
+package ast
+
+import (
+	"math/big"
+
+	"sudocoding.xyz/interpreter_in_go/src/token"
+)
+
+// BigIntegerLiteral - integer literal too large for an int64
+type BigIntegerLiteral struct {
+	Token token.Token
+	Value *big.Int
+}
+
+func (bl *BigIntegerLiteral) expressionNode() {}
+
+func (bl *BigIntegerLiteral) TokenLiteral() string {
+	return bl.Token.Literal
+}
+
+func (bl *BigIntegerLiteral) String() string {
+	return bl.Token.Literal
+}
+
+func (bl *BigIntegerLiteral) Pos() token.Position {
+	return bl.Token.Pos
+}
+
+func (bl *BigIntegerLiteral) End() token.Position {
+	return bl.Token.End
+}
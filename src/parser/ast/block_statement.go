@@ -7,8 +7,9 @@ import (
 )
 
 type BlockStatement struct {
-	Token      token.Token
+	Token      token.Token // The '{' token
 	Statements []Statement
+	RBrace     token.Token // The '}' token
 }
 
 func (bs *BlockStatement) statementNode() {}
@@ -24,3 +25,11 @@ func (bs *BlockStatement) String() string {
 	}
 	return out.String()
 }
+
+func (bs *BlockStatement) Pos() token.Position {
+	return bs.Token.Pos
+}
+
+func (bs *BlockStatement) End() token.Position {
+	return bs.RBrace.End
+}
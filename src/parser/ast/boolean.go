@@ -16,3 +16,11 @@ func (b *Boolean) TokenLiteral() string {
 func (b *Boolean) String() string {
 	return b.Token.Literal
 }
+
+func (b *Boolean) Pos() token.Position {
+	return b.Token.Pos
+}
+
+func (b *Boolean) End() token.Position {
+	return b.Token.End
+}
@@ -11,6 +11,7 @@ type CallExpression struct {
 	Token     token.Token // The '(' token
 	Function  Expression  // Identifier or FunctionLiteral
 	Arguments []Expression
+	RParen    token.Token // The ')' token
 }
 
 func (ce *CallExpression) expressionNode() {}
@@ -34,3 +35,14 @@ func (ce *CallExpression) String() string {
 
 	return out.String()
 }
+
+func (ce *CallExpression) Pos() token.Position {
+	if ce.Function != nil {
+		return ce.Function.Pos()
+	}
+	return ce.Token.Pos
+}
+
+func (ce *CallExpression) End() token.Position {
+	return ce.RParen.End
+}
@@ -19,3 +19,11 @@ func (es *ExpressionStatement) String() string {
 	}
 	return es.Expression.String()
 }
+
+func (es *ExpressionStatement) Pos() token.Position {
+	return es.Token.Pos
+}
+
+func (es *ExpressionStatement) End() token.Position {
+	return endOf(es.Expression, es.Token.End)
+}
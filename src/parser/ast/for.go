@@ -0,0 +1,51 @@
+package ast
+
+import (
+	"bytes"
+
+	"sudocoding.xyz/interpreter_in_go/src/token"
+)
+
+// ForStatement - `for (<value> in <iterable>) { <body> }` or
+// `for (<key>, <value> in <iterable>) { <body> }`
+type ForStatement struct {
+	Token    token.Token
+	Key      *Identifier // Index or key of the element, nil if not asked for
+	Value    *Identifier
+	Iterable Expression
+	Body     *BlockStatement
+}
+
+func (fs *ForStatement) statementNode() {}
+
+func (fs *ForStatement) TokenLiteral() string {
+	return fs.Token.Literal
+}
+
+func (fs *ForStatement) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("for(")
+	if fs.Key != nil {
+		out.WriteString(fs.Key.String())
+		out.WriteString(", ")
+	}
+	out.WriteString(fs.Value.String())
+	out.WriteString(" in ")
+	out.WriteString(fs.Iterable.String())
+	out.WriteString(") ")
+	out.WriteString(fs.Body.String())
+
+	return out.String()
+}
+
+func (fs *ForStatement) Pos() token.Position {
+	return fs.Token.Pos
+}
+
+func (fs *ForStatement) End() token.Position {
+	if fs.Body != nil {
+		return fs.Body.End()
+	}
+	return endOf(fs.Iterable, fs.Token.End)
+}
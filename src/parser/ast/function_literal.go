@@ -11,6 +11,16 @@ type FunctionLiteral struct {
 	Token      token.Token
 	Parameters []*Identifier
 	Body       *BlockStatement
+	Name       string // Name of the variable the function is bound to by `let`, if any
+
+	// Names of the slots of the frames of the calls, parameters first, filled
+	// in by the resolver. Nil while the function isn't resolved.
+	Locals []string
+
+	// Slots of the variables the function assigns, parameters aside, see
+	// AssignedNames. Calls start them as the variables of the same name
+	// outside of the function, if any.
+	Assigned []int
 }
 
 func (fl *FunctionLiteral) expressionNode() {}
@@ -36,3 +46,14 @@ func (fl *FunctionLiteral) String() string {
 
 	return out.String()
 }
+
+func (fl *FunctionLiteral) Pos() token.Position {
+	return fl.Token.Pos
+}
+
+func (fl *FunctionLiteral) End() token.Position {
+	if fl.Body != nil {
+		return fl.Body.End()
+	}
+	return fl.Token.End
+}
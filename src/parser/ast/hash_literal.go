@@ -3,6 +3,7 @@ package ast
 import (
 	"bytes"
 	"fmt"
+	"sort"
 	"strings"
 
 	"sudocoding.xyz/interpreter_in_go/src/token"
@@ -10,8 +11,9 @@ import (
 
 // { <expression> : <expression>, ... }
 type HashLiteral struct {
-	Token token.Token
-	Pairs map[Expression]Expression
+	Token  token.Token
+	Pairs  map[Expression]Expression
+	RBrace token.Token // The '}' token
 }
 
 func (hl *HashLiteral) expressionNode() {}
@@ -24,8 +26,8 @@ func (hl *HashLiteral) String() string {
 	var out bytes.Buffer
 
 	list := []string{}
-	for key, value := range hl.Pairs {
-		list = append(list, fmt.Sprintf("%s : %s", key.String(), value.String()))
+	for _, key := range hl.SortedKeys() {
+		list = append(list, fmt.Sprintf("%s : %s", key.String(), hl.Pairs[key].String()))
 	}
 
 	out.WriteString("{")
@@ -34,3 +36,30 @@ func (hl *HashLiteral) String() string {
 
 	return out.String()
 }
+
+func (hl *HashLiteral) Pos() token.Position {
+	return hl.Token.Pos
+}
+
+func (hl *HashLiteral) End() token.Position {
+	return hl.RBrace.End
+}
+
+// SortedKeys - Returns the keys of the hash in the order they appear in the
+// source code. Keys without a position are ordered by their string form.
+func (hl *HashLiteral) SortedKeys() []Expression {
+	keys := make([]Expression, 0, len(hl.Pairs))
+	for key := range hl.Pairs {
+		keys = append(keys, key)
+	}
+
+	sort.SliceStable(keys, func(i, j int) bool {
+		iPos, jPos := keys[i].Pos(), keys[j].Pos()
+		if iPos.Offset != jPos.Offset {
+			return iPos.Offset < jPos.Offset
+		}
+		return keys[i].String() < keys[j].String()
+	})
+
+	return keys
+}
@@ -5,8 +5,24 @@ import "sudocoding.xyz/interpreter_in_go/src/token"
 type Identifier struct {
 	Token token.Token
 	Value string
+
+	// Where the variable lives, filled in by the resolver. Locals are in the
+	// slot `Slot` of the frame of the function `Depth` functions out, 0 being
+	// the function the identifier is in.
+	Scope Scope
+	Depth int
+	Slot  int
 }
 
+// Scope - kind of variable an identifier refers to
+type Scope int
+
+const (
+	UnresolvedScope Scope = iota // Not resolved, looked up by name
+	LocalScope                   // Variable of a function, in a slot of its frame
+	GlobalScope                  // Global, or builtin if there's no such global
+)
+
 func (i *Identifier) expressionNode() {}
 
 func (i *Identifier) TokenLiteral() string {
@@ -16,3 +32,11 @@ func (i *Identifier) TokenLiteral() string {
 func (i *Identifier) String() string {
 	return i.Value
 }
+
+func (i *Identifier) Pos() token.Position {
+	return i.Token.Pos
+}
+
+func (i *Identifier) End() token.Position {
+	return i.Token.End
+}
@@ -34,3 +34,17 @@ func (ie *IfExpression) String() string {
 
 	return out.String()
 }
+
+func (ie *IfExpression) Pos() token.Position {
+	return ie.Token.Pos
+}
+
+func (ie *IfExpression) End() token.Position {
+	if ie.Alternative != nil {
+		return ie.Alternative.End()
+	}
+	if ie.Consequence != nil {
+		return ie.Consequence.End()
+	}
+	return endOf(ie.Condition, ie.Token.End)
+}
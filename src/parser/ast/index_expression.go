@@ -8,9 +8,10 @@ import (
 
 // <expression>[<expression>]
 type IndexExpression struct {
-	Token token.Token
-	Left  Expression
-	Index Expression
+	Token    token.Token
+	Left     Expression
+	Index    Expression
+	RBracket token.Token // The ']' token
 }
 
 func (ie *IndexExpression) expressionNode() {}
@@ -31,3 +32,14 @@ func (ie *IndexExpression) String() string {
 
 	return out.String()
 }
+
+func (ie *IndexExpression) Pos() token.Position {
+	if ie.Left != nil {
+		return ie.Left.Pos()
+	}
+	return ie.Token.Pos
+}
+
+func (ie *IndexExpression) End() token.Position {
+	return ie.RBracket.End
+}
@@ -32,3 +32,14 @@ func (ie *InfixExpression) String() string {
 
 	return out.String()
 }
+
+func (ie *InfixExpression) Pos() token.Position {
+	if ie.Left != nil {
+		return ie.Left.Pos()
+	}
+	return ie.Token.Pos
+}
+
+func (ie *InfixExpression) End() token.Position {
+	return endOf(ie.Right, ie.Token.End)
+}
@@ -0,0 +1,47 @@
+package ast
+
+import (
+	"bytes"
+
+	"sudocoding.xyz/interpreter_in_go/src/token"
+)
+
+// InterpolatedString - a string with embedded expressions,
+// `"a ${x} b ${y} c"`. `Parts` alternate between the text, held as
+// *StringLiteral, and the embedded expressions; they start and end with text.
+type InterpolatedString struct {
+	Token token.Token // The STR_HEAD token
+	Parts []Expression
+}
+
+func (is *InterpolatedString) expressionNode() {}
+
+func (is *InterpolatedString) TokenLiteral() string {
+	return is.Token.Literal
+}
+
+func (is *InterpolatedString) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("\"")
+	for _, part := range is.Parts {
+		if text, ok := part.(*StringLiteral); ok {
+			out.WriteString(escape(text.Value))
+		} else {
+			out.WriteString("${")
+			out.WriteString(part.String())
+			out.WriteString("}")
+		}
+	}
+	out.WriteString("\"")
+
+	return out.String()
+}
+
+func (is *InterpolatedString) Pos() token.Position {
+	return is.Token.Pos
+}
+
+func (is *InterpolatedString) End() token.Position {
+	return is.Parts[len(is.Parts)-1].End()
+}
@@ -32,3 +32,14 @@ func (ls *LetStatement) String() string {
 	out.WriteString(";")
 	return out.String()
 }
+
+func (ls *LetStatement) Pos() token.Position {
+	return ls.Token.Pos
+}
+
+func (ls *LetStatement) End() token.Position {
+	if ls.Value != nil {
+		return ls.Value.End()
+	}
+	return endOf(ls.Name, ls.Token.End)
+}
@@ -35,3 +35,14 @@ func (ml *MacroLiteral) String() string {
 
 	return out.String()
 }
+
+func (ml *MacroLiteral) Pos() token.Position {
+	return ml.Token.Pos
+}
+
+func (ml *MacroLiteral) End() token.Position {
+	if ml.Body != nil {
+		return ml.Body.End()
+	}
+	return ml.Token.End
+}
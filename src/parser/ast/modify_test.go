@@ -83,6 +83,56 @@ func Test_Modify(t *testing.T) {
 			&ArrayLiteral{Elements: []Expression{one(), one()}},
 			&ArrayLiteral{Elements: []Expression{two(), two()}},
 		},
+		{
+			&InterpolatedString{Parts: []Expression{&StringLiteral{Value: "a"}, one(), &StringLiteral{Value: "b"}}},
+			&InterpolatedString{Parts: []Expression{&StringLiteral{Value: "a"}, two(), &StringLiteral{Value: "b"}}},
+		},
+		{
+			&WhileStatement{
+				Condition: one(),
+				Body:      &BlockStatement{Statements: []Statement{&ExpressionStatement{Expression: one()}}},
+			},
+			&WhileStatement{
+				Condition: two(),
+				Body:      &BlockStatement{Statements: []Statement{&ExpressionStatement{Expression: two()}}},
+			},
+		},
+		{
+			&ForStatement{
+				Iterable: one(),
+				Body:     &BlockStatement{Statements: []Statement{&ExpressionStatement{Expression: one()}}},
+			},
+			&ForStatement{
+				Iterable: two(),
+				Body:     &BlockStatement{Statements: []Statement{&ExpressionStatement{Expression: two()}}},
+			},
+		},
+		{
+			&ThrowStatement{Value: one()},
+			&ThrowStatement{Value: two()},
+		},
+		{
+			&TryExpression{
+				Block:   &BlockStatement{Statements: []Statement{&ExpressionStatement{Expression: one()}}},
+				Catch:   &BlockStatement{Statements: []Statement{&ExpressionStatement{Expression: one()}}},
+				Finally: &BlockStatement{Statements: []Statement{&ExpressionStatement{Expression: one()}}},
+			},
+			&TryExpression{
+				Block:   &BlockStatement{Statements: []Statement{&ExpressionStatement{Expression: two()}}},
+				Catch:   &BlockStatement{Statements: []Statement{&ExpressionStatement{Expression: two()}}},
+				Finally: &BlockStatement{Statements: []Statement{&ExpressionStatement{Expression: two()}}},
+			},
+		},
+		{
+			&IfExpression{
+				Condition:   one(),
+				Consequence: &BlockStatement{Statements: []Statement{&ExpressionStatement{Expression: one()}}},
+			},
+			&IfExpression{
+				Condition:   two(),
+				Consequence: &BlockStatement{Statements: []Statement{&ExpressionStatement{Expression: two()}}},
+			},
+		},
 	} {
 		t.Run(fmt.Sprintf("Test modify for %v", test.input), func(t *testing.T) {
 			modified := Modify(test.input, turnOneIntoTwo)
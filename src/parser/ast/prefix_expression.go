@@ -28,3 +28,11 @@ func (pe *PrefixExpression) String() string {
 
 	return out.String()
 }
+
+func (pe *PrefixExpression) Pos() token.Position {
+	return pe.Token.Pos
+}
+
+func (pe *PrefixExpression) End() token.Position {
+	return endOf(pe.Right, pe.Token.End)
+}
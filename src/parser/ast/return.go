@@ -29,3 +29,11 @@ func (r *ReturnStatement) String() string {
 
 	return out.String()
 }
+
+func (r *ReturnStatement) Pos() token.Position {
+	return r.Token.Pos
+}
+
+func (r *ReturnStatement) End() token.Position {
+	return endOf(r.ReturnValue, r.Token.End)
+}
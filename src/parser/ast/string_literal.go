@@ -2,6 +2,8 @@ package ast
 
 import (
 	"fmt"
+	"strings"
+	"unicode/utf8"
 
 	"sudocoding.xyz/interpreter_in_go/src/token"
 )
@@ -17,6 +19,55 @@ func (sl *StringLiteral) TokenLiteral() string {
 	return sl.Token.Literal
 }
 
+// String - renders the value as a `"` string literal that lexes back to the
+// same value, whichever form the literal was written in
 func (sl *StringLiteral) String() string {
-	return fmt.Sprintf("\"%s\"", sl.Token.Literal)
+	return quote(sl.Value)
+}
+
+func (sl *StringLiteral) Pos() token.Position {
+	return sl.Token.Pos
+}
+
+func (sl *StringLiteral) End() token.Position {
+	return sl.Token.End
+}
+
+// quote - wraps the string in `"`, escaping the characters that can't appear
+// in it as they are
+func quote(str string) string {
+	return "\"" + escape(str) + "\""
+}
+
+// escape - escapes the characters that can't appear as they are between `"`
+func escape(str string) string {
+	var out strings.Builder
+
+	for i := 0; i < len(str); {
+		ch, size := utf8.DecodeRuneInString(str[i:])
+
+		switch {
+		case ch == '"' || ch == '\\':
+			out.WriteByte('\\')
+			out.WriteRune(ch)
+		case ch == '$' && strings.HasPrefix(str[i+1:], "{"):
+			out.WriteString(`\$`)
+		case ch == '\n':
+			out.WriteString(`\n`)
+		case ch == '\t':
+			out.WriteString(`\t`)
+		case ch == '\r':
+			out.WriteString(`\r`)
+		case ch == 0:
+			out.WriteString(`\0`)
+		case ch == utf8.RuneError && size == 1, ch < ' ', ch == 0x7f:
+			fmt.Fprintf(&out, `\x%02x`, str[i])
+		default:
+			out.WriteRune(ch)
+		}
+
+		i += size
+	}
+
+	return out.String()
 }
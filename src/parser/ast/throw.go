@@ -0,0 +1,42 @@
+package ast
+
+import (
+	"bytes"
+
+	"sudocoding.xyz/interpreter_in_go/src/token"
+)
+
+// ThrowStatement - `throw <expression>`, raises the value as an error
+type ThrowStatement struct {
+	Token token.Token
+	Value Expression
+}
+
+func (ts *ThrowStatement) statementNode() {}
+
+func (ts *ThrowStatement) TokenLiteral() string {
+	return ts.Token.Literal
+}
+
+func (ts *ThrowStatement) String() string {
+	var out bytes.Buffer
+
+	out.WriteString(ts.TokenLiteral())
+	out.WriteString(" ")
+
+	if ts.Value != nil {
+		out.WriteString(ts.Value.String())
+	}
+
+	out.WriteString(";")
+
+	return out.String()
+}
+
+func (ts *ThrowStatement) Pos() token.Position {
+	return ts.Token.Pos
+}
+
+func (ts *ThrowStatement) End() token.Position {
+	return endOf(ts.Value, ts.Token.End)
+}
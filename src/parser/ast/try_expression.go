@@ -0,0 +1,61 @@
+package ast
+
+import (
+	"bytes"
+
+	"sudocoding.xyz/interpreter_in_go/src/token"
+)
+
+// TryExpression - `try { } catch (e) { } finally { }`. Either the catch or the
+// finally block can be left out, not both.
+type TryExpression struct {
+	Token   token.Token
+	Block   *BlockStatement
+	Param   *Identifier // Variable the caught error is bound to
+	Catch   *BlockStatement
+	Finally *BlockStatement
+}
+
+func (te *TryExpression) expressionNode() {}
+
+func (te *TryExpression) TokenLiteral() string {
+	return te.Token.Literal
+}
+
+func (te *TryExpression) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("try")
+	out.WriteString(te.Block.String())
+
+	if te.Catch != nil {
+		out.WriteString("catch(")
+		out.WriteString(te.Param.String())
+		out.WriteString(")")
+		out.WriteString(te.Catch.String())
+	}
+
+	if te.Finally != nil {
+		out.WriteString("finally")
+		out.WriteString(te.Finally.String())
+	}
+
+	return out.String()
+}
+
+func (te *TryExpression) Pos() token.Position {
+	return te.Token.Pos
+}
+
+func (te *TryExpression) End() token.Position {
+	if te.Finally != nil {
+		return te.Finally.End()
+	}
+	if te.Catch != nil {
+		return te.Catch.End()
+	}
+	if te.Block != nil {
+		return te.Block.End()
+	}
+	return te.Token.End
+}
@@ -0,0 +1,108 @@
+package parser
+
+import (
+	"fmt"
+	"strings"
+
+	"sudocoding.xyz/interpreter_in_go/src/diagnostic"
+	"sudocoding.xyz/interpreter_in_go/src/token"
+)
+
+// Diagnostic codes reported by the parser
+const (
+	ErrUnexpectedToken  diagnostic.Code = "P0001" // a specific token was expected
+	ErrExpectedExpr     diagnostic.Code = "P0002" // no expression starts with the token
+	ErrInvalidInteger   diagnostic.Code = "P0003" // integer literal can't be represented
+	ErrMissingAssignVal diagnostic.Code = "P0004" // nothing on the right of `=`
+	ErrUnexpectedEOF    diagnostic.Code = "P0005" // input ended in the middle of a construct
+	ErrIllegalToken     diagnostic.Code = "P0006" // token the lexer couldn't make sense of
+	ErrOutsideLoop      diagnostic.Code = "P0007" // `break` or `continue` outside of a loop
+	ErrInvalidFloat     diagnostic.Code = "P0008" // float literal can't be represented
+)
+
+// errorAt - records an error diagnostic spanning the given token and puts the
+// parser in recovery mode. Errors are dropped while recovering, they would
+// only be the echo of the first one. Errors on tokens the lexer already
+// complained about are dropped too.
+func (p *Parser) errorAt(tok token.Token, code diagnostic.Code, format string, a ...interface{}) *diagnostic.Diagnostic {
+	diag := &diagnostic.Diagnostic{
+		Severity: diagnostic.Error,
+		Code:     code,
+		Message:  fmt.Sprintf(format, a...),
+		Pos:      tok.Pos,
+		End:      tok.End,
+		Actual:   tok,
+	}
+
+	if !p.recovering && !p.reportedByLexer(tok) {
+		p.diags = append(p.diags, diag)
+	}
+
+	p.recovering = true
+	return diag
+}
+
+// reportedByLexer - returns true if the lexer reported an error for the token
+func (p *Parser) reportedByLexer(tok token.Token) bool {
+	if tok.Type != token.ILLEGAL {
+		return false
+	}
+
+	for _, diag := range p.l.Errors() {
+		if diag.Pos == tok.Pos {
+			return true
+		}
+	}
+	return false
+}
+
+// expectedError - records that one of the `expected` token types should have
+// come instead of `actual`
+func (p *Parser) expectedError(actual token.Token, expected ...token.TokenType) {
+	names := []string{}
+	for _, tt := range expected {
+		names = append(names, describeType(tt))
+	}
+
+	diag := p.errorAt(actual, ErrUnexpectedToken, "expected %s, found %s",
+		strings.Join(names, " or "), describeToken(actual))
+	diag.Expected = expected
+}
+
+// describeType - human friendly name of a token type, to be used in messages
+func describeType(tt token.TokenType) string {
+	switch tt {
+	case token.IDENT:
+		return "identifier"
+	case token.INT:
+		return "integer"
+	case token.FLOAT:
+		return "float"
+	case token.STR, token.STR_HEAD:
+		return "string"
+	case token.STR_MID, token.STR_TAIL:
+		return "'}'"
+	case token.EOF:
+		return "end of file"
+	case token.ILLEGAL:
+		return "illegal token"
+	}
+
+	return fmt.Sprintf("'%s'", strings.ToLower(string(tt)))
+}
+
+// describeToken - human friendly description of a token, to be used in messages
+func describeToken(tok token.Token) string {
+	switch tok.Type {
+	case token.EOF, token.ILLEGAL:
+		return describeType(tok.Type)
+	case token.IDENT:
+		return fmt.Sprintf("identifier '%s'", tok.Literal)
+	case token.STR, token.STR_HEAD:
+		return fmt.Sprintf("string %q", tok.Literal)
+	case token.STR_MID, token.STR_TAIL:
+		return describeType(tok.Type)
+	}
+
+	return fmt.Sprintf("'%s'", tok.Literal)
+}
@@ -2,9 +2,10 @@ package parser
 
 import (
 	"errors"
-	"fmt"
+	"math/big"
 	"strconv"
 
+	"sudocoding.xyz/interpreter_in_go/src/diagnostic"
 	"sudocoding.xyz/interpreter_in_go/src/lexer"
 	"sudocoding.xyz/interpreter_in_go/src/parser/ast"
 	"sudocoding.xyz/interpreter_in_go/src/token"
@@ -16,29 +17,46 @@ type OpPrec int
 const (
 	_ OpPrec = iota
 	LOWEST
+	LOGICAL_OR  // ||
+	LOGICAL_AND // &&
 	EQUALS      // ==
 	LESSGREATER // > or <
+	BIT_OR      // |
+	BIT_XOR     // ^
+	BIT_AND     // &
+	SHIFT       // << or >>
 	SUM         // +
-	PRODUCT     // *
+	PRODUCT     // *, % or ~/
 	DIVIDE      // /
-	PREFIX      // -X or !x
+	PREFIX      // -X, !x or ~x
+	POWER       // **
 	CALL        // function call
 	INDEX       // array[index]
 )
 
 var precedences = map[token.TokenType]OpPrec{
-	token.EQ:       EQUALS,
-	token.NOT_EQ:   EQUALS,
-	token.LT:       LESSGREATER,
-	token.GT:       LESSGREATER,
-	token.LTE:      LESSGREATER,
-	token.GTE:      LESSGREATER,
-	token.PLUS:     SUM,
-	token.MINUS:    SUM,
-	token.ASTERISK: PRODUCT,
-	token.SLASH:    DIVIDE,
-	token.LPAREN:   CALL,
-	token.LBRACKET: INDEX,
+	token.OR:        LOGICAL_OR,
+	token.AND:       LOGICAL_AND,
+	token.EQ:        EQUALS,
+	token.NOT_EQ:    EQUALS,
+	token.LT:        LESSGREATER,
+	token.GT:        LESSGREATER,
+	token.LTE:       LESSGREATER,
+	token.GTE:       LESSGREATER,
+	token.BIT_OR:    BIT_OR,
+	token.BIT_XOR:   BIT_XOR,
+	token.BIT_AND:   BIT_AND,
+	token.SHL:       SHIFT,
+	token.SHR:       SHIFT,
+	token.PLUS:      SUM,
+	token.MINUS:     SUM,
+	token.ASTERISK:  PRODUCT,
+	token.SLASH:     DIVIDE,
+	token.PERCENT:   PRODUCT,
+	token.FLOOR_DIV: PRODUCT,
+	token.POWER:     POWER,
+	token.LPAREN:    CALL,
+	token.LBRACKET:  INDEX,
 }
 
 type (
@@ -53,17 +71,22 @@ type (
 
 // Parser - The parser of Monkie lang
 type Parser struct {
-	l             *lexer.Lexer_V2
+	l             lexer.TokenSource
 	curToken      token.Token                        // Points to the currently pointing token
 	peekToken     token.Token                        // Points to the next token
-	errs          []error                            // List of errors that occured while parsing
+	diags         []*diagnostic.Diagnostic           // List of errors that occured while parsing
+	recovering    bool                               // Set after an error till the parser synchronizes
+	consumed      int                                // Number of tokens consumed so far
+	braces        int                                // Number of '{' consumed and not closed yet
+	blocks        []int                              // `braces` at the start of every block being parsed
+	loops         int                                // Number of loops around the current token in the current function
 	prefixParsers map[token.TokenType]prefixParserFn // map of prefix token parsers
 	infixParsers  map[token.TokenType]infixParserFn  // map of infin token parsers
 }
 
-// New - Create a new parser with the lexer v2 and sets the curToken and the
+// New - Create a new parser reading from the token source and sets the curToken and the
 // peekToken to the start of the program
-func New(l *lexer.Lexer_V2) *Parser {
+func New(l lexer.TokenSource) *Parser {
 	p := &Parser{
 		l:             l,
 		prefixParsers: make(map[token.TokenType]prefixParserFn),
@@ -72,28 +95,43 @@ func New(l *lexer.Lexer_V2) *Parser {
 
 	p.registerPrefixParser(token.IDENT, p.parseIdentifier)
 	p.registerPrefixParser(token.INT, p.parseIntegerLiteral)
+	p.registerPrefixParser(token.FLOAT, p.parseFloatLiteral)
 	p.registerPrefixParser(token.STR, p.parseStringLiteral)
+	p.registerPrefixParser(token.STR_HEAD, p.parseInterpolatedString)
 	p.registerPrefixParser(token.BANG, p.parsePrefixExpression)
 	p.registerPrefixParser(token.MINUS, p.parsePrefixExpression)
+	p.registerPrefixParser(token.BIT_NOT, p.parsePrefixExpression)
 	p.registerPrefixParser(token.TRUE, p.parseBoolean)
 	p.registerPrefixParser(token.FALSE, p.parseBoolean)
 	p.registerPrefixParser(token.LPAREN, p.parseGroupedExpression)
 	p.registerPrefixParser(token.IF, p.parseIfExpression)
+	p.registerPrefixParser(token.TRY, p.parseTryExpression)
 	p.registerPrefixParser(token.FUNCTION, p.parseFunctionLiteral)
 	p.registerPrefixParser(token.MACRO, p.parseMacroLiteral)
 	p.registerPrefixParser(token.LBRACKET, p.parseArrayLiteral)
 	p.registerPrefixParser(token.LBRACE, p.parseHashLiteral)
+	p.registerPrefixParser(token.ILLEGAL, p.parseIllegal)
 
 	p.registerInfixParser(token.PLUS, p.parseInfixExpression)
 	p.registerInfixParser(token.MINUS, p.parseInfixExpression)
 	p.registerInfixParser(token.SLASH, p.parseInfixExpression)
 	p.registerInfixParser(token.ASTERISK, p.parseInfixExpression)
+	p.registerInfixParser(token.PERCENT, p.parseInfixExpression)
+	p.registerInfixParser(token.FLOOR_DIV, p.parseInfixExpression)
+	p.registerInfixParser(token.POWER, p.parseInfixExpression)
 	p.registerInfixParser(token.EQ, p.parseInfixExpression)
+	p.registerInfixParser(token.AND, p.parseInfixExpression)
+	p.registerInfixParser(token.OR, p.parseInfixExpression)
 	p.registerInfixParser(token.NOT_EQ, p.parseInfixExpression)
 	p.registerInfixParser(token.LT, p.parseInfixExpression)
 	p.registerInfixParser(token.LTE, p.parseInfixExpression)
 	p.registerInfixParser(token.GT, p.parseInfixExpression)
 	p.registerInfixParser(token.GTE, p.parseInfixExpression)
+	p.registerInfixParser(token.BIT_AND, p.parseInfixExpression)
+	p.registerInfixParser(token.BIT_OR, p.parseInfixExpression)
+	p.registerInfixParser(token.BIT_XOR, p.parseInfixExpression)
+	p.registerInfixParser(token.SHL, p.parseInfixExpression)
+	p.registerInfixParser(token.SHR, p.parseInfixExpression)
 	p.registerInfixParser(token.LPAREN, p.parseCallExpression)
 	p.registerInfixParser(token.LBRACKET, p.parseIndexExpression)
 
@@ -109,19 +147,37 @@ func (p *Parser) ParseProgram() *ast.Program {
 	program.Statements = []ast.Statement{}
 
 	for !p.curTokenIs(token.EOF) {
-		if stmt := p.parseStatement(); stmt != nil {
-			program.Statements = append(program.Statements, stmt)
+		start := p.consumed
+		stmt := p.parseStatement()
+
+		if stmt == nil || p.recovering {
+			p.synchronize(start)
+			continue
 		}
 
+		program.Statements = append(program.Statements, stmt)
 		p.nextToken()
 	}
 
 	return program
 }
 
-// Errors - Returns the list of errors that was found by the parser
-func (p *Parser) Errors() []error {
-	return p.errs
+// Errors - Returns the list of errors that was found by the lexer and the
+// parser, ordered by their position in the source and rendered with a snippet
+// of the source they point to
+func (p *Parser) Errors() []*diagnostic.Diagnostic {
+	diags := append([]*diagnostic.Diagnostic{}, p.l.Errors()...)
+	diags = append(diags, p.diags...)
+	diagnostic.Sort(diags)
+
+	src := p.l.Source()
+	for _, diag := range diags {
+		if diag.Snippet == "" {
+			diag.Snippet = diagnostic.Snippet(src, diag.Pos, diag.End)
+		}
+	}
+
+	return diags
 }
 
 // registerPrefixParser - registers prefix token parsers
@@ -135,30 +191,33 @@ func (p *Parser) registerInfixParser(tokenType token.TokenType, fn infixParserFn
 }
 
 // nextToken - updates the curToken and peekToken to their next respective values
-func (p *Parser) nextToken() error {
+func (p *Parser) nextToken() {
 	if p.curTokenIs(token.EOF) {
-		err := errors.New("Attempted to read next token at end of file")
-		p.errs = append(p.errs, err)
-		return err
+		p.errorAt(p.curToken, ErrUnexpectedEOF, "unexpected end of file")
+		return
 	}
 
 	p.curToken = p.peekToken
-	p.peekToken = p.l.NextToken_V2()
-	return nil
+	p.peekToken = p.l.NextToken()
+	p.consumed += 1
+
+	switch p.curToken.Type {
+	case token.LBRACE:
+		p.braces += 1
+	case token.RBRACE:
+		p.braces -= 1
+	}
 }
 
 // expectNextToken - tries to move to the next token if matches the expected
-// token. otherwise returns an error
-func (p *Parser) expectNextToken(expectedType token.TokenType) error {
+// token. otherwise records an error and returns false
+func (p *Parser) expectNextToken(expectedType token.TokenType) bool {
 	if !p.peekTokenIs(expectedType) {
-		err := errors.New(
-			fmt.Sprintf("Next token expected %+v. Got %+v.", expectedType, p.peekToken.Type),
-		)
-		p.errs = append(p.errs, err)
-		return err
+		p.expectedError(p.peekToken, expectedType)
+		return false
 	}
 	p.nextToken()
-	return nil
+	return true
 }
 
 // curTokenIs - Returns true if the curTokken in the parser matches the expected
@@ -187,6 +246,23 @@ func (p *Parser) parseStatement() ast.Statement {
 			return returnStmt
 		}
 		return nil
+	case token.THROW:
+		if throwStmt := p.parseThrowStatement(); throwStmt != nil {
+			return throwStmt
+		}
+		return nil
+	case token.WHILE:
+		if whileStmt := p.parseWhileStatement(); whileStmt != nil {
+			return whileStmt
+		}
+		return nil
+	case token.FOR:
+		if forStmt := p.parseForStatement(); forStmt != nil {
+			return forStmt
+		}
+		return nil
+	case token.BREAK, token.CONTINUE:
+		return p.parseLoopControlStatement()
 	case token.IDENT:
 		if !p.peekTokenIs(token.ASSIGN) {
 			if expStmt := p.parseExpressionStatement(); expStmt != nil {
@@ -210,20 +286,26 @@ func (p *Parser) parseStatement() ast.Statement {
 // parseLetStatement - parses a let statement
 func (p *Parser) parseLetStatement() *ast.LetStatement {
 	stmt := &ast.LetStatement{Token: p.curToken}
-	if err := p.expectNextToken(token.IDENT); err != nil {
-		fmt.Printf("Error while parsing let statement: %s\n", err.Error())
+	if !p.expectNextToken(token.IDENT) {
 		return nil
 	}
 
 	stmt.Name = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
-	if err := p.expectNextToken(token.ASSIGN); err != nil {
-		fmt.Printf("Error while parsing let statement: %s\n", err.Error())
+	if !p.expectNextToken(token.ASSIGN) {
 		return nil
 	}
 
 	p.nextToken()
 
 	stmt.Value = p.parseExpression(LOWEST)
+	if stmt.Value == nil {
+		return nil
+	}
+
+	// Name the function so it can be told apart in stack traces
+	if fn, ok := stmt.Value.(*ast.FunctionLiteral); ok {
+		fn.Name = stmt.Name.Value
+	}
 
 	if p.peekTokenIs(token.SEMICOLON) {
 		p.nextToken()
@@ -238,6 +320,138 @@ func (p *Parser) parseReturnStatement() *ast.ReturnStatement {
 	p.nextToken()
 
 	stmt.ReturnValue = p.parseExpression(LOWEST)
+	if stmt.ReturnValue == nil {
+		return nil
+	}
+
+	// Remove optional semicolon
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+
+	return stmt
+}
+
+// parseThrowStatement - parse a throw statement
+func (p *Parser) parseThrowStatement() *ast.ThrowStatement {
+	stmt := &ast.ThrowStatement{Token: p.curToken}
+	p.nextToken()
+
+	stmt.Value = p.parseExpression(LOWEST)
+	if stmt.Value == nil {
+		return nil
+	}
+
+	// Remove optional semicolon
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+
+	return stmt
+}
+
+// parseWhileStatement - parse `while (<condition>) { <body> }`
+func (p *Parser) parseWhileStatement() *ast.WhileStatement {
+	stmt := &ast.WhileStatement{Token: p.curToken}
+
+	if !p.expectNextToken(token.LPAREN) {
+		return nil
+	}
+
+	p.nextToken()
+	stmt.Condition = p.parseExpression(LOWEST)
+
+	if stmt.Condition == nil || !p.expectNextToken(token.RPAREN) {
+		return nil
+	}
+
+	if !p.expectNextToken(token.LBRACE) {
+		return nil
+	}
+
+	stmt.Body = p.parseLoopBody()
+	if stmt.Body == nil {
+		return nil
+	}
+
+	// Remove optional semicolon
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+
+	return stmt
+}
+
+// parseForStatement - parse `for (<value> in <iterable>) { <body> }` and
+// `for (<key>, <value> in <iterable>) { <body> }`
+func (p *Parser) parseForStatement() *ast.ForStatement {
+	stmt := &ast.ForStatement{Token: p.curToken}
+
+	if !p.expectNextToken(token.LPAREN) || !p.expectNextToken(token.IDENT) {
+		return nil
+	}
+	stmt.Value = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+
+	if p.peekTokenIs(token.COMMA) {
+		p.nextToken()
+		if !p.expectNextToken(token.IDENT) {
+			return nil
+		}
+
+		stmt.Key = stmt.Value
+		stmt.Value = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+	}
+
+	if !p.expectNextToken(token.IN) {
+		return nil
+	}
+
+	p.nextToken()
+	stmt.Iterable = p.parseExpression(LOWEST)
+
+	if stmt.Iterable == nil || !p.expectNextToken(token.RPAREN) {
+		return nil
+	}
+
+	if !p.expectNextToken(token.LBRACE) {
+		return nil
+	}
+
+	stmt.Body = p.parseLoopBody()
+	if stmt.Body == nil {
+		return nil
+	}
+
+	// Remove optional semicolon
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+
+	return stmt
+}
+
+// parseLoopBody - parses the block of a loop, in which `break` and `continue`
+// are allowed
+func (p *Parser) parseLoopBody() *ast.BlockStatement {
+	p.loops += 1
+	defer func() { p.loops -= 1 }()
+
+	return p.parseBlockStatement()
+}
+
+// parseLoopControlStatement - parse `break` and `continue`
+func (p *Parser) parseLoopControlStatement() ast.Statement {
+	var stmt ast.Statement
+	if p.curTokenIs(token.BREAK) {
+		stmt = &ast.BreakStatement{Token: p.curToken}
+	} else {
+		stmt = &ast.ContinueStatement{Token: p.curToken}
+	}
+
+	if p.loops == 0 {
+		p.errorAt(p.curToken, ErrOutsideLoop, "'%s' outside of a loop", p.curToken.Literal)
+		return nil
+	}
 
 	// Remove optional semicolon
 	if p.peekTokenIs(token.SEMICOLON) {
@@ -251,22 +465,22 @@ func (p *Parser) parseReturnStatement() *ast.ReturnStatement {
 func (p *Parser) parseAssignmentStatement() *ast.Assignment {
 	stmt := &ast.Assignment{Token: p.peekToken, Identifier: p.parseIdentifier().(*ast.Identifier)}
 
-	if err := p.expectNextToken(token.ASSIGN); err != nil {
-		fmt.Println("Expected = in assigment operation: ", err.Error())
+	if !p.expectNextToken(token.ASSIGN) {
 		return nil
 	}
 
+	assign := p.curToken
 	p.nextToken()
-	val := p.parseExpression(LOWEST)
-	if val == nil {
-		err := errors.New("Got empty expression on RHS of assignment")
-		fmt.Println(err.Error())
-		p.errs = append(p.errs, err)
 
-		if p.peekTokenIs(token.SEMICOLON) {
-			p.nextToken()
-		}
+	// Nothing that could be an expression, the more precise error than the
+	// one parseExpression would report
+	if _, ok := p.prefixParsers[p.curToken.Type]; !ok {
+		p.errorAt(assign, ErrMissingAssignVal, "expected an expression on the right of '='")
+		return nil
+	}
 
+	val := p.parseExpression(LOWEST)
+	if val == nil {
 		return nil
 	}
 
@@ -299,6 +513,9 @@ func (p *Parser) curPrecedence() OpPrec {
 func (p *Parser) parseExpressionStatement() *ast.ExpressionStatement {
 	stmt := &ast.ExpressionStatement{Token: p.curToken}
 	stmt.Expression = p.parseExpression(LOWEST)
+	if stmt.Expression == nil {
+		return nil
+	}
 
 	// This is to check if the next token is ; since ; will be optional for
 	// expression statements
@@ -313,17 +530,13 @@ func (p *Parser) parseExpression(opPrec OpPrec) ast.Expression {
 	prefix := p.prefixParsers[p.curToken.Type]
 
 	if prefix == nil {
-		err := errors.New(
-			fmt.Sprintf("No prefix parser function for %s found", string(p.curToken.Type)),
-		)
-		fmt.Println(err.Error())
-		p.errs = append(p.errs, err)
+		p.errorAt(p.curToken, ErrExpectedExpr, "expected an expression, found %s", describeToken(p.curToken))
 		return nil
 	}
 
 	leftExp := prefix()
 
-	for !p.peekTokenIs(token.SEMICOLON) && opPrec < p.peekPrecedence() {
+	for leftExp != nil && !p.peekTokenIs(token.SEMICOLON) && opPrec < p.peekPrecedence() {
 		infix := p.infixParsers[p.peekToken.Type]
 		if infix == nil {
 			return leftExp
@@ -344,23 +557,71 @@ func (p *Parser) parseIdentifier() ast.Expression {
 // parseIntegerLiteral - parse an integer literal expression
 func (p *Parser) parseIntegerLiteral() ast.Expression {
 	intVal, err := strconv.ParseInt(p.curToken.Literal, 0, 64)
-	if err != nil {
-		pErr := errors.New(fmt.Sprintf("Error occured while parsing int literal %q with error %q", p.curToken.Literal, err.Error()))
 
-		fmt.Println(pErr.Error())
+	// Literals too large for int64 become big integers
+	if errors.Is(err, strconv.ErrRange) {
+		if bigVal, ok := new(big.Int).SetString(p.curToken.Literal, 0); ok {
+			return &ast.BigIntegerLiteral{Token: p.curToken, Value: bigVal}
+		}
+	}
 
-		p.errs = append(p.errs, pErr)
+	if err != nil {
+		p.errorAt(p.curToken, ErrInvalidInteger, "invalid integer literal %s: %s", p.curToken.Literal, err.(*strconv.NumError).Err)
 		return nil
 	}
 
 	return &ast.IntegerLiteral{Token: p.curToken, Value: intVal}
 }
 
+// parseFloatLiteral - parse floats
+func (p *Parser) parseFloatLiteral() ast.Expression {
+	floatVal, err := strconv.ParseFloat(p.curToken.Literal, 64)
+	if err != nil {
+		p.errorAt(p.curToken, ErrInvalidFloat, "invalid float literal %s: %s", p.curToken.Literal, err.(*strconv.NumError).Err)
+		return nil
+	}
+
+	return &ast.FloatLiteral{Token: p.curToken, Value: floatVal}
+}
+
+// parseIllegal - reports an illegal token. Illegal tokens read by the lexer
+// are already reported by the lexer itself.
+func (p *Parser) parseIllegal() ast.Expression {
+	p.errorAt(p.curToken, ErrIllegalToken, "illegal token %s", p.curToken.Literal)
+	return nil
+}
+
 // parseStringLiteral - parse strings
 func (p *Parser) parseStringLiteral() ast.Expression {
 	return &ast.StringLiteral{Token: p.curToken, Value: p.curToken.Literal}
 }
 
+// parseInterpolatedString - parse strings with embedded expressions. The text
+// around the expressions comes as STR_HEAD, STR_MID and STR_TAIL tokens.
+func (p *Parser) parseInterpolatedString() ast.Expression {
+	str := &ast.InterpolatedString{Token: p.curToken}
+	str.Parts = append(str.Parts, p.parseStringLiteral())
+
+	for !p.curTokenIs(token.STR_TAIL) {
+		p.nextToken()
+
+		expr := p.parseExpression(LOWEST)
+		if expr == nil {
+			return nil
+		}
+
+		if !p.peekTokenIs(token.STR_MID) && !p.peekTokenIs(token.STR_TAIL) {
+			p.expectedError(p.peekToken, token.STR_TAIL)
+			return nil
+		}
+		p.nextToken()
+
+		str.Parts = append(str.Parts, expr, p.parseStringLiteral())
+	}
+
+	return str
+}
+
 // parsePrefixExpression - parse a prefix expression
 func (p *Parser) parsePrefixExpression() ast.Expression {
 	expression := &ast.PrefixExpression{
@@ -368,12 +629,13 @@ func (p *Parser) parsePrefixExpression() ast.Expression {
 		Operator: p.curToken.Literal,
 	}
 
-	if err := p.nextToken(); err != nil {
-		fmt.Println("Error occured while parsing next token of prefix expression: ", err.Error())
+	p.nextToken()
+
+	expression.Right = p.parseExpression(PREFIX)
+	if expression.Right == nil {
 		return nil
 	}
 
-	expression.Right = p.parseExpression(PREFIX)
 	return expression
 }
 
@@ -386,8 +648,17 @@ func (p *Parser) parseInfixExpression(leftExp ast.Expression) ast.Expression {
 	}
 
 	precedence := p.curPrecedence()
+
+	// `**` is right associative: 2 ** 3 ** 2 is 2 ** (3 ** 2)
+	if p.curTokenIs(token.POWER) {
+		precedence -= 1
+	}
+
 	p.nextToken()
 	expression.Right = p.parseExpression(precedence)
+	if expression.Right == nil {
+		return nil
+	}
 
 	return expression
 }
@@ -405,8 +676,7 @@ func (p *Parser) parseBoolean() ast.Expression {
 func (p *Parser) parseGroupedExpression() ast.Expression {
 	p.nextToken()
 	exp := p.parseExpression(LOWEST)
-	if err := p.expectNextToken(token.RPAREN); err != nil {
-		fmt.Println("Error occured while parsing grouped expression: ", err.Error())
+	if exp == nil || !p.expectNextToken(token.RPAREN) {
 		return nil
 	}
 	return exp
@@ -416,35 +686,89 @@ func (p *Parser) parseGroupedExpression() ast.Expression {
 func (p *Parser) parseIfExpression() ast.Expression {
 	exp := &ast.IfExpression{Token: p.curToken}
 
-	if err := p.expectNextToken(token.LPAREN); err != nil {
-		fmt.Println("Expected missing ( in if condition: ", err.Error())
+	if !p.expectNextToken(token.LPAREN) {
 		return nil
 	}
 
 	p.nextToken()
 	exp.Condition = p.parseExpression(LOWEST)
 
-	if err := p.expectNextToken(token.RPAREN); err != nil {
-		fmt.Println("Expected missing ) in if condition: ", err.Error())
+	if exp.Condition == nil || !p.expectNextToken(token.RPAREN) {
 		return nil
 	}
 
-	if err := p.expectNextToken(token.LBRACE); err != nil {
-		fmt.Println("Expected missing { in if body: ", err.Error())
+	if !p.expectNextToken(token.LBRACE) {
 		return nil
 	}
 
 	exp.Consequence = p.parseBlockStatement()
+	if exp.Consequence == nil {
+		return nil
+	}
 
 	if p.peekTokenIs(token.ELSE) {
 		p.nextToken()
 
-		if err := p.expectNextToken(token.LBRACE); err != nil {
-			fmt.Println("Expected missing { in else body: ", err.Error())
+		if !p.expectNextToken(token.LBRACE) {
 			return nil
 		}
 
 		exp.Alternative = p.parseBlockStatement()
+		if exp.Alternative == nil {
+			return nil
+		}
+	}
+
+	return exp
+}
+
+// parseTryExpression - parses `try { } catch (e) { } finally { }`
+func (p *Parser) parseTryExpression() ast.Expression {
+	exp := &ast.TryExpression{Token: p.curToken}
+
+	if !p.expectNextToken(token.LBRACE) {
+		return nil
+	}
+
+	exp.Block = p.parseBlockStatement()
+	if exp.Block == nil {
+		return nil
+	}
+
+	if p.peekTokenIs(token.CATCH) {
+		p.nextToken()
+
+		if !p.expectNextToken(token.LPAREN) || !p.expectNextToken(token.IDENT) {
+			return nil
+		}
+		exp.Param = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+
+		if !p.expectNextToken(token.RPAREN) || !p.expectNextToken(token.LBRACE) {
+			return nil
+		}
+
+		exp.Catch = p.parseBlockStatement()
+		if exp.Catch == nil {
+			return nil
+		}
+	}
+
+	if exp.Catch == nil && !p.peekTokenIs(token.FINALLY) {
+		p.expectedError(p.peekToken, token.CATCH, token.FINALLY)
+		return nil
+	}
+
+	if p.peekTokenIs(token.FINALLY) {
+		p.nextToken()
+
+		if !p.expectNextToken(token.LBRACE) {
+			return nil
+		}
+
+		exp.Finally = p.parseBlockStatement()
+		if exp.Finally == nil {
+			return nil
+		}
 	}
 
 	return exp
@@ -455,15 +779,30 @@ func (p *Parser) parseBlockStatement() *ast.BlockStatement {
 	block := &ast.BlockStatement{Token: p.curToken}
 	block.Statements = []ast.Statement{}
 
+	p.blocks = append(p.blocks, p.braces)
+	defer func() { p.blocks = p.blocks[:len(p.blocks)-1] }()
+
 	p.nextToken()
 
 	for !p.curTokenIs(token.RBRACE) && !p.curTokenIs(token.EOF) {
-		if stmt := p.parseStatement(); stmt != nil {
-			block.Statements = append(block.Statements, stmt)
+		start := p.consumed
+		stmt := p.parseStatement()
+
+		if stmt == nil || p.recovering {
+			p.synchronize(start)
+			continue
 		}
+
+		block.Statements = append(block.Statements, stmt)
 		p.nextToken()
 	}
 
+	if !p.curTokenIs(token.RBRACE) {
+		p.expectedError(p.curToken, token.RBRACE)
+		return nil
+	}
+
+	block.RBrace = p.curToken
 	return block
 }
 
@@ -471,38 +810,52 @@ func (p *Parser) parseBlockStatement() *ast.BlockStatement {
 func (p *Parser) parseFunctionLiteral() ast.Expression {
 	lit := &ast.FunctionLiteral{Token: p.curToken}
 
-	if err := p.expectNextToken(token.LPAREN); err != nil {
-		fmt.Println("Expected ( for function params is missing: ", err.Error())
+	if !p.expectNextToken(token.LPAREN) {
 		return nil
 	}
 
 	lit.Parameters = p.parseFunctionParameters()
 
-	if err := p.expectNextToken(token.LBRACE); err != nil {
-		fmt.Println("Expected { for function body is missing: ", err.Error())
+	if lit.Parameters == nil || !p.expectNextToken(token.LBRACE) {
 		return nil
 	}
 
+	// Loops around the literal can't be controlled from its body
+	loops := p.loops
+	p.loops = 0
 	lit.Body = p.parseBlockStatement()
+	p.loops = loops
+
+	if lit.Body == nil {
+		return nil
+	}
+
 	return lit
 }
 
 func (p *Parser) parseMacroLiteral() ast.Expression {
 	lit := &ast.MacroLiteral{Token: p.curToken}
 
-	if err := p.expectNextToken(token.LPAREN); err != nil {
-		fmt.Println("Expected ( for macro params is missing: ", err.Error())
+	if !p.expectNextToken(token.LPAREN) {
 		return nil
 	}
 
 	lit.Parameters = p.parseFunctionParameters()
 
-	if err := p.expectNextToken(token.LBRACE); err != nil {
-		fmt.Println("Expected { for macro body is missing: ", err.Error())
+	if lit.Parameters == nil || !p.expectNextToken(token.LBRACE) {
 		return nil
 	}
 
+	// Loops around the literal can't be controlled from its body
+	loops := p.loops
+	p.loops = 0
 	lit.Body = p.parseBlockStatement()
+	p.loops = loops
+
+	if lit.Body == nil {
+		return nil
+	}
+
 	return lit
 }
 
@@ -515,19 +868,24 @@ func (p *Parser) parseFunctionParameters() []*ast.Identifier {
 		return identifiers
 	}
 
-	p.nextToken()
+	if !p.expectNextToken(token.IDENT) {
+		return nil
+	}
 	identifiers = append(identifiers, &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal})
 
 	for p.peekTokenIs(token.COMMA) {
 		p.nextToken()
-		p.nextToken()
+		if !p.expectNextToken(token.IDENT) {
+			return nil
+		}
 		identifiers = append(identifiers, &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal})
 	}
 
-	if err := p.expectNextToken(token.RPAREN); err != nil {
-		fmt.Println("Expected ) for function params is missing: ", err.Error())
+	if !p.peekTokenIs(token.RPAREN) {
+		p.expectedError(p.peekToken, token.COMMA, token.RPAREN)
 		return nil
 	}
+	p.nextToken()
 
 	return identifiers
 }
@@ -540,6 +898,7 @@ func (p *Parser) parseCallExpression(function ast.Expression) ast.Expression {
 		return nil
 	}
 	exp.Arguments = args
+	exp.RParen = p.curToken
 	return exp
 }
 
@@ -551,6 +910,7 @@ func (p *Parser) parseArrayLiteral() ast.Expression {
 		return nil
 	}
 	array.Elements = elements
+	array.RBracket = p.curToken
 	return &array
 }
 
@@ -562,29 +922,31 @@ func (p *Parser) parseHashLiteral() ast.Expression {
 		p.nextToken()
 
 		key := p.parseExpression(LOWEST)
-
-		if err := p.expectNextToken(token.COLON); err != nil {
-			fmt.Println("Expected : missing in hash: ", err.Error())
+		if key == nil || !p.expectNextToken(token.COLON) {
 			return nil
 		}
 		p.nextToken()
 
 		value := p.parseExpression(LOWEST)
+		if value == nil {
+			return nil
+		}
 		hash.Pairs[key] = value
 
 		if !p.peekTokenIs(token.RBRACE) {
-			if err := p.expectNextToken(token.COMMA); err != nil {
-				fmt.Println("Expected , missing in hash: ", err.Error())
+			if !p.peekTokenIs(token.COMMA) {
+				p.expectedError(p.peekToken, token.COMMA, token.RBRACE)
 				return nil
 			}
+			p.nextToken()
 		}
 	}
 
-	if err := p.expectNextToken(token.RBRACE); err != nil {
-		fmt.Println("Expected closing } in hash: ", err.Error())
+	if !p.expectNextToken(token.RBRACE) {
 		return nil
 	}
 
+	hash.RBrace = p.curToken
 	return hash
 }
 
@@ -598,18 +960,27 @@ func (p *Parser) parseExpressionList(closingTag token.TokenType) []ast.Expressio
 	}
 
 	p.nextToken()
-	array = append(array, p.parseExpression(LOWEST))
+	if exp := p.parseExpression(LOWEST); exp != nil {
+		array = append(array, exp)
+	} else {
+		return nil
+	}
 
 	for p.peekTokenIs(token.COMMA) {
 		p.nextToken()
 		p.nextToken()
-		array = append(array, p.parseExpression(LOWEST))
+		if exp := p.parseExpression(LOWEST); exp != nil {
+			array = append(array, exp)
+		} else {
+			return nil
+		}
 	}
 
-	if err := p.expectNextToken(closingTag); err != nil {
-		fmt.Println("Expected closing ] in array not found: ", err.Error())
+	if !p.peekTokenIs(closingTag) {
+		p.expectedError(p.peekToken, token.COMMA, closingTag)
 		return nil
 	}
+	p.nextToken()
 
 	return array
 }
@@ -620,10 +991,10 @@ func (p *Parser) parseIndexExpression(left ast.Expression) ast.Expression {
 	p.nextToken()
 
 	exp.Index = p.parseExpression(LOWEST)
-	if err := p.expectNextToken(token.RBRACKET); err != nil {
-		fmt.Println("Expected closing ] missing in array indexing: ", err.Error())
+	if exp.Index == nil || !p.expectNextToken(token.RBRACKET) {
 		return nil
 	}
 
+	exp.RBracket = p.curToken
 	return exp
 }
@@ -6,8 +6,10 @@ import (
 	"strings"
 	"testing"
 
+	"sudocoding.xyz/interpreter_in_go/src/diagnostic"
 	"sudocoding.xyz/interpreter_in_go/src/lexer"
 	"sudocoding.xyz/interpreter_in_go/src/parser/ast"
+	"sudocoding.xyz/interpreter_in_go/src/token"
 )
 
 func eq[T comparable](t *testing.T, expected T, actual T, msg ...string) {
@@ -113,7 +115,7 @@ func Test_LetStatement(t *testing.T) {
   let foobar = 8723456;
   let a = "asdf"`
 
-	l := lexer.New_V2(strings.NewReader(input))
+	l := lexer.New(input)
 	p := New(l)
 
 	program := p.ParseProgram()
@@ -131,6 +133,32 @@ func Test_LetStatement(t *testing.T) {
 	}
 }
 
+func Test_ParseSliceSource(t *testing.T) {
+	// A token stream that never was source code, as built by tooling
+	tokens := []token.Token{
+		{Type: token.LET, Literal: "let"},
+		{Type: token.IDENT, Literal: "x"},
+		{Type: token.ASSIGN, Literal: "="},
+		{Type: token.INT, Literal: "1"},
+		{Type: token.PLUS, Literal: "+"},
+		{Type: token.INT, Literal: "2"},
+		{Type: token.SEMICOLON, Literal: ";"},
+	}
+
+	p := New(lexer.NewSliceSource(tokens))
+	program := p.ParseProgram()
+
+	checkParserErrs(t, p)
+	eq(t, "let x = (1 + 2);", program.String(), "Program mis-match")
+
+	p = New(lexer.NewSliceSource(tokens[:3]).WithSource("let x ="))
+	p.ParseProgram()
+
+	errs := p.Errors()
+	eq(t, 1, len(errs), "Expected an error for the missing value")
+	eq(t, "expected an expression, found end of file", errs[0].Message, "Message mismatch")
+}
+
 func Test_LetStatements(t *testing.T) {
 	for _, test := range []struct {
 		input         string
@@ -143,7 +171,7 @@ func Test_LetStatements(t *testing.T) {
 		{"let a = \"asdf\";", "a", "asdf"},
 	} {
 		t.Run(fmt.Sprintf("Test ran for input %s", test.input), func(t *testing.T) {
-			l := lexer.New_V2(strings.NewReader(test.input))
+			l := lexer.New(test.input)
 			p := New(l)
 			program := p.ParseProgram()
 
@@ -166,7 +194,7 @@ func Test_ReturnStatement(t *testing.T) {
   return add(5 ,10);
   return "asdf"`
 
-	l := lexer.New_V2(strings.NewReader(input))
+	l := lexer.New(input)
 	p := New(l)
 
 	program := p.ParseProgram()
@@ -194,7 +222,7 @@ func Test_ReturnStatements(t *testing.T) {
 		{"return \"asdf\"", "asdf"},
 	} {
 		t.Run(fmt.Sprintf("Test ran for input %s", test.input), func(t *testing.T) {
-			l := lexer.New_V2(strings.NewReader(test.input))
+			l := lexer.New(test.input)
 			p := New(l)
 			program := p.ParseProgram()
 
@@ -209,7 +237,7 @@ func Test_ReturnStatements(t *testing.T) {
 }
 
 func Test_IdentifierExpression(t *testing.T) {
-	l := lexer.New_V2(strings.NewReader(`foobar;`))
+	l := lexer.New(`foobar;`)
 	p := New(l)
 	program := p.ParseProgram()
 
@@ -228,7 +256,7 @@ func Test_IdentifierExpression(t *testing.T) {
 }
 
 func Test_IntegerLiteralExpression(t *testing.T) {
-	l := lexer.New_V2(strings.NewReader(`5;`))
+	l := lexer.New(`5;`)
 	p := New(l)
 	program := p.ParseProgram()
 
@@ -246,8 +274,91 @@ func Test_IntegerLiteralExpression(t *testing.T) {
 	eq(t, "5", integer.TokenLiteral(), "Int token literal mis-match")
 }
 
+func Test_IntegerLiteralBases(t *testing.T) {
+	for _, test := range []struct {
+		input    string
+		expected int64
+	}{
+		{"0xFF", 255},
+		{"0Xff", 255},
+		{"0o755", 493},
+		{"0b1010", 10},
+		{"1_000_000", 1000000},
+		{"0b1111_0000", 240},
+		{"0x7FFF_FFFF_FFFF_FFFF", 9223372036854775807},
+	} {
+		t.Run(fmt.Sprintf("Test integer literal %s", test.input), func(t *testing.T) {
+			p := New(lexer.New(test.input))
+			program := p.ParseProgram()
+			checkParserErrs(t, p)
+
+			stmt := program.Statements[0].(*ast.ExpressionStatement)
+			integer, ok := stmt.Expression.(*ast.IntegerLiteral)
+			eq(t, true, ok, "Failed at typecasting stmt.Epxression to *ast.IntegerLiteral")
+
+			eq(t, test.expected, integer.Value, "Int value mis-match")
+			eq(t, test.input, integer.String(), "Literal should be kept as written")
+		})
+	}
+}
+
+func Test_BigIntegerLiteralExpression(t *testing.T) {
+	l := lexer.New(`99999999999999999999;`)
+	p := New(l)
+	program := p.ParseProgram()
+
+	checkParserErrs(t, p)
+
+	eq(t, 1, len(program.Statements), "Expected 1 statement in the program")
+
+	stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+	eq(t, true, ok, "Failed at typecasting program.Statement[0] to *ast.ExpressionStatement")
+
+	integer, ok := stmt.Expression.(*ast.BigIntegerLiteral)
+	eq(t, true, ok, "Failed at typecasting stmt.Epxression to *ast.BigIntegerLiteral")
+
+	eq(t, "99999999999999999999", integer.Value.String(), "Big int value mis-match")
+	eq(t, "99999999999999999999", integer.TokenLiteral(), "Big int token literal mis-match")
+}
+
+func Test_FloatLiteralExpression(t *testing.T) {
+	for _, test := range []struct {
+		input    string
+		expected float64
+	}{
+		{"1.5;", 1.5},
+		{".25", 0.25},
+		{"2e3", 2000},
+		{"1.5e-1", 0.15},
+	} {
+		t.Run(fmt.Sprintf("Test parsing %q", test.input), func(t *testing.T) {
+			l := lexer.New(test.input)
+			p := New(l)
+			program := p.ParseProgram()
+
+			checkParserErrs(t, p)
+
+			eq(t, 1, len(program.Statements), "Expected 1 statement in the program")
+
+			stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+			eq(t, true, ok, "Failed at typecasting program.Statement[0] to *ast.ExpressionStatement")
+
+			float, ok := stmt.Expression.(*ast.FloatLiteral)
+			eq(t, true, ok, "Failed at typecasting stmt.Epxression to *ast.FloatLiteral")
+			eq(t, test.expected, float.Value, "Float value mis-match")
+		})
+	}
+
+	l := lexer.New("1e999")
+	p := New(l)
+	p.ParseProgram()
+
+	eq(t, 1, len(p.Errors()), "Expected 1 error")
+	eq(t, "1:1: error[P0008]: invalid float literal 1e999: value out of range", p.Errors()[0].Error())
+}
+
 func Test_StringLiteralExpression(t *testing.T) {
-	l := lexer.New_V2(strings.NewReader(`"asdf";`))
+	l := lexer.New(`"asdf";`)
 	p := New(l)
 	program := p.ParseProgram()
 
@@ -265,6 +376,61 @@ func Test_StringLiteralExpression(t *testing.T) {
 	eq(t, "asdf", str.TokenLiteral(), "String token literal mis-match")
 }
 
+func Test_StringLiteralRoundTrip(t *testing.T) {
+	for _, test := range []struct {
+		input    string
+		expected string
+	}{
+		{`"asdf"`, `"asdf"`},
+		{`"say \"hi\"\n"`, `"say \"hi\"\n"`},
+		{"`C:\\path\\n`", `"C:\\path\\n"`},
+		{"\"\"\"\n  line 1\n    line 2\n  \"\"\"", `"line 1\n  line 2"`},
+		{`"\u{1F600}\x01\0\t"`, `"😀\x01\0\t"`},
+	} {
+		t.Run(fmt.Sprintf("Test round trip for %q", test.input), func(t *testing.T) {
+			p := New(lexer.New(test.input))
+			program := p.ParseProgram()
+			checkParserErrs(t, p)
+
+			eq(t, test.expected, program.String(), "String() mis-match")
+
+			again := New(lexer.New(program.String()))
+			reparsed := again.ParseProgram()
+			checkParserErrs(t, again)
+
+			value := program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.StringLiteral).Value
+			reparsedValue := reparsed.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.StringLiteral).Value
+			eq(t, value, reparsedValue, "Value changed after the round trip")
+		})
+	}
+}
+
+func Test_InterpolatedString(t *testing.T) {
+	for _, test := range []struct {
+		input    string
+		expected string
+		parts    int
+	}{
+		{`"a ${x} b"`, `"a ${x} b"`, 3},
+		{`"${x}${y + 1}"`, `"${x}${(y + 1)}"`, 5},
+		{`"hi ${user["name"]}, ${len(items)} items\n"`, `"hi ${(user["name"])}, ${len(items)} items\n"`, 5},
+		{`"outer ${ "inner ${ {"k": 1}["k"] }" } \${kept}"`, `"outer ${"inner ${({"k" : 1}["k"])}"} \${kept}"`, 3},
+	} {
+		t.Run(fmt.Sprintf("Test interpolated string %s", test.input), func(t *testing.T) {
+			p := New(lexer.New(test.input))
+			program := p.ParseProgram()
+			checkParserErrs(t, p)
+
+			stmt := program.Statements[0].(*ast.ExpressionStatement)
+			str, ok := stmt.Expression.(*ast.InterpolatedString)
+			eq(t, true, ok, "Failed at typecasting stmt.Expression to *ast.InterpolatedString")
+			eq(t, test.parts, len(str.Parts), "Parts count mis-match")
+			eq(t, test.expected, str.String(), "String() mis-match")
+			eq(t, len(test.input), str.End().Offset, "End position mis-match")
+		})
+	}
+}
+
 func Test_PrefixExpression(t *testing.T) {
 	for _, test := range []struct {
 		name     string
@@ -298,7 +464,7 @@ func Test_PrefixExpression(t *testing.T) {
 		},
 	} {
 		t.Run(test.name, func(t *testing.T) {
-			l := lexer.New_V2(strings.NewReader(test.input))
+			l := lexer.New(test.input)
 			p := New(l)
 			program := p.ParseProgram()
 
@@ -432,7 +598,7 @@ func Test_InfixOperators(t *testing.T) {
 		},
 	} {
 		t.Run(test.name, func(t *testing.T) {
-			l := lexer.New_V2(strings.NewReader(test.input))
+			l := lexer.New(test.input)
 			p := New(l)
 			program := p.ParseProgram()
 
@@ -480,9 +646,37 @@ func Test_OperatorPrecedenceParsing(t *testing.T) {
 		{"add(a + b + c * d / f + g)", "add((((a + b) + (c * (d / f))) + g))"},
 		{"a * [1, 2, 3, 4][b * c] * d", "((a * ([1, 2, 3, 4][(b * c)])) * d)"},
 		{"add(a * b[2], b[1], 2 * [1, 2][1])", "add((a * (b[2])), (b[1]), (2 * ([1, 2][1])))"},
+		{"a + b % c", "(a + (b % c))"},
+		{"a ~/ b * c", "((a ~/ b) * c)"},
+		{"a * b ~/ c", "((a * b) ~/ c)"},
+		{"a * b % c", "((a * b) % c)"},
+		{"a % b * c", "((a % b) * c)"},
+		{"a / b % c ~/ d * e", "((((a / b) % c) ~/ d) * e)"},
+		{"a * b % c + d ~/ e * f", "(((a * b) % c) + ((d ~/ e) * f))"},
+		{"a % b / c", "(a % (b / c))"},
+		{"2 ** 3 ** 2", "(2 ** (3 ** 2))"},
+		{"-2 ** 2", "(-(2 ** 2))"},
+		{"2 ** -1", "(2 ** (-1))"},
+		{"a * b ** c", "(a * (b ** c))"},
+		{"a[0] ** f(b)", "((a[0]) ** f(b))"},
+		{"a || b && c", "(a || (b && c))"},
+		{"a && b || c", "((a && b) || c)"},
+		{"a == b && c < d", "((a == b) && (c < d))"},
+		{"!a || b", "((!a) || b)"},
+		{"a || b || c", "((a || b) || c)"},
+		{"a | b ^ c & d", "(a | (b ^ (c & d)))"},
+		{"a & b | c", "((a & b) | c)"},
+		{"a << 1 + b", "(a << (1 + b))"},
+		{"a & b << 2", "(a & (b << 2))"},
+		{"a >> b >> c", "((a >> b) >> c)"},
+		{"flags & mask == 0", "((flags & mask) == 0)"},
+		{"a | b < c", "((a | b) < c)"},
+		{"~a & b", "((~a) & b)"},
+		{"~-a ** 2", "(~(-(a ** 2)))"},
+		{"a && b | c", "(a && (b | c))"},
 	} {
 		t.Run(fmt.Sprintf("Test %s to give %s", test.input, test.expected), func(t *testing.T) {
-			l := lexer.New_V2(strings.NewReader(test.input))
+			l := lexer.New(test.input)
 			p := New(l)
 			program := p.ParseProgram()
 
@@ -501,7 +695,7 @@ func Test_Boolean(t *testing.T) {
 		{"false", false},
 	} {
 		t.Run(fmt.Sprintf("test for %s boolean", test.input), func(t *testing.T) {
-			l := lexer.New_V2(strings.NewReader(test.input))
+			l := lexer.New(test.input)
 			p := New(l)
 			program := p.ParseProgram()
 
@@ -516,7 +710,7 @@ func Test_Boolean(t *testing.T) {
 }
 
 func Test_IfExpression(t *testing.T) {
-	l := lexer.New_V2(strings.NewReader("if (x < y) { x }"))
+	l := lexer.New("if (x < y) { x }")
 	p := New(l)
 	program := p.ParseProgram()
 
@@ -541,7 +735,7 @@ func Test_IfExpression(t *testing.T) {
 }
 
 func Test_IfElseExpression(t *testing.T) {
-	l := lexer.New_V2(strings.NewReader("if (x < y) { x } else { y }"))
+	l := lexer.New("if (x < y) { x } else { y }")
 	p := New(l)
 	program := p.ParseProgram()
 
@@ -571,7 +765,7 @@ func Test_IfElseExpression(t *testing.T) {
 }
 
 func Test_FunctionLiteralParsing(t *testing.T) {
-	l := lexer.New_V2(strings.NewReader("fn(x, y) { x + y }"))
+	l := lexer.New("fn(x, y) { x + y }")
 	p := New(l)
 	program := p.ParseProgram()
 
@@ -603,7 +797,7 @@ func Test_FunctionParameterParsing(t *testing.T) {
 		{"fn(x,y) {}", []string{"x", "y"}},
 	} {
 		t.Run(fmt.Sprintf("Test params for fun : %s", test.input), func(t *testing.T) {
-			l := lexer.New_V2(strings.NewReader(test.input))
+			l := lexer.New(test.input)
 			p := New(l)
 			program := p.ParseProgram()
 
@@ -625,7 +819,7 @@ func Test_FunctionParameterParsing(t *testing.T) {
 }
 
 func Test_CallExpression(t *testing.T) {
-	l := lexer.New_V2(strings.NewReader("add(1, 2 * 3, 4 + 5);"))
+	l := lexer.New("add(1, 2 * 3, 4 + 5);")
 	p := New(l)
 	program := p.ParseProgram()
 
@@ -645,7 +839,7 @@ func Test_CallExpression(t *testing.T) {
 }
 
 func Test_Assignment(t *testing.T) {
-	l := lexer.New_V2(strings.NewReader("a = a + b * 5;"))
+	l := lexer.New("a = a + b * 5;")
 	p := New(l)
 	program := p.ParseProgram()
 
@@ -661,17 +855,23 @@ func Test_Assignment(t *testing.T) {
 }
 
 func Test_AssignmentErr(t *testing.T) {
-	l := lexer.New_V2(strings.NewReader("a = ;"))
+	l := lexer.New("a = ;")
 	p := New(l)
 	p.ParseProgram()
 
-	eq(t, 2, len(p.Errors()), "Expected 2 error")
-	eq(t, "No prefix parser function for ; found", p.Errors()[0].Error(), "1st Err msg didn't match")
-	eq(t, "Got empty expression on RHS of assignment", p.Errors()[1].Error(), "2nd Err msg didn't match")
+	eq(t, 1, len(p.Errors()), "Expected 1 error")
+	eq(t, "1:3: error[P0004]: expected an expression on the right of '='", p.Errors()[0].Error(), "Err msg didn't match")
+
+	// Errors in the expression are the ones of the expression
+	p = New(lexer.New("a = 1 + ;"))
+	p.ParseProgram()
+
+	eq(t, 1, len(p.Errors()), "Expected 1 error")
+	eq(t, "1:9: error[P0002]: expected an expression, found ';'", p.Errors()[0].Error(), "Err msg didn't match")
 }
 
 func Test_ParsingArrayLiteral(t *testing.T) {
-	l := lexer.New_V2(strings.NewReader(`[1, 2 * 3, "asdf", true, false]`))
+	l := lexer.New(`[1, 2 * 3, "asdf", true, false]`)
 	p := New(l)
 	program := p.ParseProgram()
 
@@ -693,7 +893,7 @@ func Test_ParsingArrayLiteral(t *testing.T) {
 }
 
 func Test_IndexExpression(t *testing.T) {
-	l := lexer.New_V2(strings.NewReader("arr[1 + 1]"))
+	l := lexer.New("arr[1 + 1]")
 	p := New(l)
 	program := p.ParseProgram()
 
@@ -720,7 +920,7 @@ func Test_HashLiteral(t *testing.T) {
 		{`{"a": 0 + 1}`, `{"a" : (0 + 1)}`},
 	} {
 		t.Run(fmt.Sprintf("Test Hash Literal for %s", test.input), func(t *testing.T) {
-			l := lexer.New_V2(strings.NewReader(test.input))
+			l := lexer.New(test.input)
 			p := New(l)
 			program := p.ParseProgram()
 
@@ -739,7 +939,7 @@ func Test_HashLiteral(t *testing.T) {
 }
 
 func Test_MacroLiteral(t *testing.T) {
-	l := lexer.New_V2(strings.NewReader("macro(x,y){ x + y; }"))
+	l := lexer.New("macro(x,y){ x + y; }")
 	p := New(l)
 	program := p.ParseProgram()
 
@@ -759,3 +959,301 @@ func Test_MacroLiteral(t *testing.T) {
 	eq(t, true, ok, "Failed to typecast macro.Body to *ast.ExpressionStatement")
 	eq(t, true, testInfixExpression(t, bdy.Expression, "x", "+", "y"))
 }
+
+func Test_NodePositions(t *testing.T) {
+	l := lexer.New("let a = 1;\nadd(a, [2, 3])[0];\nif (a) { a } else { b }")
+	p := New(l)
+	program := p.ParseProgram()
+
+	checkParserErrs(t, p)
+
+	eq(t, 3, len(program.Statements), "Expected 3 program statements")
+
+	for _, test := range []struct {
+		node  ast.Node
+		start string
+		end   string
+	}{
+		{program, "1:1", "3:24"},
+		{program.Statements[0], "1:1", "1:10"},
+		{program.Statements[0].(*ast.LetStatement).Name, "1:5", "1:6"},
+		{program.Statements[1], "2:1", "2:18"},
+		{program.Statements[1].(*ast.ExpressionStatement).Expression.(*ast.IndexExpression).Left, "2:1", "2:15"},
+		{program.Statements[2], "3:1", "3:24"},
+		{program.Statements[2].(*ast.ExpressionStatement).Expression.(*ast.IfExpression).Consequence, "3:8", "3:13"},
+	} {
+		eq(t, test.start, test.node.Pos().String(), "Start position mismatch for", test.node.String())
+		eq(t, test.end, test.node.End().String(), "End position mismatch for", test.node.String())
+	}
+}
+
+func Test_Diagnostics(t *testing.T) {
+	for _, test := range []struct {
+		input    string
+		code     diagnostic.Code
+		message  string
+		pos      string
+		expected []token.TokenType
+		snippet  string
+	}{
+		{
+			input:    "let = 5;",
+			code:     ErrUnexpectedToken,
+			message:  "expected identifier, found '='",
+			pos:      "1:5",
+			expected: []token.TokenType{token.IDENT},
+			snippet:  "   |\n 1 | let = 5;\n   |     ^",
+		},
+		{
+			input:    "let a = 1;\nadd(1, 2",
+			code:     ErrUnexpectedToken,
+			message:  "expected ',' or ')', found end of file",
+			pos:      "2:9",
+			expected: []token.TokenType{token.COMMA, token.RPAREN},
+			snippet:  "   |\n 2 | add(1, 2\n   |         ^",
+		},
+		{
+			input:   "let a = 1.5e999;",
+			code:    ErrInvalidFloat,
+			message: "invalid float literal 1.5e999: value out of range",
+			pos:     "1:9",
+			snippet: "   |\n 1 | let a = 1.5e999;\n   |         ^^^^^^^",
+		},
+		{
+			input:   "let a = 0xFG;",
+			code:    ErrInvalidInteger,
+			message: "invalid integer literal 0xFG: invalid syntax",
+			pos:     "1:9",
+			snippet: "   |\n 1 | let a = 0xFG;\n   |         ^^^^",
+		},
+		{
+			input:   "let a = 1__000;",
+			code:    ErrInvalidInteger,
+			message: "invalid integer literal 1__000: invalid syntax",
+			pos:     "1:9",
+			snippet: "   |\n 1 | let a = 1__000;\n   |         ^^^^^^",
+		},
+		{
+			input:   "let a = @;",
+			code:    lexer.ErrIllegalCharacter,
+			message: "illegal character '@'",
+			pos:     "1:9",
+			snippet: "   |\n 1 | let a = @;\n   |         ^",
+		},
+		{
+			input:   "let a = \"x ${}\";",
+			code:    ErrExpectedExpr,
+			message: "expected an expression, found '}'",
+			pos:     "1:14",
+			snippet: "   |\n 1 | let a = \"x ${}\";\n   |              ^^",
+		},
+		{
+			input:    "let a = \"x ${1 2}\";",
+			code:     ErrUnexpectedToken,
+			message:  "expected '}', found '2'",
+			pos:      "1:16",
+			expected: []token.TokenType{token.STR_TAIL},
+			snippet:  "   |\n 1 | let a = \"x ${1 2}\";\n   |                ^",
+		},
+		{
+			input:   "\tlet a = \"abc",
+			code:    lexer.ErrUnterminatedString,
+			message: "unterminated string literal",
+			pos:     "1:10",
+			snippet: "   |\n 1 | \tlet a = \"abc\n   | \t        ^",
+		},
+	} {
+		t.Run(fmt.Sprintf("Test diagnostic for %q", test.input), func(t *testing.T) {
+			l := lexer.New(test.input)
+			p := New(l)
+			p.ParseProgram()
+
+			errs := p.Errors()
+			notEq(t, 0, len(errs), "Expected at least 1 error")
+
+			diag := errs[0]
+			eq(t, diagnostic.Error, diag.Severity, "Severity mismatch")
+			eq(t, test.code, diag.Code, "Code mismatch")
+			eq(t, test.message, diag.Message, "Message mismatch")
+			eq(t, test.pos, diag.Pos.String(), "Position mismatch")
+			eq(t, fmt.Sprint(test.expected), fmt.Sprint(diag.Expected), "Expected tokens mismatch")
+			eq(t, test.snippet, diag.Snippet, "Snippet mismatch")
+		})
+	}
+}
+
+func Test_ErrorRecovery(t *testing.T) {
+	for _, test := range []struct {
+		input      string
+		errors     []string
+		statements []string
+	}{
+		{
+			input: "let a = 5 *;\nlet = 10;\nlet c = add(1, 2;\nlet d = a + c;",
+			errors: []string{
+				"1:12: error[P0002]: expected an expression, found ';'",
+				"2:5: error[P0001]: expected identifier, found '='",
+				"3:17: error[P0001]: expected ',' or ')', found ';'",
+			},
+			statements: []string{"let d = (a + c);"},
+		},
+		{
+			input: "let f = fn(x) { let y = ; x };\nf(1)\nlet z = {1: };",
+			errors: []string{
+				"1:25: error[P0002]: expected an expression, found ';'",
+				"3:13: error[P0002]: expected an expression, found '}'",
+			},
+			statements: []string{"let f = fn(x)x;", "f(1)"},
+		},
+		{
+			input: "if (a) { let = 1; b } else { c",
+			errors: []string{
+				"1:14: error[P0001]: expected identifier, found '='",
+				"1:31: error[P0001]: expected '}', found end of file",
+			},
+			statements: []string{},
+		},
+		{
+			input: "fn(a, 1) { a }; let b = [1, , 2]; let c = 3",
+			errors: []string{
+				"1:7: error[P0001]: expected identifier, found '1'",
+				"1:29: error[P0002]: expected an expression, found ','",
+			},
+			statements: []string{"let c = 3;"},
+		},
+		{
+			input: `let b = "b", {"b": 2}[b]`,
+			errors: []string{
+				"1:12: error[P0002]: expected an expression, found ','",
+			},
+			statements: []string{`let b = "b";`},
+		},
+	} {
+		t.Run(fmt.Sprintf("Test recovery for %q", test.input), func(t *testing.T) {
+			l := lexer.New(test.input)
+			p := New(l)
+			program := p.ParseProgram()
+
+			errs := []string{}
+			for _, diag := range p.Errors() {
+				errs = append(errs, diag.Error())
+			}
+			eq(t, strings.Join(test.errors, "\n"), strings.Join(errs, "\n"), "Errors mismatch")
+
+			stmts := []string{}
+			for _, stmt := range program.Statements {
+				notEq(t, nil, stmt, "Nil statement in program")
+				stmts = append(stmts, stmt.String())
+			}
+			eq(t, strings.Join(test.statements, "\n"), strings.Join(stmts, "\n"), "Statements mismatch")
+		})
+	}
+}
+
+func Test_TryExpression(t *testing.T) {
+	for _, test := range []struct {
+		input    string
+		expected string
+	}{
+		{"try { a } catch (e) { b }", "tryacatch(e)b"},
+		{"try { a } finally { c }", "tryafinallyc"},
+		{"let x = try { a } catch (e) { b } finally { c };", "let x = tryacatch(e)bfinallyc;"},
+		{"throw 1 + 2;", "throw (1 + 2);"},
+		{"throw \"oops\"", "throw \"oops\";"},
+	} {
+		t.Run(fmt.Sprintf("Test parsing %q", test.input), func(t *testing.T) {
+			l := lexer.New(test.input)
+			p := New(l)
+			program := p.ParseProgram()
+
+			checkParserErrs(t, p)
+
+			eq(t, 1, len(program.Statements), "Expected 1 statement in program")
+			eq(t, test.expected, program.String())
+		})
+	}
+}
+
+func Test_TryExpressionErr(t *testing.T) {
+	for _, test := range []struct {
+		input string
+		err   string
+	}{
+		{"try { a }", "1:10: error[P0001]: expected 'catch' or 'finally', found end of file"},
+		{"try { a } catch { b }", "1:17: error[P0001]: expected '(', found '{'"},
+		{"try { a } catch (1) { b }", "1:18: error[P0001]: expected identifier, found '1'"},
+		{"throw;", "1:6: error[P0002]: expected an expression, found ';'"},
+	} {
+		t.Run(fmt.Sprintf("Test parsing %q", test.input), func(t *testing.T) {
+			l := lexer.New(test.input)
+			p := New(l)
+			p.ParseProgram()
+
+			eq(t, 1, len(p.Errors()), "Expected 1 error")
+			eq(t, test.err, p.Errors()[0].Error())
+		})
+	}
+}
+
+func Test_Loops(t *testing.T) {
+	for _, test := range []struct {
+		input    string
+		expected string
+	}{
+		{"while (a < 10) { a = a + 1 }", "while(a < 10) a = (a + 1)"},
+		{"for (x in xs) { print(x) }", "for(x in xs) print(x)"},
+		{"for (k, v in {1: 2}) { k }", "for(k, v in {1 : 2}) k"},
+		{"while (true) { if (a) { break; } continue }", "whiletrue ifa  break;continue;"},
+		{"for (x in xs) { let f = fn() { 1 }; for (y in ys) { break } }", "for(x in xs) let f = fn()1;for(y in ys) break;"},
+		{"while (a) { a };", "whilea a"},
+		{"for (x in xs) { x };", "for(x in xs) x"},
+	} {
+		t.Run(fmt.Sprintf("Test parsing %q", test.input), func(t *testing.T) {
+			l := lexer.New(test.input)
+			p := New(l)
+			program := p.ParseProgram()
+
+			checkParserErrs(t, p)
+
+			eq(t, 1, len(program.Statements), "Expected 1 statement in program")
+			eq(t, test.expected, program.String())
+		})
+	}
+}
+
+func Test_LoopsErr(t *testing.T) {
+	for _, test := range []struct {
+		input string
+		err   string
+	}{
+		{"break;", "1:1: error[P0007]: 'break' outside of a loop"},
+		{"if (a) { continue }", "1:10: error[P0007]: 'continue' outside of a loop"},
+		{"while (a) { fn() { break } }", "1:20: error[P0007]: 'break' outside of a loop"},
+		{"for (x of xs) { x }", "1:8: error[P0001]: expected 'in', found identifier 'of'"},
+		{"for (1 in xs) { x }", "1:6: error[P0001]: expected identifier, found '1'"},
+		{"while a { a }", "1:7: error[P0001]: expected '(', found identifier 'a'"},
+	} {
+		t.Run(fmt.Sprintf("Test parsing %q", test.input), func(t *testing.T) {
+			l := lexer.New(test.input)
+			p := New(l)
+			p.ParseProgram()
+
+			eq(t, 1, len(p.Errors()), "Expected 1 error")
+			eq(t, test.err, p.Errors()[0].Error())
+		})
+	}
+}
+
+func Test_FunctionLiteralName(t *testing.T) {
+	l := lexer.New("let add = fn(a, b) { a + b }; fn() {}")
+	p := New(l)
+	program := p.ParseProgram()
+
+	checkParserErrs(t, p)
+
+	named := program.Statements[0].(*ast.LetStatement).Value.(*ast.FunctionLiteral)
+	eq(t, "add", named.Name, "Expected function to be named after its variable")
+
+	anonymous := program.Statements[1].(*ast.ExpressionStatement).Expression.(*ast.FunctionLiteral)
+	eq(t, "", anonymous.Name, "Expected function to be anonymous")
+}
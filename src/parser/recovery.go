@@ -0,0 +1,51 @@
+package parser
+
+import "sudocoding.xyz/interpreter_in_go/src/token"
+
+// statementStarts - tokens that can only start a new statement. Recovery
+// resumes parsing at them.
+var statementStarts = map[token.TokenType]bool{
+	token.LET:      true,
+	token.RETURN:   true,
+	token.THROW:    true,
+	token.WHILE:    true,
+	token.FOR:      true,
+	token.BREAK:    true,
+	token.CONTINUE: true,
+}
+
+// synchronize - panic mode recovery. After an error, skips tokens till the
+// parser reaches a point where parsing a new statement makes sense again:
+//   - right after a `;`
+//   - at the `}` closing the block being parsed
+//   - at a token that can only start a statement
+//
+// Everything within braces opened while skipping is skipped as well. `start`
+// is the number of tokens consumed when the broken statement started, which
+// guarantees the parser moves forward.
+func (p *Parser) synchronize(start int) {
+	p.recovering = false
+	base := p.braces
+
+	for !p.curTokenIs(token.EOF) {
+		switch {
+		case p.curTokenIs(token.RBRACE) && p.closesBlock():
+			return
+		case p.braces > base:
+			// Inside braces opened by the broken statement
+		case p.curTokenIs(token.SEMICOLON):
+			p.nextToken()
+			return
+		case p.consumed != start && statementStarts[p.curToken.Type]:
+			return
+		}
+
+		p.nextToken()
+	}
+}
+
+// closesBlock - returns true if the current `}` token closes the innermost
+// block being parsed
+func (p *Parser) closesBlock() bool {
+	return len(p.blocks) > 0 && p.braces == p.blocks[len(p.blocks)-1]-1
+}
@@ -6,58 +6,45 @@ import (
 	"io"
 	"strings"
 
-	"sudocoding.xyz/interpreter_in_go/src/evaluator"
-	"sudocoding.xyz/interpreter_in_go/src/lexer"
-	"sudocoding.xyz/interpreter_in_go/src/object"
-	"sudocoding.xyz/interpreter_in_go/src/parser"
+	"sudocoding.xyz/interpreter_in_go/src/monkie"
 )
 
 const PROMPT = ">> "
 
-func Start(in io.Reader, out io.Writer) {
-	scanner := bufio.NewScanner(in)
-	env := object.NewEnvironment()
-	macroEnv := object.NewEnvironment()
+// Start - reads lines from `in` and evaluates them, writing the results,
+// errors and output of the code to `out`. `input` and `readLine` read the
+// lines that follow from `in`. The options configure the interpreter further.
+func Start(in io.Reader, out io.Writer, options ...monkie.Option) {
+	reader := bufio.NewReader(in)
+	options = append([]monkie.Option{monkie.WithStdout(out), monkie.WithStderr(out), monkie.WithStdin(reader)}, options...)
+	interpreter := monkie.New(options...)
 
 	for {
 		fmt.Fprintf(out, PROMPT)
-		scanned := scanner.Scan()
+		line, err := reader.ReadString('\n')
 
-		if !scanned {
+		if err != nil && line == "" {
 			return
 		}
 
-		line := scanner.Text()
+		line = strings.TrimRight(line, "\r\n")
 
 		if line == "exit" {
-			fmt.Println("Byeee")
+			fmt.Fprintln(out, "Byeee")
 			return
 		}
 
-		l := lexer.New_V2(strings.NewReader(line))
-		p := parser.New(l)
-
-		program := p.ParseProgram()
-		if len(p.Errors()) != 0 {
-			printParseErrors(out, p.Errors())
+		evaluated, err := interpreter.Eval(line)
+		if err != nil {
+			interpreter.Report(err)
 			continue
 		}
 
-		evaluator.DefineMacros(program, macroEnv)
-		expanded := evaluator.ExpandMacros(program, macroEnv)
-
-		evaluator := evaluator.Eval(expanded, env)
-		if evaluator == nil {
+		if evaluated == nil {
 			continue
 		}
 
-		io.WriteString(out, evaluator.Inspect())
+		io.WriteString(out, evaluated.Inspect())
 		io.WriteString(out, "\n")
 	}
 }
-
-func printParseErrors(out io.Writer, errors []error) {
-	for _, err := range errors {
-		io.WriteString(out, "\t"+err.Error()+"\n")
-	}
-}
@@ -0,0 +1,287 @@
+// Package resolver - binds the identifiers of programs to the variables they
+// refer to before the programs run, so the evaluator reads the variables of
+// functions from the slots of their frames instead of looking them up by
+// name, and identifiers referring to nothing are reported before anything
+// runs
+package resolver
+
+import (
+	"fmt"
+
+	"sudocoding.xyz/interpreter_in_go/src/diagnostic"
+	"sudocoding.xyz/interpreter_in_go/src/evaluator"
+	"sudocoding.xyz/interpreter_in_go/src/parser/ast"
+)
+
+// Diagnostic codes reported by the resolver
+const (
+	ErrUndefined  diagnostic.Code = "R0001" // identifier that is neither a variable nor a builtin
+	ErrUnassigned diagnostic.Code = "R0002" // assignment to a variable that isn't declared
+)
+
+// Resolver - resolves programs running one after another with the same
+// globals, like the lines typed in the REPL
+type Resolver struct {
+	globals map[string]bool // Globals of the previous programs and the ones declared with Declare
+
+	// State of the program being resolved
+	declared map[string]bool          // Globals the program declared so far
+	scopes   []*scope                 // Functions being resolved, innermost last
+	pending  []*ast.FunctionLiteral   // Functions of the program itself, resolved after it
+	diags    []*diagnostic.Diagnostic // Problems found so far
+}
+
+// scope - the variables of a function being resolved
+type scope struct {
+	fn       *ast.FunctionLiteral
+	slots    map[string]int
+	declared map[string]bool        // Variables declared so far, the other slots being the ones the function assigns
+	pending  []*ast.FunctionLiteral // Functions defined in the function, resolved after it
+}
+
+// New - creates a resolver knowing about no globals
+func New() *Resolver {
+	return &Resolver{globals: map[string]bool{}}
+}
+
+// Declare - declares a global the programs didn't, like one set from Go
+func (r *Resolver) Declare(name string) {
+	r.globals[name] = true
+}
+
+// Resolve - fills in where the variables of the identifiers of the program
+// live, see ast.Identifier, and the slots of its functions. Returns the
+// diagnostics of the identifiers referring to no variable, sorted by
+// position. The globals the program declares are known to the following
+// programs unless there are any.
+//
+// The code of the program itself only sees the globals declared before it,
+// functions see all the globals of the program since they run later. Within
+// a function, variables are visible from their declaration on, and the
+// functions defined in it see all its variables the same way.
+func (r *Resolver) Resolve(program ast.Node) []*diagnostic.Diagnostic {
+	r.declared = map[string]bool{}
+	r.scopes = nil
+	r.pending = nil
+	r.diags = nil
+
+	r.resolve(program)
+	for i := 0; i < len(r.pending); i++ {
+		r.function(r.pending[i])
+	}
+
+	if len(r.diags) > 0 {
+		diagnostic.Sort(r.diags)
+		return r.diags
+	}
+
+	for name := range r.declared {
+		r.globals[name] = true
+	}
+	return nil
+}
+
+func (r *Resolver) resolve(node ast.Node) {
+	switch node := node.(type) {
+	case *ast.Program:
+		for _, statement := range node.Statements {
+			r.resolve(statement)
+		}
+	case *ast.BlockStatement:
+		for _, statement := range node.Statements {
+			r.resolve(statement)
+		}
+	case *ast.ExpressionStatement:
+		r.resolve(node.Expression)
+	case *ast.LetStatement:
+		// Functions see themselves, so they can be recursive
+		if _, ok := node.Value.(*ast.FunctionLiteral); ok {
+			r.declare(node.Name)
+		}
+		r.resolve(node.Value)
+		r.declare(node.Name)
+	case *ast.Assignment:
+		r.resolve(node.Value)
+		if !r.assignable(node.Identifier.Value) {
+			r.errorAt(node.Identifier, ErrUnassigned, "variable %s hasn't been initialized", node.Identifier.Value)
+		}
+		r.bind(node.Identifier)
+	case *ast.ReturnStatement:
+		r.resolve(node.ReturnValue)
+	case *ast.ThrowStatement:
+		r.resolve(node.Value)
+	case *ast.WhileStatement:
+		r.resolve(node.Condition)
+		r.resolve(node.Body)
+	case *ast.ForStatement:
+		r.resolve(node.Iterable)
+		if node.Key != nil {
+			r.declare(node.Key)
+		}
+		r.declare(node.Value)
+		r.resolve(node.Body)
+
+	case *ast.Identifier:
+		if _, builtin := evaluator.LookupBuiltin(node.Value); !r.bind(node) && !builtin {
+			r.errorAt(node, ErrUndefined, "identifier not found: %s", node.Value)
+		}
+	case *ast.InterpolatedString:
+		for _, part := range node.Parts {
+			r.resolve(part)
+		}
+	case *ast.ArrayLiteral:
+		for _, elm := range node.Elements {
+			r.resolve(elm)
+		}
+	case *ast.HashLiteral:
+		for key, value := range node.Pairs {
+			r.resolve(key)
+			r.resolve(value)
+		}
+	case *ast.IndexExpression:
+		r.resolve(node.Left)
+		r.resolve(node.Index)
+	case *ast.PrefixExpression:
+		r.resolve(node.Right)
+	case *ast.InfixExpression:
+		r.resolve(node.Left)
+		r.resolve(node.Right)
+	case *ast.IfExpression:
+		r.resolve(node.Condition)
+		r.resolve(node.Consequence)
+		if node.Alternative != nil {
+			r.resolve(node.Alternative)
+		}
+	case *ast.TryExpression:
+		r.resolve(node.Block)
+		if node.Catch != nil {
+			r.declare(node.Param)
+			r.resolve(node.Catch)
+		}
+		if node.Finally != nil {
+			r.resolve(node.Finally)
+		}
+	case *ast.FunctionLiteral:
+		if len(r.scopes) == 0 {
+			r.pending = append(r.pending, node)
+		} else {
+			s := r.scopes[len(r.scopes)-1]
+			s.pending = append(s.pending, node)
+		}
+	case *ast.CallExpression:
+		if node.Function.TokenLiteral() == evaluator.QUOTE_LITERAL {
+			for _, arg := range node.Arguments {
+				r.quoted(arg)
+			}
+			return
+		}
+
+		r.resolve(node.Function)
+		for _, arg := range node.Arguments {
+			r.resolve(arg)
+		}
+	}
+}
+
+// function - resolves the function in the functions being resolved
+func (r *Resolver) function(fn *ast.FunctionLiteral) {
+	s := &scope{fn: fn, slots: map[string]int{}, declared: map[string]bool{}}
+	fn.Locals = []string{}
+	fn.Assigned = nil
+	r.scopes = append(r.scopes, s)
+
+	// Arguments go to the first slots in order, a repeated parameter is the
+	// last argument of its name
+	for _, param := range fn.Parameters {
+		s.slots[param.Value] = len(fn.Locals)
+		s.declared[param.Value] = true
+		fn.Locals = append(fn.Locals, param.Value)
+		r.bind(param)
+	}
+
+	// Assigning a variable from a function sets a variable of the function,
+	// which is the one of the same name outside of it until then
+	for _, name := range ast.AssignedNames(fn.Body) {
+		if _, ok := s.slots[name]; !ok {
+			s.slots[name] = len(fn.Locals)
+			fn.Assigned = append(fn.Assigned, len(fn.Locals))
+			fn.Locals = append(fn.Locals, name)
+		}
+	}
+
+	r.resolve(fn.Body)
+	for _, nested := range s.pending {
+		r.function(nested)
+	}
+	r.scopes = r.scopes[:len(r.scopes)-1]
+}
+
+// quoted - resolves the unquoted expressions of quoted code, they run where
+// the quote does. The rest is code to expand somewhere else.
+func (r *Resolver) quoted(node ast.Node) {
+	ast.Modify(node, func(node ast.Node) ast.Node {
+		if call, ok := node.(*ast.CallExpression); ok && call.Function.TokenLiteral() == evaluator.UNQUOTE_LITERAL {
+			for _, arg := range call.Arguments {
+				r.resolve(arg)
+			}
+		}
+		return node
+	})
+}
+
+// declare - declares the variable of the identifier in the innermost
+// function, or as a global outside of functions. Declaring a variable again
+// keeps its slot.
+func (r *Resolver) declare(id *ast.Identifier) {
+	if len(r.scopes) == 0 {
+		r.declared[id.Value] = true
+	} else {
+		s := r.scopes[len(r.scopes)-1]
+		s.declared[id.Value] = true
+		if _, ok := s.slots[id.Value]; !ok {
+			s.slots[id.Value] = len(s.fn.Locals)
+			s.fn.Locals = append(s.fn.Locals, id.Value)
+		}
+	}
+
+	r.bind(id)
+}
+
+// bind - points the identifier at the variable it refers to, the one of the
+// innermost function declaring it or else a global, which may be a builtin
+// then. Returns false if there is no such variable.
+func (r *Resolver) bind(id *ast.Identifier) bool {
+	for depth := 0; depth < len(r.scopes); depth++ {
+		if slot, ok := r.scopes[len(r.scopes)-1-depth].slots[id.Value]; ok {
+			id.Scope, id.Depth, id.Slot = ast.LocalScope, depth, slot
+			return true
+		}
+	}
+
+	id.Scope, id.Depth, id.Slot = ast.GlobalScope, 0, 0
+	return r.declared[id.Value] || r.globals[id.Value]
+}
+
+// assignable - whether there is a variable to assign with the name: one the
+// innermost function declared so far, one of the functions around it or a
+// global. Builtins aren't variables.
+func (r *Resolver) assignable(name string) bool {
+	for depth := 0; depth < len(r.scopes); depth++ {
+		s := r.scopes[len(r.scopes)-1-depth]
+		if _, ok := s.slots[name]; (depth == 0 && s.declared[name]) || (depth > 0 && ok) {
+			return true
+		}
+	}
+
+	return r.declared[name] || r.globals[name]
+}
+
+func (r *Resolver) errorAt(node ast.Node, code diagnostic.Code, format string, a ...interface{}) {
+	r.diags = append(r.diags, &diagnostic.Diagnostic{
+		Severity: diagnostic.Error,
+		Code:     code,
+		Message:  fmt.Sprintf(format, a...),
+		Pos:      node.Pos(),
+		End:      node.End(),
+	})
+}
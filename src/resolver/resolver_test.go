@@ -0,0 +1,180 @@
+package resolver
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"sudocoding.xyz/interpreter_in_go/src/diagnostic"
+	"sudocoding.xyz/interpreter_in_go/src/evaluator"
+	"sudocoding.xyz/interpreter_in_go/src/lexer"
+	"sudocoding.xyz/interpreter_in_go/src/object"
+	"sudocoding.xyz/interpreter_in_go/src/parser"
+	"sudocoding.xyz/interpreter_in_go/src/parser/ast"
+)
+
+func eq[T comparable](t *testing.T, expected T, actual T, msg ...string) {
+	if expected != actual {
+		t.Fatalf("%s\nexpected: %+v\nactual: %+v\n", strings.Join(msg, " "), expected, actual)
+	}
+}
+
+func parse(t *testing.T, input string) *ast.Program {
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	eq(t, 0, len(p.Errors()), "parser errors")
+	return program
+}
+
+// bindings - the identifiers of the functions of the program along with
+// where their variables live, e.g. `a=L0.1`, and the slots of the functions
+func bindings(node ast.Node) string {
+	out := []string{}
+
+	var walk func(node ast.Node)
+	walk = func(node ast.Node) {
+		ast.Modify(node, func(node ast.Node) ast.Node {
+			switch node := node.(type) {
+			case *ast.Identifier:
+				switch node.Scope {
+				case ast.LocalScope:
+					out = append(out, fmt.Sprintf("%s=L%d.%d", node.Value, node.Depth, node.Slot))
+				case ast.GlobalScope:
+					out = append(out, node.Value+"=G")
+				default:
+					out = append(out, node.Value+"=?")
+				}
+			case *ast.CallExpression:
+				walk(node.Function)
+				for _, arg := range node.Arguments {
+					walk(arg)
+				}
+			case *ast.FunctionLiteral:
+				out = append(out, "fn["+strings.Join(node.Locals, ",")+"]")
+			case *ast.LetStatement:
+				walk(node.Name)
+			case *ast.Assignment:
+				walk(node.Identifier)
+			}
+			return node
+		})
+	}
+	walk(node)
+
+	return strings.Join(out, " ")
+}
+
+func Test_Resolve(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let x = 1; x", "x=G x=G"},
+		{"len", "len=G"},
+		{"fn(a, b) { a + b }", "a=L0.0 b=L0.1 fn[a,b]"},
+		{"fn(a) { let b = a; b }", "a=L0.0 b=L0.1 b=L0.1 fn[a,b]"},
+		{"fn(a) { fn() { a } }", "a=L1.0 fn[] fn[a]"},
+		// Functions see the globals declared after them
+		{"let f = fn() { g }; let g = 1", "g=G fn[] f=G g=G"},
+		// Functions see the variables declared after them in the function
+		// around them, so they can call each other
+		{"fn() { let a = fn() { b() }; let b = fn() { a() } }", "b=L1.1 fn[] a=L0.0 a=L1.0 fn[] b=L0.1 fn[a,b]"},
+		// Recursive functions see themselves
+		{"fn() { let f = fn() { f() } }", "f=L1.0 fn[] f=L0.0 fn[f]"},
+		// Variables are visible from their declaration on
+		{"let x = 1; fn() { let y = x; let x = 2; x }", "x=G x=G y=L0.0 x=L0.1 x=L0.1 fn[y,x]"},
+		{"fn(a) { a = 2; let a = 3 }", "a=L0.0 a=L0.0 fn[a]"},
+		// Functions assign variables of their own
+		{"let x = 1; fn() { x = x + 1 }", "x=G x=L0.0 x=L0.0 fn[x]"},
+		{"fn(xs) { for (i, x in xs) { x }\n try { 1 } catch (e) { e } }", "xs=L0.0 x=L0.2 e=L0.3 fn[xs,i,x,e]"},
+		// Unquoted code runs where the quote does, the rest is code
+		{"fn(a) { quote(unquote(a) + b) }", "quote=? unquote=? a=L0.0 b=? fn[a]"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.input, func(t *testing.T) {
+			program := parse(t, test.input)
+			eq(t, 0, len(New().Resolve(program)), "Unexpected diagnostics")
+			eq(t, test.expected, bindings(program))
+		})
+	}
+}
+
+func Test_ResolveErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		code     diagnostic.Code
+		expected string
+	}{
+		{"foobar", ErrUndefined, "1:1: error[R0001]: identifier not found: foobar"},
+		{"x; let x = 1;", ErrUndefined, "1:1: error[R0001]: identifier not found: x"},
+		{"let f = fn() { g }", ErrUndefined, "1:16: error[R0001]: identifier not found: g"},
+		{"fn() { let a = 1 }; a", ErrUndefined, "1:21: error[R0001]: identifier not found: a"},
+		{`"value: ${missing}"`, ErrUndefined, "1:11: error[R0001]: identifier not found: missing"},
+		{"a = 5;", ErrUnassigned, "1:1: error[R0002]: variable a hasn't been initialized"},
+		{"fn() { a = 5; let a = 1 }", ErrUnassigned, "1:8: error[R0002]: variable a hasn't been initialized"},
+		{"len = 5;", ErrUnassigned, "1:1: error[R0002]: variable len hasn't been initialized"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.input, func(t *testing.T) {
+			diags := New().Resolve(parse(t, test.input))
+			eq(t, 1, len(diags), "Expected one diagnostic")
+			eq(t, test.code, diags[0].Code)
+			eq(t, test.expected, diags[0].Error())
+		})
+	}
+
+	diags := New().Resolve(parse(t, "let f = fn() { b }; a"))
+	eq(t, 2, len(diags), "Expected two diagnostics")
+	eq(t, "1:16", diags[0].Pos.String(), "Diagnostics should be sorted")
+	eq(t, "1:21", diags[1].Pos.String(), "Diagnostics should be sorted")
+}
+
+func Test_ResolveKeepsGlobals(t *testing.T) {
+	r := New()
+	eq(t, 0, len(r.Resolve(parse(t, "let x = 1;"))))
+	eq(t, 0, len(r.Resolve(parse(t, "x"))), "Globals of previous programs are known")
+
+	eq(t, 1, len(r.Resolve(parse(t, "let y = 1; z"))))
+	eq(t, 1, len(r.Resolve(parse(t, "y"))), "Globals of failed programs are not")
+
+	r.Declare("z")
+	eq(t, 0, len(r.Resolve(parse(t, "z"))), "Declared globals are known")
+}
+
+// Resolved programs give the same results as the ones looked up by name
+func Test_ResolvedEval(t *testing.T) {
+	tests := []string{
+		"let fib = fn(n) { if (n < 2) { n } else { fib(n - 1) + fib(n - 2) } }; fib(15)",
+		"let adder = fn(a) { fn(b) { fn(c) { a + b + c } } }; adder(1)(2)(3)",
+		"let counter = fn() { let n = 0; fn() { n = n + 1; n } }; let c = counter(); c(); c(); c()",
+		"let x = 1; let f = fn() { let y = x; let x = 10; x + y }; f() + x",
+		"let f = fn(a, a) { a }; f(1, 2)",
+		"let f = fn(xs) { let sum = 0; for (i, x in xs) { sum = sum + i * x }\n sum }; f([1, 2, 3])",
+		"let f = fn() { try { throw \"no\" } catch (e) { e[\"message\"] } }; f()",
+		"let f = fn() { let i = 0; while (i < 5) { i = i + 1; if (i == 3) { break } }\n i }; f()",
+		"let f = fn(a) { quote(unquote(a) + 1) }; f(2)",
+		"let f = fn() { g() }; let g = fn() { 7 }; f()",
+		"let f = fn() { let a = fn(n) { if (n == 0) { true } else { b(n - 1) } }; let b = fn(n) { a(n) }; a(3) }; f()",
+		"let n = 0; let inc = fn() { n = n + 1 }; inc(); inc(); n",
+		"let t = 10; let f = fn() { let i = 0; while (i < 3) { t = t + 1; i = i + 1 }\n t }; f() + t",
+		"let f = fn() { g = g + 1; g }; let g = 5; f() + g",
+		"let x = 1; let f = fn() { x = 2; let x = x + 1; x }; f() + x",
+		"let f = fn(a) { fn() { a = a * 2; a } }; let g = f(3); g() + g()",
+		"let f = fn(n) { if (n > 0) { let v = n }; v }; f(0)",
+		"let sq = fn(xs) { let out = []; for (x in xs) { out = out + [x * x] }\n out }; sq([1, 2])",
+	}
+
+	for _, input := range tests {
+		t.Run(input, func(t *testing.T) {
+			expected := evaluator.Eval(parse(t, input), object.NewEnvironment())
+
+			program := parse(t, input)
+			eq(t, 0, len(New().Resolve(program)), "Unexpected diagnostics")
+			actual := evaluator.Eval(program, object.NewEnvironment())
+
+			eq(t, expected.Inspect(), actual.Inspect())
+		})
+	}
+}
@@ -0,0 +1,31 @@
+package token
+
+import "strings"
+
+// Comment - A doc comment, `/// text`. Doc comments are kept as trivia of the
+// token following them, other comments are dropped by the lexer.
+type Comment struct {
+	Text string // Text of the comment without the leading `///`
+	Pos  Position
+	End  Position
+}
+
+// CommentGroup - The doc comments found before a token
+type CommentGroup struct {
+	List []*Comment
+}
+
+// Text - Returns the text of the comments, one line per comment. A single
+// space after the `///` is dropped.
+func (g *CommentGroup) Text() string {
+	if g == nil {
+		return ""
+	}
+
+	lines := []string{}
+	for _, c := range g.List {
+		lines = append(lines, strings.TrimPrefix(c.Text, " "))
+	}
+
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,35 @@
+package token
+
+import "fmt"
+
+// Position - A location in the source code. Lines and columns start at 1,
+// offsets start at 0. Columns are counted in runes, offsets in bytes.
+type Position struct {
+	Filename string
+	Offset   int
+	Line     int
+	Column   int
+}
+
+// IsValid - Returns true if the position points to an actual location in the
+// source. The zero value of Position is not valid.
+func (p Position) IsValid() bool {
+	return p.Line > 0
+}
+
+// String - Returns the position in the `file:line:column` form. The file part
+// is dropped if the position has no file name and `-` is returned for invalid
+// positions.
+func (p Position) String() string {
+	if !p.IsValid() {
+		if p.Filename != "" {
+			return p.Filename
+		}
+		return "-"
+	}
+
+	if p.Filename == "" {
+		return fmt.Sprintf("%d:%d", p.Line, p.Column)
+	}
+	return fmt.Sprintf("%s:%d:%d", p.Filename, p.Line, p.Column)
+}
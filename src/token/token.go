@@ -7,10 +7,16 @@ package token
 // byte.
 type TokenType string
 
-// Token - We hold the token type and its corresponding literal
+// Token - We hold the token type and its corresponding literal along with
+// the span of source code it was read from. `Pos` points to the first
+// character of the token and `End` to the character right after it. `Doc`
+// holds the doc comments written right before the token, if any.
 type Token struct {
 	Type    TokenType
 	Literal string
+	Pos     Position
+	End     Position
+	Doc     *CommentGroup
 }
 
 // The tokens of our langauge
@@ -21,15 +27,25 @@ const (
 	// Identifiers + Literals
 	IDENT TokenType = "IDENT" // add, foobar, x, y, ...
 	INT             = "INT"   // 12345
+	FLOAT           = "FLOAT" // 1.5, 2e10, .5
 	STR             = "STR"   // string
 
+	// Interpolated strings, `"a ${x} b ${y} c"` is read as the parts
+	// STR_HEAD(a ) x STR_MID( b ) y STR_TAIL( c)
+	STR_HEAD TokenType = "STR_HEAD" // text till the first `${`
+	STR_MID            = "STR_MID"  // text between a `}` and the next `${`
+	STR_TAIL           = "STR_TAIL" // text between the last `}` and the closing `"`
+
 	// Operators
-	ASSIGN   TokenType = "="
-	PLUS               = "+"
-	MINUS              = "-"
-	BANG               = "!"
-	ASTERISK           = "*"
-	SLASH              = "/"
+	ASSIGN    TokenType = "="
+	PLUS                = "+"
+	MINUS               = "-"
+	BANG                = "!"
+	ASTERISK            = "*"
+	SLASH               = "/"
+	PERCENT             = "%"
+	POWER               = "**"
+	FLOOR_DIV           = "~/"
 
 	// Equality
 	GT     TokenType = ">"
@@ -39,6 +55,18 @@ const (
 	GTE              = ">="
 	LTE              = "<="
 
+	// Logical
+	AND TokenType = "&&"
+	OR            = "||"
+
+	// Bitwise
+	BIT_AND TokenType = "&"
+	BIT_OR            = "|"
+	BIT_XOR           = "^"
+	BIT_NOT           = "~"
+	SHL               = "<<"
+	SHR               = ">>"
+
 	// Delimiters
 	COMMA     TokenType = ","
 	SEMICOLON           = ";"
@@ -59,20 +87,38 @@ const (
 	ELSE               = "ELSE"
 	RETURN             = "RETURN"
 	MACRO              = "MACRO"
+	TRY                = "TRY"
+	CATCH              = "CATCH"
+	FINALLY            = "FINALLY"
+	THROW              = "THROW"
+	WHILE              = "WHILE"
+	FOR                = "FOR"
+	IN                 = "IN"
+	BREAK              = "BREAK"
+	CONTINUE           = "CONTINUE"
 
 	// String Tokens
 	DOUBLE_QUOTES TokenType = "\""
 )
 
 var keywords = map[string]TokenType{
-	"fn":     FUNCTION,
-	"let":    LET,
-	"true":   TRUE,
-	"false":  FALSE,
-	"if":     IF,
-	"else":   ELSE,
-	"return": RETURN,
-	"macro":  MACRO,
+	"fn":       FUNCTION,
+	"let":      LET,
+	"true":     TRUE,
+	"false":    FALSE,
+	"if":       IF,
+	"else":     ELSE,
+	"return":   RETURN,
+	"macro":    MACRO,
+	"try":      TRY,
+	"catch":    CATCH,
+	"finally":  FINALLY,
+	"throw":    THROW,
+	"while":    WHILE,
+	"for":      FOR,
+	"in":       IN,
+	"break":    BREAK,
+	"continue": CONTINUE,
 }
 
 // LookupIdent - Checks the keywords map. If the keyword is mapped to a token type
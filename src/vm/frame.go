@@ -0,0 +1,48 @@
+package vm
+
+import (
+	"sudocoding.xyz/interpreter_in_go/src/object"
+	"sudocoding.xyz/interpreter_in_go/src/token"
+)
+
+// Frame - a call of a closure in progress
+type Frame struct {
+	cl          *object.Closure
+	scope       *object.Scope // Locals of the call
+	ip          int           // Offset of the next instruction
+	basePointer int           // Height of the stack when the call started
+	pos         token.Position
+	main        bool // The frame of the program itself, not a function call
+}
+
+// NewFrame - creates the frame of a call of the closure from `pos`, with the
+// stack as high as `basePointer`
+func NewFrame(cl *object.Closure, basePointer int, pos token.Position) *Frame {
+	return &Frame{
+		cl:          cl,
+		scope:       &object.Scope{Locals: make([]object.Object, cl.Fn.NumLocals), Names: cl.Fn.LocalNames, Outer: cl.Outer},
+		basePointer: basePointer,
+		pos:         pos,
+	}
+}
+
+// Instructions - the instructions of the called function
+func (f *Frame) Instructions() []byte {
+	return f.cl.Fn.Instructions
+}
+
+// Pos - the source position of the instruction at the offset
+func (f *Frame) Pos(offset int) token.Position {
+	return f.cl.Fn.Positions.Lookup(offset)
+}
+
+// name - name of the called function to use in stack traces
+func (f *Frame) name() string {
+	if f.main {
+		return "<main>"
+	}
+	if f.cl.Fn.Name == "" {
+		return "<anonymous>"
+	}
+	return f.cl.Fn.Name
+}
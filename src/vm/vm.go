@@ -0,0 +1,599 @@
+// Package vm - the stack machine running the bytecode of the compiler
+package vm
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"sudocoding.xyz/interpreter_in_go/src/code"
+	"sudocoding.xyz/interpreter_in_go/src/compiler"
+	"sudocoding.xyz/interpreter_in_go/src/evaluator"
+	"sudocoding.xyz/interpreter_in_go/src/object"
+	"sudocoding.xyz/interpreter_in_go/src/token"
+)
+
+const (
+	GlobalsSize = 1 << 16 // Globals a program can define, OpGetGlobal has a two bytes operand
+	MaxFrames   = 1 << 16 // Nested calls without limits before a stack overflow
+)
+
+// operators - the infix operators of the opcodes, as the evaluator names them
+var operators = map[code.Opcode]token.TokenType{
+	code.OpAdd:          token.PLUS,
+	code.OpSub:          token.MINUS,
+	code.OpMul:          token.ASTERISK,
+	code.OpDiv:          token.SLASH,
+	code.OpMod:          token.PERCENT,
+	code.OpFloorDiv:     token.FLOOR_DIV,
+	code.OpPow:          token.POWER,
+	code.OpBitAnd:       token.BIT_AND,
+	code.OpBitOr:        token.BIT_OR,
+	code.OpBitXor:       token.BIT_XOR,
+	code.OpShl:          token.SHL,
+	code.OpShr:          token.SHR,
+	code.OpEqual:        token.EQ,
+	code.OpNotEqual:     token.NOT_EQ,
+	code.OpGreaterThan:  token.GT,
+	code.OpGreaterEqual: token.GTE,
+	code.OpLessThan:     token.LT,
+	code.OpLessEqual:    token.LTE,
+}
+
+var prefixOperators = map[code.Opcode]string{
+	code.OpMinus:  "-",
+	code.OpBang:   "!",
+	code.OpBitNot: "~",
+}
+
+// builtins - the builtins by the index the compiler gives them
+var builtins = func() []*object.Builtin {
+	names := evaluator.BuiltinNames()
+	builtins := make([]*object.Builtin, len(names))
+	for i, name := range names {
+		builtins[i], _ = evaluator.LookupBuiltin(name)
+	}
+	return builtins
+}()
+
+// VM - runs compiled programs. The VM is the context of the builtins it calls,
+// they can call closures back.
+type VM struct {
+	constants   []object.Object
+	globals     []object.Object
+	globalNames []string
+
+	instructions code.Instructions
+	positions    code.PosTable
+
+	stack    []object.Object
+	frames   []*Frame
+	handlers []handler
+
+	io     *object.IO
+	limits *object.Limits
+	trace  io.Writer // Where executed instructions are logged, nil for nowhere
+}
+
+// handler - an OpTry in progress: where to jump on errors, and the stack and
+// frames to get back to
+type handler struct {
+	ip     int
+	sp     int
+	frames int
+}
+
+// iterator - state of a for-in loop, kept on the stack
+type iterator struct {
+	keys   []object.Object
+	values []object.Object
+	next   int
+}
+
+func (it *iterator) Type() object.ObjectType {
+	return "ITERATOR"
+}
+
+func (it *iterator) Inspect() string {
+	return "<iterator>"
+}
+
+// New - creates a VM for the program, with globals of its own
+func New(bytecode *compiler.Bytecode) *VM {
+	return NewWithGlobals(bytecode, make([]object.Object, GlobalsSize))
+}
+
+// NewWithGlobals - creates a VM for the program, with the globals of previous
+// programs compiled by the same compiler
+func NewWithGlobals(bytecode *compiler.Bytecode, globals []object.Object) *VM {
+	return &VM{
+		constants:    bytecode.Constants,
+		globals:      globals,
+		globalNames:  bytecode.Globals,
+		instructions: bytecode.Instructions,
+		positions:    bytecode.Positions,
+		io:           object.StdIO,
+	}
+}
+
+// SetIO - sets the streams the builtins use
+func (vm *VM) SetIO(io *object.IO) {
+	vm.io = io
+}
+
+// SetLimits - bounds the execution of the program, nil for no bounds
+func (vm *VM) SetLimits(limits *object.Limits) {
+	vm.limits = limits
+}
+
+// SetTrace - logs every instruction executed to `out` along with the stack
+// it runs on, nil to stop
+func (vm *VM) SetTrace(out io.Writer) {
+	vm.trace = out
+}
+
+// IO - the streams of the program, for the builtins
+func (vm *VM) IO() *object.IO {
+	return vm.io
+}
+
+// Run - runs the program. Returns the value of its last statement, or an
+// *object.Error if it failed.
+func (vm *VM) Run() object.Object {
+	main := &object.CompiledFunction{Instructions: vm.instructions, Positions: vm.positions, Name: "<main>"}
+	frame := NewFrame(&object.Closure{Fn: main}, 0, token.Position{})
+	frame.main = true
+
+	vm.stack = vm.stack[:0]
+	vm.frames = append(vm.frames[:0], frame)
+	vm.handlers = vm.handlers[:0]
+
+	return vm.run(0)
+}
+
+// Call - calls the closure or the builtin, from the instruction running if
+// the program is running. The result is an *object.Error if the call failed.
+func (vm *VM) Call(fn object.Object, args ...object.Object) object.Object {
+	base := len(vm.frames)
+
+	if err := vm.call(fn, args, vm.callPos()); err != nil {
+		return err
+	}
+	if len(vm.frames) == base {
+		// A builtin, whose result is on the stack
+		return vm.pop()
+	}
+
+	return vm.run(base)
+}
+
+// callPos - position of the instruction of the innermost frame
+func (vm *VM) callPos() token.Position {
+	if len(vm.frames) == 0 {
+		return token.Position{}
+	}
+
+	frame := vm.frames[len(vm.frames)-1]
+	return frame.Pos(frame.ip - 1)
+}
+
+// run - runs the instructions until the frame at index `base` returns. Errors
+// raised are caught by the handlers of the frames from `base` on, or end the
+// run.
+func (vm *VM) run(base int) object.Object {
+	for {
+		frame := vm.frames[len(vm.frames)-1]
+		ins := frame.cl.Fn.Instructions
+
+		if frame.ip >= len(ins) {
+			// Only an empty program has no return
+			vm.frames = vm.frames[:len(vm.frames)-1]
+			return nil
+		}
+
+		if vm.limits != nil {
+			if err := evaluator.Step(vm.limits); err != nil {
+				err.Pos = frame.Pos(frame.ip)
+				if result, done := vm.raise(err, base); done {
+					return result
+				}
+				continue
+			}
+		}
+
+		ip := frame.ip
+		op := code.Opcode(ins[ip])
+		frame.ip += 1
+
+		if vm.trace != nil {
+			vm.traceInstruction(frame, ip)
+		}
+
+		var err *object.Error
+
+		switch op {
+		case code.OpConstant:
+			vm.push(vm.constants[vm.readUint16(frame)])
+		case code.OpPop:
+			vm.pop()
+		case code.OpDup:
+			vm.push(vm.stack[len(vm.stack)-1])
+
+		case code.OpAdd, code.OpSub, code.OpMul, code.OpDiv, code.OpMod, code.OpFloorDiv, code.OpPow,
+			code.OpBitAnd, code.OpBitOr, code.OpBitXor, code.OpShl, code.OpShr,
+			code.OpEqual, code.OpNotEqual, code.OpGreaterThan, code.OpGreaterEqual, code.OpLessThan, code.OpLessEqual:
+			right := vm.pop()
+			left := vm.pop()
+			err = vm.pushResult(binaryOp(op, left, right))
+		case code.OpMinus, code.OpBang, code.OpBitNot:
+			err = vm.pushResult(evaluator.EvalPrefix(prefixOperators[op], vm.pop()))
+
+		case code.OpTrue:
+			vm.push(evaluator.TRUE)
+		case code.OpFalse:
+			vm.push(evaluator.FALSE)
+		case code.OpNull:
+			vm.push(evaluator.NULL)
+
+		case code.OpJump:
+			frame.ip = int(code.ReadUint16(ins[frame.ip:]))
+		case code.OpJumpNotTruthy:
+			target := vm.readUint16(frame)
+			if !evaluator.IsTruthy(vm.pop()) {
+				frame.ip = target
+			}
+
+		case code.OpGetGlobal:
+			index := vm.readUint16(frame)
+			if value := vm.globals[index]; value != nil {
+				vm.push(value)
+			} else {
+				err = newError("identifier not found: %s", vm.globalNames[index])
+			}
+		case code.OpSetGlobal:
+			vm.globals[vm.readUint16(frame)] = vm.pop()
+		case code.OpAssignGlobal:
+			index := vm.readUint16(frame)
+			value := vm.pop()
+			if vm.globals[index] != nil {
+				vm.globals[index] = value
+			} else {
+				err = newError("variable %s hasn't been initialized", vm.globalNames[index])
+			}
+		case code.OpCopyGlobal:
+			global := vm.readUint16(frame)
+			frame.scope.Locals[vm.readUint8(frame)] = vm.globals[global]
+		case code.OpGetLocal:
+			index := vm.readUint8(frame)
+			err = vm.pushLocal(frame.scope, index)
+		case code.OpSetLocal:
+			frame.scope.Locals[vm.readUint8(frame)] = vm.pop()
+		case code.OpAssignLocal:
+			index := vm.readUint8(frame)
+			value := vm.pop()
+			if frame.scope.Locals[index] != nil {
+				frame.scope.Locals[index] = value
+			} else {
+				err = newError("variable %s hasn't been initialized", frame.scope.Names[index])
+			}
+		case code.OpGetFree:
+			depth := vm.readUint8(frame)
+			index := vm.readUint8(frame)
+			err = vm.pushLocal(outerScope(frame.scope, depth), index)
+		case code.OpCopyFree:
+			depth := vm.readUint8(frame)
+			index := vm.readUint8(frame)
+			frame.scope.Locals[vm.readUint8(frame)] = outerScope(frame.scope, depth).Locals[index]
+		case code.OpGetBuiltin:
+			vm.push(builtins[vm.readUint8(frame)])
+
+		case code.OpArray:
+			n := vm.readUint16(frame)
+			elements := make([]object.Object, n)
+			copy(elements, vm.stack[len(vm.stack)-n:])
+			vm.stack = vm.stack[:len(vm.stack)-n]
+			vm.push(&object.Array{Elements: elements})
+		case code.OpHash:
+			err = vm.buildHash(vm.readUint16(frame))
+		case code.OpIndex:
+			index := vm.pop()
+			left := vm.pop()
+			err = vm.pushResult(evaluator.EvalIndex(left, index))
+		case code.OpInterpolate:
+			n := vm.readUint16(frame)
+			var out strings.Builder
+			for _, value := range vm.stack[len(vm.stack)-n:] {
+				out.WriteString(value.Inspect())
+			}
+			vm.stack = vm.stack[:len(vm.stack)-n]
+			vm.push(&object.String{Value: out.String()})
+
+		case code.OpCall:
+			n := vm.readUint8(frame)
+			fn := vm.stack[len(vm.stack)-1-n]
+			args := make([]object.Object, n)
+			copy(args, vm.stack[len(vm.stack)-n:])
+			vm.stack = vm.stack[:len(vm.stack)-1-n]
+			err = vm.call(fn, args, frame.Pos(ip))
+		case code.OpReturnValue:
+			value := vm.pop()
+			vm.popFrame()
+			if len(vm.frames) == base {
+				return value
+			}
+			vm.push(value)
+		case code.OpClosure:
+			fn := vm.constants[vm.readUint16(frame)].(*object.CompiledFunction)
+			vm.push(&object.Closure{Fn: fn, Outer: frame.scope})
+
+		case code.OpThrow:
+			err = evaluator.Throw(vm.pop())
+		case code.OpTry:
+			target := vm.readUint16(frame)
+			vm.handlers = append(vm.handlers, handler{ip: target, sp: len(vm.stack), frames: len(vm.frames)})
+		case code.OpEndTry:
+			vm.handlers = vm.handlers[:len(vm.handlers)-1]
+		case code.OpRethrow:
+			err = vm.pop().(*object.Exception).Err
+
+		case code.OpIter:
+			withKeys := vm.readUint8(frame) == 1
+			keys, values, iterErr := evaluator.Iterate(vm.pop(), withKeys)
+			if iterErr != nil {
+				err = iterErr
+			} else {
+				vm.push(&iterator{keys: keys, values: values})
+			}
+		case code.OpIterNext:
+			target := vm.readUint16(frame)
+			it := vm.stack[len(vm.stack)-1].(*iterator)
+			if it.next < len(it.values) {
+				vm.push(it.keys[it.next])
+				vm.push(it.values[it.next])
+				it.next += 1
+			} else {
+				vm.pop()
+				frame.ip = target
+			}
+
+		default:
+			err = newError("unknown opcode %d", op)
+		}
+
+		if err != nil {
+			if !err.Pos.IsValid() {
+				err.Pos = frame.Pos(ip)
+			}
+			if result, done := vm.raise(err, base); done {
+				return result
+			}
+		}
+	}
+}
+
+// traceInstruction - logs the instruction at the offset of the frame, with
+// the function it's in and the stack, top last
+func (vm *VM) traceInstruction(frame *Frame, offset int) {
+	ins := frame.Instructions()
+	def, err := code.Lookup(ins[offset])
+	if err != nil {
+		fmt.Fprintf(vm.trace, "%-16s %04d ERROR: %s\n", frame.name(), offset, err)
+		return
+	}
+
+	operands, _ := code.ReadOperands(def, ins[offset+1:])
+
+	values := make([]string, len(vm.stack))
+	for i, value := range vm.stack {
+		if str, ok := value.(*object.String); ok {
+			values[i] = strconv.Quote(str.Value)
+		} else {
+			values[i] = value.Inspect()
+		}
+	}
+
+	fmt.Fprintf(vm.trace, "%-16s %04d %-24s [%s]\n", frame.name(), offset, code.FormatInstruction(def, operands), strings.Join(values, ", "))
+}
+
+// call - calls the closure, pushing its frame, or the builtin, pushing its
+// result
+func (vm *VM) call(fn object.Object, args []object.Object, pos token.Position) *object.Error {
+	switch fn := fn.(type) {
+	case *object.Closure:
+		if len(args) != fn.Fn.NumParameters {
+			name := fn.Fn.Name
+			if name == "" {
+				name = "<anonymous>"
+			}
+			return newError("wrong number of arguments to `%s`. got=%d, want=%d", name, len(args), fn.Fn.NumParameters)
+		}
+
+		if vm.limits != nil {
+			if err := evaluator.EnterCall(vm.limits); err != nil {
+				return err
+			}
+		} else if len(vm.frames) >= MaxFrames {
+			return newError("stack overflow: more than %d nested calls", MaxFrames)
+		}
+
+		frame := NewFrame(fn, len(vm.stack), pos)
+		copy(frame.scope.Locals, args)
+		vm.frames = append(vm.frames, frame)
+		return nil
+	case *object.Builtin:
+		result := fn.Fn(vm, args...)
+		if err, ok := result.(*object.Error); ok {
+			return err
+		}
+		if result == nil {
+			result = evaluator.NULL
+		}
+		vm.push(result)
+		return nil
+	}
+
+	return newError("not a function: %s", fn.Type())
+}
+
+// raise - unwinds the frames to the innermost handler of the run from `base`
+// and jumps to it with the exception on the stack. Errors exceeding limits
+// aren't caught. Returns the error and true if no handler catches it, the
+// frames of the run are gone then.
+func (vm *VM) raise(err *object.Error, base int) (object.Object, bool) {
+	if n := len(vm.handlers); err.Limit == nil && n > 0 && vm.handlers[n-1].frames > base {
+		h := vm.handlers[n-1]
+		vm.handlers = vm.handlers[:n-1]
+
+		for len(vm.frames) > h.frames {
+			vm.unwindFrame(err)
+		}
+		vm.stack = vm.stack[:h.sp]
+		vm.push(&object.Exception{Err: err})
+		vm.frames[len(vm.frames)-1].ip = h.ip
+		return nil, false
+	}
+
+	for n := len(vm.handlers); n > 0 && vm.handlers[n-1].frames > base; n-- {
+		vm.handlers = vm.handlers[:n-1]
+	}
+	for len(vm.frames) > base {
+		vm.unwindFrame(err)
+	}
+	return err, true
+}
+
+// unwindFrame - drops the innermost frame the error leaves, recording the
+// call in the stack of the error
+func (vm *VM) unwindFrame(err *object.Error) {
+	frame := vm.frames[len(vm.frames)-1]
+	if !frame.main {
+		err.Stack = append(err.Stack, object.Frame{Function: frame.name(), Pos: frame.pos})
+	}
+	vm.popFrame()
+}
+
+func (vm *VM) popFrame() {
+	frame := vm.frames[len(vm.frames)-1]
+	vm.frames = vm.frames[:len(vm.frames)-1]
+	vm.stack = vm.stack[:frame.basePointer]
+
+	if vm.limits != nil && !frame.main {
+		evaluator.LeaveCall(vm.limits)
+	}
+}
+
+func (vm *VM) buildHash(n int) *object.Error {
+	hash := &object.Hash{Pairs: make(map[object.HashKey]object.HashPair, n/2)}
+
+	values := vm.stack[len(vm.stack)-n:]
+	vm.stack = vm.stack[:len(vm.stack)-n]
+
+	for i := 0; i < n; i += 2 {
+		key, value := values[i], values[i+1]
+
+		hashable, ok := key.(object.Hashable)
+		if !ok {
+			return newError("key of type %s is not hashable", key.Type())
+		}
+		hash.Pairs[hashable.Hash()] = object.HashPair{Key: key, Value: value}
+	}
+
+	vm.push(hash)
+	return nil
+}
+
+// pushLocal - pushes the local at the index of the scope, failing if it's
+// not set yet
+func (vm *VM) pushLocal(scope *object.Scope, index int) *object.Error {
+	if value := scope.Locals[index]; value != nil {
+		vm.push(value)
+		return nil
+	}
+
+	return newError("identifier not found: %s", scope.Names[index])
+}
+
+// pushResult - pushes the result of an operation, unless it's an error
+func (vm *VM) pushResult(result object.Object) *object.Error {
+	if err, ok := result.(*object.Error); ok {
+		return err
+	}
+
+	vm.push(result)
+	return nil
+}
+
+func (vm *VM) push(obj object.Object) {
+	vm.stack = append(vm.stack, obj)
+}
+
+func (vm *VM) pop() object.Object {
+	obj := vm.stack[len(vm.stack)-1]
+	vm.stack = vm.stack[:len(vm.stack)-1]
+	return obj
+}
+
+func (vm *VM) readUint16(frame *Frame) int {
+	value := int(code.ReadUint16(frame.cl.Fn.Instructions[frame.ip:]))
+	frame.ip += 2
+	return value
+}
+
+func (vm *VM) readUint8(frame *Frame) int {
+	value := int(code.ReadUint8(frame.cl.Fn.Instructions[frame.ip:]))
+	frame.ip += 1
+	return value
+}
+
+// outerScope - the scope of the function `depth` levels out
+func outerScope(scope *object.Scope, depth int) *object.Scope {
+	for i := 0; i < depth; i++ {
+		scope = scope.Outer
+	}
+	return scope
+}
+
+// binaryOp - applies the operator of the opcode. The common operations on
+// integers are done here, the others by the evaluator.
+func binaryOp(op code.Opcode, left, right object.Object) object.Object {
+	l, lok := left.(*object.Integer)
+	r, rok := right.(*object.Integer)
+	if lok && rok {
+		switch op {
+		case code.OpAdd:
+			if sum := l.Value + r.Value; (sum > l.Value) == (r.Value > 0) {
+				return &object.Integer{Value: sum}
+			}
+		case code.OpSub:
+			if diff := l.Value - r.Value; (diff < l.Value) == (r.Value > 0) {
+				return &object.Integer{Value: diff}
+			}
+		case code.OpEqual:
+			return nativeBool(l.Value == r.Value)
+		case code.OpNotEqual:
+			return nativeBool(l.Value != r.Value)
+		case code.OpGreaterThan:
+			return nativeBool(l.Value > r.Value)
+		case code.OpGreaterEqual:
+			return nativeBool(l.Value >= r.Value)
+		case code.OpLessThan:
+			return nativeBool(l.Value < r.Value)
+		case code.OpLessEqual:
+			return nativeBool(l.Value <= r.Value)
+		}
+	}
+
+	return evaluator.EvalInfix(left, string(operators[op]), right)
+}
+
+func nativeBool(value bool) *object.Boolean {
+	if value {
+		return evaluator.TRUE
+	}
+	return evaluator.FALSE
+}
+
+func newError(format string, a ...interface{}) *object.Error {
+	return &object.Error{Message: fmt.Sprintf(format, a...)}
+}
@@ -0,0 +1,289 @@
+package vm
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"sudocoding.xyz/interpreter_in_go/src/compiler"
+	"sudocoding.xyz/interpreter_in_go/src/evaluator"
+	"sudocoding.xyz/interpreter_in_go/src/lexer"
+	"sudocoding.xyz/interpreter_in_go/src/object"
+	"sudocoding.xyz/interpreter_in_go/src/parser"
+	"sudocoding.xyz/interpreter_in_go/src/parser/ast"
+)
+
+func eq[T comparable](t *testing.T, expected T, actual T, msg ...string) {
+	if expected != actual {
+		t.Fatalf("%s\nexpected: %+v\nactual: %+v\n", strings.Join(msg, " "), expected, actual)
+	}
+}
+
+func notEq[T comparable](t *testing.T, expected T, actual T, msg ...string) {
+	if expected == actual {
+		t.Fatalf("%s\nexpected not: %+v\nactual: %+v\n", strings.Join(msg, " "), expected, actual)
+	}
+}
+
+func parse(t *testing.T, input string) *ast.Program {
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	eq(t, 0, len(p.Errors()), "parser errors")
+	return program
+}
+
+func testRun(t *testing.T, input string) object.Object {
+	c := compiler.New()
+	err := c.Compile(parse(t, input))
+	eq(t, nil, err, "compile error")
+
+	return New(c.Bytecode()).Run()
+}
+
+// describe - the result of a program, the same way for both backends
+func describe(obj object.Object) string {
+	switch obj := obj.(type) {
+	case nil:
+		return "<nil>"
+	case *object.Error:
+		return "ERROR: " + obj.Message + " at " + obj.Pos.String()
+	}
+	return obj.Inspect()
+}
+
+func Test_Run(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"", "<nil>"},
+		{"5", "5"},
+		{"1 + 2 * 3 - 4 / 2", "5"},
+		{"-7 ~/ 2; 7 % 3; 2 ** 10", "1024"},
+		{"9223372036854775807 + 1", "9223372036854775808"},
+		{"-9223372036854775807 - 2", "-9223372036854775809"},
+		{"1.5 * 2", "3.0"},
+		{"~5 & 12 | 1 ^ 3 << 2", "13"},
+		{"1 < 2 == true", "true"},
+		{`"a" + "b" == "ab"`, "true"},
+		{"!0", "true"},
+		{"let a = 5; let b = a * 2; b", "10"},
+		{"let a = 1; a = a + 1; a", "2"},
+		{"if (1 > 2) { 10 }", "null"},
+		{"if (1 < 2) { 10 } else { 20 }", "10"},
+		{"if (false) { 10 } else { }", "null"},
+		{"0 && 1", "0"},
+		{"2 && 3", "3"},
+		{"0 || 4", "4"},
+		{"5 || 4", "5"},
+		{`"x = ${1 + 2}!"`, "x = 3!"},
+		{"[1, 2 * 2, 3][1]", "4"},
+		{`{"a": 1, "b": 2}["b"]`, "2"},
+		{`let h = {1: "one", true: "yes"}; h[true]`, "yes"},
+		{"[1, 2][5]", "null"},
+		{"len([1, 2, 3])", "3"},
+		{"first(rest([1, 2, 3]))", "2"},
+		{"let add = fn(a, b) { a + b }; add(2, 3)", "5"},
+		{"fn() { return 1; 2 }()", "1"},
+		{"fn() { }()", "null"},
+		{"fn() { let x = 1 }()", "null"},
+		{"let fact = fn(n) { if (n < 2) { 1 } else { n * fact(n - 1) } }; fact(20)", "2432902008176640000"},
+		{"let adder = fn(x) { fn(y) { x + y } }; adder(2)(3)", "5"},
+		{"let f = fn(a) { fn(b) { fn(c) { a + b + c } } }; f(1)(2)(3)", "6"},
+		{"let f = fn() { let a = fn(n) { if (n == 0) { true } else { b(n - 1) } }; let b = fn(n) { a(n) }; a(3) }; f()", "true"},
+		{"let counter = fn() { let n = 0; fn() { n = n + 1; n } }; let c = counter(); c(); c()", "1"},
+		{"let t = 10; let f = fn() { let i = 0; while (i < 3) { t = t + 1; i = i + 1 }\n t }; f() + t", "23"},
+		{"let f = fn() { g = g + 1; g }; let g = 5; f() + g", "11"},
+		{"let x = 1; let f = fn() { x = 2; let x = x + 1; x }; f() + x", "4"},
+		{"let map = fn(arr, f) { let out = []; for (x in arr) { push(out, f(x)) } out }; map([1, 2], fn(x) { x * 10 })", "[10, 20]"},
+		{"let i = 0; let s = 0; while (i < 10) { i = i + 1; if (i % 2 == 0) { continue }; if (i > 7) { break }; s = s + i } s", "16"},
+		{"let s = 0; for (i, x in [5, 6, 7]) { s = s + i * x } s", "20"},
+		{`let s = ""; for (k in {"b": 1, "a": 2}) { s = s + k } s`, "ab"},
+		{`let s = ""; for (k, v in {"b": 1, "a": 2}) { s = s + k + "${v}" } s`, "a2b1"},
+		{"let s = 0; for (x in [1, 2, 3]) { for (y in [10, 20]) { if (y > 10) { break }; s = s + x * y } } s", "60"},
+		{"let f = fn() { for (x in [1, 2, 3]) { if (x == 2) { return x } } }; f()", "2"},
+		{"for (x in []) { }", "null"},
+		{"try { 1 } catch (e) { 2 }", "1"},
+		{`try { throw "boom" } catch (e) { e["message"] }`, "boom"},
+		{`try { 1 / 0 } catch (e) { e["message"] }`, "division by zero"},
+		{`let log = []; try { push(log, 1) } finally { push(log, 2) }; log`, "[1, 2]"},
+		{`let log = ""; try { try { throw "a" } finally { log = log + "f" } } catch (e) { log = log + e["message"] }; log`, "fa"},
+		{`let f = fn() { try { return 1 } finally { len([]) } }; f()`, "1"},
+		{`let n = 0; let f = fn() { try { return 1 } finally { n = 5 } }; f() + n`, "1"},
+		{`let n = 0; while (true) { try { n = n + 1; if (n > 20) { break } } finally { n = n + 10 } } n`, "33"},
+		{`try { throw "a" } catch (e) { throw "b" } finally { }`, `ERROR: b at 1:31`},
+		{`let f = fn() { throw {"code": 7} }; try { f() } catch (e) { e["value"]["code"] }`, "7"},
+		{`let f = fn() { throw "x" }; let caught = try { f() } catch (e) { e }; let g = fn() { throw caught }; try { g() } catch (e) { 0 }; try { g() } catch (e) { len(e["stack"]) + len(caught["stack"]) }`, "5"},
+		{`try { [1][0] } catch (e) { 0 } + 1`, "2"},
+		{`1 + try { throw "x" } catch (e) { 2 }`, "3"},
+		{`let s = 0; for (x in [1, 2]) { s = s + try { if (x == 1) { continue }; x } catch (e) { 0 } } s`, "2"},
+		{"let x = 5; let f = fn() { x }; x = 6; f()", "6"},
+		{"let f = fn(x) { x = x + 1; x }; f(1)", "2"},
+		{"foo", "ERROR: identifier not found: foo at 1:1"},
+		{"foo = 1", "ERROR: variable foo hasn't been initialized at 1:1"},
+		{"let f = fn() { g = 1 }; f()", "ERROR: variable g hasn't been initialized at 1:16"},
+		{"let f = fn() { len = 1 }; f()", "ERROR: variable len hasn't been initialized at 1:16"},
+		{"let f = fn() { for (x in []) { } x }; f()", "ERROR: identifier not found: x at 1:34"},
+		{"1 + true", "ERROR: type mismatch: INTEGER + BOOLEAN at 1:3"},
+		{"-true", "ERROR: unknown operator: -BOOLEAN at 1:1"},
+		{`{[1]: 2}`, "ERROR: key of type ARRAY is not hashable at 1:1"},
+		{`"a"[0]`, "ERROR: index operator not supported: STRING[INTEGER] at 1:4"},
+		{"for (x in 5) { }", "ERROR: cannot iterate over INTEGER at 1:1"},
+		{"5()", "ERROR: not a function: INTEGER at 1:1"},
+		{"fn(a) { a }(1, 2)", "ERROR: wrong number of arguments to `<anonymous>`. got=2, want=1 at 1:1"},
+		{"len(1, 2)", "ERROR: wrong number of arguments. got=2, want=1 at 1:1"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.input, func(t *testing.T) {
+			eq(t, test.expected, describe(testRun(t, test.input)))
+		})
+	}
+}
+
+// Test_SameAsEvaluator - programs give the same results on both backends
+func Test_SameAsEvaluator(t *testing.T) {
+	tests := []string{
+		"let a = [1, 2, 3]; let h = {\"k\": a}; h[\"k\"][2] * 3",
+		"let fib = fn(n) { if (n < 2) { return n }; fib(n - 1) + fib(n - 2) }; fib(15)",
+		"let compose = fn(f, g) { fn(x) { f(g(x)) } }; compose(fn(x) { x * 2 }, fn(x) { x + 1 })(5)",
+		"let s = 0; let i = 0; while (i < 100) { i = i + 1; s = s + i } s",
+		"let f = fn(x) { if (x > 0) { 1 } }; [f(1), f(-1)]",
+		"3 // 0",
+		`let e = try { throw "x" } catch (err) { err }; [e["message"], e["value"]]`,
+		`let f = fn() { throw "deep" }; let g = fn() { f() }; g()`,
+		`let s = ""; for (i, c in "héllo") { s = s + c + "${i}" } s`,
+		"2 ** 100 - 2 ** 99",
+		"[1.5 > 1, 2 <= 2.0, 1 != 1.0]",
+	}
+
+	for _, input := range tests {
+		t.Run(input, func(t *testing.T) {
+			expected := evaluator.Eval(parse(t, input), object.NewEnvironment())
+			eq(t, describe(expected), describe(testRun(t, input)))
+		})
+	}
+}
+
+func Test_Traceback(t *testing.T) {
+	input := `let inner = fn() { 1 / 0 };
+let outer = fn() { inner() };
+outer()`
+
+	result, ok := testRun(t, input).(*object.Error)
+	eq(t, true, ok, "expected an error")
+
+	expected, _ := evaluator.Eval(parse(t, input), object.NewEnvironment()).(*object.Error)
+	eq(t, expected.Inspect(), result.Inspect())
+	eq(t, 2, len(result.Stack))
+	eq(t, "inner", result.Stack[0].Function)
+	eq(t, "2:20", result.Stack[0].Pos.String())
+}
+
+func Test_Builtins(t *testing.T) {
+	var out bytes.Buffer
+
+	c := compiler.New()
+	eq(t, nil, c.Compile(parse(t, `print("a", 1); eprint(len([1, 2]))`)))
+
+	machine := New(c.Bytecode())
+	machine.SetIO(object.NewIO(&out, &out, strings.NewReader("")))
+
+	eq(t, "null", describe(machine.Run()))
+	eq(t, "a1\n2\n", out.String())
+}
+
+func Test_Limits(t *testing.T) {
+	tests := []struct {
+		input    string
+		limits   object.Limits
+		expected string
+	}{
+		{"while (true) { }", object.Limits{MaxSteps: 1000}, "limit exceeded: more than 1000 steps"},
+		{"let f = fn() { f() }; f()", object.Limits{MaxDepth: 50}, "limit exceeded: more than 50 nested calls"},
+		{"let f = fn() { try { f() } catch (e) { 0 } }; f()", object.Limits{MaxDepth: 50}, "limit exceeded: more than 50 nested calls"},
+		{"let f = fn() { try { f() } catch (e) { f() } }; f()", object.Limits{MaxDepth: 50}, "limit exceeded: more than 50 nested calls"},
+		{"try { while (true) { } } catch (e) { 1 }", object.Limits{MaxSteps: 1000}, "limit exceeded: more than 1000 steps"},
+		{"try { while (true) { } } finally { 1 }", object.Limits{MaxSteps: 1000}, "limit exceeded: more than 1000 steps"},
+		{"let f = fn() { f() }; let g = fn() { try { f() } finally { return 1 } }; g()", object.Limits{MaxDepth: 100}, "limit exceeded: more than 100 nested calls"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.input, func(t *testing.T) {
+			c := compiler.New()
+			eq(t, nil, c.Compile(parse(t, test.input)))
+
+			limits := test.limits
+			machine := New(c.Bytecode())
+			machine.SetLimits(&limits)
+
+			result, ok := machine.Run().(*object.Error)
+			eq(t, true, ok, "expected an error")
+			eq(t, test.expected, result.Message)
+			notEq(t, nil, result.Limit)
+			eq(t, 0, limits.Depth, "calls left")
+		})
+	}
+}
+
+func Test_StackOverflow(t *testing.T) {
+	result, ok := testRun(t, "let f = fn() { f() }; f()").(*object.Error)
+	eq(t, true, ok, "expected an error")
+	eq(t, "stack overflow: more than 65536 nested calls", result.Message)
+}
+
+func Test_Globals(t *testing.T) {
+	symbols := compiler.NewSymbolTable()
+	constants := []object.Object{}
+	globals := make([]object.Object, GlobalsSize)
+
+	for _, test := range []struct{ input, expected string }{
+		{"let x = 40", "null"},
+		{"let f = fn() { x + y }", "null"},
+		{"let y = 2", "null"},
+		{"f()", "42"},
+	} {
+		c := compiler.NewWithState(symbols, constants)
+		eq(t, nil, c.Compile(parse(t, test.input)))
+
+		bytecode := c.Bytecode()
+		constants = bytecode.Constants
+		eq(t, test.expected, describe(NewWithGlobals(bytecode, globals).Run()), test.input)
+	}
+}
+
+func Test_Call(t *testing.T) {
+	c := compiler.New()
+	eq(t, nil, c.Compile(parse(t, "let n = 10; fn(x) { x * n }")))
+
+	machine := New(c.Bytecode())
+	fn := machine.Run()
+	eq(t, object.FUNCTION, fn.Type())
+
+	eq(t, "30", describe(machine.Call(fn, &object.Integer{Value: 3})))
+	eq(t, "ERROR: wrong number of arguments to `<anonymous>`. got=0, want=1 at -", describe(machine.Call(fn)))
+}
+
+func Test_Trace(t *testing.T) {
+	var trace bytes.Buffer
+
+	c := compiler.New()
+	eq(t, nil, c.Compile(parse(t, `let f = fn(x) { x * 2 }; f(3)`)))
+
+	machine := New(c.Bytecode())
+	machine.SetTrace(&trace)
+	eq(t, "6", describe(machine.Run()))
+
+	expected := `<main>           0000 OpClosure 1              []
+<main>           0003 OpSetGlobal 0            [fn(x) { <compiled> }]
+<main>           0006 OpGetGlobal 0            []
+<main>           0009 OpConstant 2             [fn(x) { <compiled> }]
+<main>           0012 OpCall 1                 [fn(x) { <compiled> }, 3]
+f                0000 OpGetLocal 0             []
+f                0002 OpConstant 0             [3]
+f                0005 OpMul                    [3, 2]
+f                0006 OpReturnValue            [6]
+<main>           0014 OpReturnValue            [6]
+`
+	eq(t, expected, trace.String())
+}